@@ -2,9 +2,14 @@ package main
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/shalomb/springfield/internal/agent"
+	"github.com/shalomb/springfield/internal/orchestrator"
 )
 
 func TestRootCmd_Help(t *testing.T) {
@@ -140,3 +145,20 @@ func TestRunMain(t *testing.T) {
 		t.Fatalf("runMain failed: %v", err)
 	}
 }
+
+func TestExitCode(t *testing.T) {
+	cases := map[error]int{
+		errors.New("boom"):                                 orchestrator.ExitFailed,
+		agent.ErrMaxIterations:                             orchestrator.ExitMaxIterations,
+		fmt.Errorf("%w: looping", agent.ErrStalled):        orchestrator.ExitStalled,
+		fmt.Errorf("in loop: %w", agent.ErrBudgetExceeded): orchestrator.ExitBudgetExceeded,
+		agent.ErrActionBlocked:                             orchestrator.ExitActionBlocked,
+		agent.ErrQuotaExceeded:                             orchestrator.ExitQuotaExceeded,
+		agent.ErrGateFailed:                                orchestrator.ExitGateFailed,
+	}
+	for err, want := range cases {
+		if got := exitCode(err); got != want {
+			t.Errorf("exitCode(%v) = %d, want %d", err, got, want)
+		}
+	}
+}
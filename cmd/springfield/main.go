@@ -2,23 +2,32 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/shalomb/springfield/internal/agent"
 	"github.com/shalomb/springfield/internal/config"
 	"github.com/shalomb/springfield/internal/llm"
 	"github.com/shalomb/springfield/internal/orchestrator"
 	"github.com/shalomb/springfield/internal/sandbox"
+	"github.com/shalomb/springfield/internal/spend"
 	"github.com/shalomb/springfield/internal/testutils"
+	"github.com/shalomb/springfield/pkg/logger"
+	"github.com/shalomb/springfield/pkg/redact"
 	"github.com/spf13/cobra"
 )
 
 var (
 	agentName  string
 	task       string
+	epicID     string
 	configPath string
+	noCache    bool
 )
 
 var rootCmd = &cobra.Command{
@@ -30,23 +39,10 @@ var rootCmd = &cobra.Command{
 		if agentName == "" || task == "" {
 			return cmd.Help()
 		}
-
-		roles := map[string]string{
-			"marge":   "Product Agent",
-			"lisa":    "Planning Agent",
-			"ralph":   "Build Agent",
-			"bart":    "Quality Agent",
-			"lovejoy": "Release Agent",
-		}
-
-		role, ok := roles[strings.ToLower(agentName)]
-		if !ok {
-			role = "Assistant"
+		if epicID == "" {
+			epicID = os.Getenv("SPRINGFIELD_EPIC_ID")
 		}
 
-		fmt.Printf("Agent: %s (%s)\n", agentName, role)
-		fmt.Printf("Task: %s\n", task)
-
 		// Load config
 		cfg, err := config.LoadConfig(".")
 		if err != nil {
@@ -55,48 +51,158 @@ var rootCmd = &cobra.Command{
 
 		// Get agent-specific config (falls back to defaults if not configured)
 		agentCfg := cfg.GetAgentConfig(agentName)
+		if agentCfg.Role == "" {
+			return fmt.Errorf("unknown agent: %s (define it under [agents.%s] with a role)", agentName, strings.ToLower(agentName))
+		}
 
-		// Setup dependencies
-		var l llm.LLMClient
-		if os.Getenv("USE_MOCK_LLM") == "true" {
-			l = &testutils.MockLLM{}
-		} else {
-			primaryModel := agentCfg.PrimaryModel
-			if primaryModel == "" {
-				primaryModel = agentCfg.Model
-			}
-			primary := &llm.PiLLM{Model: primaryModel}
+		fmt.Printf("Agent: %s (%s)\n", agentName, agentCfg.Role)
+		fmt.Printf("Task: %s\n", task)
 
-			if agentCfg.FallbackModel != "" {
-				fallback := &llm.PiLLM{Model: agentCfg.FallbackModel}
-				l = &llm.FallbackLLM{Primary: primary, Fallback: fallback}
+		models := agentCfg.ModelChain()
+		var primaryModel string
+		if len(models) > 0 {
+			primaryModel = models[0]
+		}
+
+		// Refuse to start once a spend cap is reached.
+		ledger := spendLedger(cfg)
+		if err := ledger.Check(spendCaps(cfg), epicID, time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "🛑 %v\n", err)
+			return err
+		}
+
+		// Secrets must not reach the provider, the logs or persisted output.
+		var redactor *redact.Redactor
+		if cfg.Redaction.Enabled {
+			redactor, err = redact.New(cfg.Redaction.Patterns)
+			if err != nil {
+				return fmt.Errorf("error in redaction config: %w", err)
+			}
+		}
+		// newClient builds a model chain wrapped in the response cache and
+		// redaction. The cache sits inside redaction so its keys never hash
+		// raw secrets.
+		limiters := rateLimiters(cfg)
+		newClient := func(models []string) (llm.LLMClient, error) {
+			var l llm.LLMClient
+			var err error
+			if os.Getenv("USE_MOCK_LLM") == "true" {
+				l = &testutils.MockLLM{}
 			} else {
-				l = primary
+				l, err = newModelChain(agentCfg, models, limiters)
+				if err != nil {
+					return nil, fmt.Errorf("error in config for agent %s: %w", agentName, err)
+				}
+			}
+			if cfg.Cache.Enabled && !noCache {
+				l, err = newResponseCache(cfg.Cache, l, strings.Join(models, ","))
+				if err != nil {
+					return nil, fmt.Errorf("error in cache config: %w", err)
+				}
+			}
+			if redactor != nil {
+				l = &llm.RedactingLLM{Client: l, Redactor: redactor}
+			}
+			return l, nil
+		}
+
+		// Setup dependencies
+		l, err := newClient(models)
+		if err != nil {
+			return err
+		}
+		var escalation llm.LLMClient
+		if agentCfg.EscalationModel != "" {
+			if escalation, err = newClient([]string{agentCfg.EscalationModel}); err != nil {
+				return err
+			}
+		}
+		var critic llm.LLMClient
+		if agentCfg.CriticRubric != "" && agentCfg.CriticModel != "" {
+			if critic, err = newClient([]string{agentCfg.CriticModel}); err != nil {
+				return err
+			}
+		}
+		var judge llm.LLMClient
+		if agentCfg.Samples > 1 && agentCfg.JudgeModel != "" {
+			if judge, err = newClient([]string{agentCfg.JudgeModel}); err != nil {
+				return err
 			}
 		}
+		logger.Redactor = redactor
+
 		// Initialize sandbox
-		sandboxInst, err := sandbox.NewAxonSandbox(configPath)
+		axonSandbox, err := sandbox.NewAxonSandbox(configPath)
 		if err != nil {
 			return fmt.Errorf("error initializing sandbox: %w", err)
 		}
 
+		networkMode, err := sandbox.ParseNetworkMode(agentCfg.Network)
+		if err != nil {
+			return fmt.Errorf("error in config for agent %s: %w", agentName, err)
+		}
+		workdir := os.Getenv("SPRINGFIELD_WORKTREE")
+		if workdir == "" {
+			if workdir, err = os.Getwd(); err != nil {
+				return err
+			}
+		}
+		container := &sandbox.ContainerSandbox{
+			Runtime: cfg.Sandbox.ImageBuilder,
+			Image:   cfg.Sandbox.Image,
+			Workdir: workdir,
+			CPUs:    "0.5",
+			Memory:  "512m",
+		}
+		sandboxInst, err := sandbox.NewNetworkSandbox(context.Background(), axonSandbox, container,
+			sandbox.NetworkPolicy{Mode: networkMode, Allow: agentCfg.NetworkAllow})
+		if err != nil {
+			return fmt.Errorf("error initializing network policy: %w", err)
+		}
+		defer func() {
+			_ = sandboxInst.Close()
+		}()
+
 		ctx := context.Background()
 
+		approvalMode, err := agent.ParseApprovalMode(agentCfg.Approval)
+		if err != nil {
+			return fmt.Errorf("error in config for agent %s: %w", agentName, err)
+		}
+
+		retry, err := retryPolicy(agentCfg)
+		if err != nil {
+			return fmt.Errorf("error in config for agent %s: %w", agentName, err)
+		}
+
 		// Create a specialized runner based on the agent type, with budget and sandbox
-		runner, err := agent.NewRunnerWithBudget(agentName, task, l, sandboxInst, agentCfg.Budget)
+		runner, err := agent.NewRunnerFromConfig(agentName, task, l, sandboxInst, agentCfg,
+			agent.WithApproval(approvalMode, newApprover()),
+			agent.WithRedactor(redactor),
+			agent.WithPricing(primaryModel, pricingTable(cfg)),
+			agent.WithUsageHook(spendRecorder(ledger, strings.ToLower(agentName), epicID)),
+			agent.WithProgress(agent.NewProgress(os.Stderr)),
+			agent.WithRetryPolicy(retry),
+			agent.WithDecisions(allowedDecisions(), os.Getenv("SPRINGFIELD_DECISION_FILE")),
+			agent.WithEpic(epicID, os.Getenv("SPRINGFIELD_WORKTREE")),
+			agent.WithEscalation(agentCfg.EscalationModel, escalation),
+			agent.WithCritic(critic),
+			agent.WithJudge(judge))
 		if err != nil {
 			return fmt.Errorf("error creating runner for agent %s: %w", agentName, err)
 		}
 
 		fmt.Println("Starting agent loop...")
-		if err := runner.Run(ctx); err != nil {
+		err = runner.Run(ctx)
+		fmt.Fprintf(os.Stderr, "Run: %s\n", runner.Result())
+		if err != nil {
 			// Check for quota errors (terminal conditions)
-			if llm.IsQuotaExceededError(err) {
+			if errors.Is(err, agent.ErrQuotaExceeded) {
 				fmt.Fprintf(os.Stderr, "\n🛑 CRITICAL: API QUOTA EXCEEDED\n")
 				fmt.Fprintf(os.Stderr, "   %s\n", err.Error())
 				fmt.Fprintf(os.Stderr, "\n⚠️  Execution halted to preserve uncommitted changes.\n")
 				fmt.Fprintf(os.Stderr, "   Please resolve the quota issue and try again.\n\n")
-				return fmt.Errorf("quota exceeded - execution halted")
+				return fmt.Errorf("quota exceeded - execution halted: %w", err)
 			}
 
 			// Format other error messages more clearly
@@ -117,24 +223,340 @@ var orchestrateCmd = &cobra.Command{
 		fmt.Println("Orchestration loop starting...")
 		tdClient := orchestrator.NewTDClient("")
 		worktreeManager := &orchestrator.WorktreeManager{BaseDir: "."}
-		agentRunner := &orchestrator.CommandAgentRunner{BinaryPath: os.Args[0]}
+		approvalDir, err := filepath.Abs(approvalQueueDir())
+		if err != nil {
+			return err
+		}
+		cfg, err := config.LoadConfig(".")
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+		ledger := spendLedger(cfg)
+		ledgerPath, err := filepath.Abs(ledger.Path)
+		if err != nil {
+			return err
+		}
+		rateLimitDir, err := filepath.Abs(rateLimitStateDir())
+		if err != nil {
+			return err
+		}
+		agentRunner := &orchestrator.CommandAgentRunner{
+			BinaryPath:   os.Args[0],
+			ApprovalDir:  approvalDir,
+			SpendLedger:  ledgerPath,
+			RateLimitDir: rateLimitDir,
+		}
 		orch := orchestrator.NewOrchestrator(tdClient, agentRunner, worktreeManager)
+		orch.Spend = spend.Open(ledgerPath)
+		orch.Caps = spendCaps(cfg)
 
 		return orch.Tick()
 	},
 }
 
+var approvalsCmd = &cobra.Command{
+	Use:   "approvals",
+	Short: "List actions waiting for human approval",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		queue := &agent.FileApprover{Dir: approvalQueueDir()}
+		pending, err := queue.Pending()
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "No pending approvals.")
+			return nil
+		}
+		for _, req := range pending {
+			fmt.Fprintf(cmd.OutOrStdout(), "%s  %s  (%s)\n    %s\n", req.ID, req.Agent, req.Reason, req.Action)
+		}
+		return nil
+	},
+}
+
+var approveCmd = &cobra.Command{
+	Use:   "approve <id>",
+	Short: "Approve a pending agent action",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		queue := &agent.FileApprover{Dir: approvalQueueDir()}
+		return queue.Respond(args[0], agent.ApprovalDecision{Approved: true})
+	},
+}
+
+var denyReason string
+
+var denyCmd = &cobra.Command{
+	Use:   "deny <id>",
+	Short: "Deny a pending agent action",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		queue := &agent.FileApprover{Dir: approvalQueueDir()}
+		return queue.Respond(args[0], agent.ApprovalDecision{Approved: false, Reason: denyReason})
+	},
+}
+
+var spendCmd = &cobra.Command{
+	Use:   "spend",
+	Short: "Inspect recorded LLM spend",
+}
+
+var (
+	spendGroupBy string
+	spendDays    int
+)
+
+var spendReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Summarise tokens and cost from the spend ledger",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(".")
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+		entries, err := spendLedger(cfg).Entries()
+		if err != nil {
+			return err
+		}
+		var since time.Time
+		if spendDays > 0 {
+			y, m, d := time.Now().AddDate(0, 0, -(spendDays - 1)).Date()
+			since = time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+		}
+		rows, err := spend.Report(entries, spendGroupBy, since)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "%s\tRUNS\tCALLS\tTOKENS\tCOST\n", strings.ToUpper(spendGroupBy))
+		var total spend.ReportRow
+		for _, row := range rows {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t$%.4f\n", row.Key, row.Runs, row.Calls, row.TotalTokens, row.Cost)
+			total.Calls += row.Calls
+			total.TotalTokens += row.TotalTokens
+			total.Cost += row.Cost
+		}
+		fmt.Fprintf(w, "TOTAL\t\t%d\t%d\t$%.4f\n", total.Calls, total.TotalTokens, total.Cost)
+		return w.Flush()
+	},
+}
+
+// spendLedger returns the ledger shared by agents and the orchestrator. The
+// orchestrator hands its path to agents running in worktrees.
+func spendLedger(cfg *config.Config) *spend.Ledger {
+	if path := os.Getenv("SPRINGFIELD_SPEND_LEDGER"); path != "" {
+		return spend.Open(path)
+	}
+	return spend.Open(cfg.Spend.Ledger)
+}
+
+func spendCaps(cfg *config.Config) spend.Caps {
+	return spend.Caps{Daily: cfg.Spend.DailyCap, Weekly: cfg.Spend.WeeklyCap, PerEpic: cfg.Spend.EpicCap}
+}
+
+// spendRecorder returns a usage hook that appends every LLM call to the
+// ledger as it happens, so spend is kept even if the run dies part-way.
+func spendRecorder(ledger *spend.Ledger, agentName, epic string) agent.UsageHook {
+	runID := fmt.Sprintf("%s-%d", time.Now().Format("20060102T150405"), os.Getpid())
+	return func(model string, usage llm.TokenUsage, cost float64) {
+		err := ledger.Record(spend.Entry{
+			RunID:            runID,
+			Agent:            agentName,
+			Epic:             epic,
+			Model:            model,
+			PromptTokens:     usage.PromptTokens,
+			CompletionTokens: usage.CompletionTokens,
+			TotalTokens:      usage.TotalTokens,
+			CacheReadTokens:  usage.CacheReadTokens,
+			CacheWriteTokens: usage.CacheWriteTokens,
+			Cost:             cost,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  failed to record spend: %v\n", err)
+		}
+	}
+}
+
+// newModelChain builds the provider chain for an agent. Each model gets its
+// own circuit breaker so a dead provider is skipped rather than retried on
+// every turn. Models from a rate-limited provider wait on its limiter.
+func newModelChain(agentCfg config.AgentConfig, models []string, limiters map[string]*llm.RateLimiter) (llm.LLMClient, error) {
+	piMode, err := llm.ParsePiMode(agentCfg.PiMode)
+	if err != nil {
+		return nil, err
+	}
+	chain := &llm.ChainLLM{FailureThreshold: agentCfg.CircuitThreshold}
+	if agentCfg.CircuitCooldown != "" {
+		chain.Cooldown, err = time.ParseDuration(agentCfg.CircuitCooldown)
+		if err != nil {
+			return nil, fmt.Errorf("invalid circuit_cooldown: %w", err)
+		}
+	}
+	if len(models) == 0 {
+		models = []string{""} // let pi pick its default model
+	}
+	for _, model := range models {
+		client := llm.NewClient(model, piMode)
+		if limiter, ok := limiters[llm.Provider(model)]; ok {
+			client = &llm.RateLimitedLLM{Client: client, Limiter: limiter}
+		}
+		chain.Links = append(chain.Links, llm.ChainLink{Model: model, Client: client})
+	}
+	return chain, nil
+}
+
+// rateLimiters returns a limiter per configured provider. Their state is
+// shared through files so parallel agents draw on the same limits.
+func rateLimiters(cfg *config.Config) map[string]*llm.RateLimiter {
+	limiters := make(map[string]*llm.RateLimiter, len(cfg.RateLimits))
+	for provider, rl := range cfg.RateLimits {
+		limiters[provider] = &llm.RateLimiter{
+			Name:     provider,
+			Limit:    llm.RateLimit{RequestsPerMinute: rl.RPM, TokensPerMinute: rl.TPM, MaxInFlight: rl.MaxInFlight},
+			StateDir: rateLimitStateDir(),
+		}
+	}
+	return limiters
+}
+
+// rateLimitStateDir is where rate limiter state lives. The orchestrator hands
+// its directory to agents running in worktrees.
+func rateLimitStateDir() string {
+	if dir := os.Getenv("SPRINGFIELD_RATELIMIT_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(".springfield", "ratelimit")
+}
+
+// newResponseCache wraps l in the on-disk response cache, scoped to the
+// agent's configured models.
+func newResponseCache(cacheCfg config.CacheConfig, l llm.LLMClient, model string) (llm.LLMClient, error) {
+	cache := &llm.CachingLLM{
+		Client:   l,
+		Model:    model,
+		Dir:      cacheCfg.Dir,
+		MaxBytes: int64(cacheCfg.MaxMB) * 1024 * 1024,
+	}
+	if cacheCfg.TTL != "" {
+		ttl, err := time.ParseDuration(cacheCfg.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl: %w", err)
+		}
+		cache.TTL = ttl
+	}
+	return cache, nil
+}
+
+// retryPolicy builds the LLM retry policy from an agent's config, keeping the
+// defaults for anything unset.
+func retryPolicy(agentCfg config.AgentConfig) (llm.RetryPolicy, error) {
+	p := llm.DefaultRetryPolicy()
+	if agentCfg.MaxRetries != nil {
+		if *agentCfg.MaxRetries < 0 {
+			return p, fmt.Errorf("invalid max_retries %d", *agentCfg.MaxRetries)
+		}
+		p.MaxRetries = *agentCfg.MaxRetries
+	}
+	if agentCfg.RetryBaseDelay != "" {
+		d, err := time.ParseDuration(agentCfg.RetryBaseDelay)
+		if err != nil {
+			return p, fmt.Errorf("invalid retry_base_delay: %w", err)
+		}
+		p.BaseDelay = d
+	}
+	if agentCfg.RetryMaxDelay != "" {
+		d, err := time.ParseDuration(agentCfg.RetryMaxDelay)
+		if err != nil {
+			return p, fmt.Errorf("invalid retry_max_delay: %w", err)
+		}
+		p.MaxDelay = d
+	}
+	return p, nil
+}
+
+// pricingTable returns the built-in model prices with config overrides applied.
+func pricingTable(cfg *config.Config) llm.PricingTable {
+	overrides := make(llm.PricingTable, len(cfg.Pricing))
+	for model, p := range cfg.Pricing {
+		overrides[model] = llm.ModelPrice{Input: p.Input, Output: p.Output, CacheRead: p.CacheRead, CacheWrite: p.CacheWrite}
+	}
+	return llm.DefaultPricing().WithOverrides(overrides)
+}
+
+// approvalQueueDir returns the directory used for the file-based approval queue.
+func approvalQueueDir() string {
+	if dir := os.Getenv("SPRINGFIELD_APPROVAL_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(".springfield", "approvals")
+}
+
+// allowedDecisions returns the decisions the orchestrator accepts from this
+// run, passed as a comma-separated list.
+func allowedDecisions() []string {
+	var allowed []string
+	for _, d := range strings.Split(os.Getenv("SPRINGFIELD_ALLOWED_DECISIONS"), ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			allowed = append(allowed, d)
+		}
+	}
+	return allowed
+}
+
+// newApprover picks how humans are asked to confirm actions: the file queue
+// when running under the orchestrator, otherwise the terminal if there is one.
+// A nil Approver denies every action that needs approval.
+func newApprover() agent.Approver {
+	if dir := os.Getenv("SPRINGFIELD_APPROVAL_DIR"); dir != "" {
+		return &agent.FileApprover{Dir: dir}
+	}
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		return &agent.TTYApprover{In: os.Stdin, Out: os.Stderr}
+	}
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(orchestrateCmd)
+	rootCmd.AddCommand(approvalsCmd, approveCmd, denyCmd)
+	rootCmd.AddCommand(spendCmd)
+	spendCmd.AddCommand(spendReportCmd)
+	spendReportCmd.Flags().StringVarP(&spendGroupBy, "group-by", "g", "agent", "Group by "+strings.Join(spend.GroupByKeys, ", "))
+	spendReportCmd.Flags().IntVar(&spendDays, "days", 0, "Only include the last N days (0 = all time)")
+	denyCmd.Flags().StringVarP(&denyReason, "reason", "r", "", "Reason passed back to the agent")
 	rootCmd.Flags().StringVarP(&agentName, "agent", "a", "", "Name of the agent (marge/lisa/ralph/bart/lovejoy)")
 	rootCmd.Flags().StringVarP(&task, "task", "t", "", "Task to execute")
+	rootCmd.Flags().StringVarP(&epicID, "epic", "e", "", "Epic the task belongs to, for spend accounting and caps")
 	rootCmd.Flags().StringVarP(&configPath, "config", "c", "", "Path to axon config.toml")
+	rootCmd.Flags().BoolVar(&noCache, "no-cache", false, "Bypass the LLM response cache")
 }
 
 func main() {
 	if err := runMain(); err != nil {
 		// Don't print error here - it's already printed in the RunE function
-		os.Exit(1)
+		os.Exit(exitCode(err))
+	}
+}
+
+// exitCode tells the orchestrator why an agent run failed, so it can route
+// the epic accordingly.
+func exitCode(err error) int {
+	switch agent.ReasonFor(err) {
+	case agent.FinishMaxIterations:
+		return orchestrator.ExitMaxIterations
+	case agent.FinishStalled:
+		return orchestrator.ExitStalled
+	case agent.FinishBudgetExceeded:
+		return orchestrator.ExitBudgetExceeded
+	case agent.FinishActionBlocked:
+		return orchestrator.ExitActionBlocked
+	case agent.FinishQuotaExceeded:
+		return orchestrator.ExitQuotaExceeded
+	case agent.FinishGateFailed:
+		return orchestrator.ExitGateFailed
+	default:
+		return orchestrator.ExitFailed
 	}
 }
 
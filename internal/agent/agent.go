@@ -6,11 +6,15 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/shalomb/axon/pkg/types"
+	"github.com/shalomb/springfield/internal/config"
+	"github.com/shalomb/springfield/internal/decision"
 	"github.com/shalomb/springfield/internal/llm"
 	"github.com/shalomb/springfield/internal/sandbox"
 	"github.com/shalomb/springfield/pkg/logger"
+	"github.com/shalomb/springfield/pkg/redact"
 )
 
 const FinishMarker = "[[FINISH]]"
@@ -18,6 +22,8 @@ const FinishMarker = "[[FINISH]]"
 // Runner defines the interface for agent runners.
 type Runner interface {
 	Run(ctx context.Context) error
+	// Result reports how the last run went.
+	Result() RunResult
 }
 
 // AgentProfile defines the personality and behavior constraints for an agent.
@@ -26,24 +32,74 @@ type AgentProfile struct {
 	Role          string
 	SystemPrompt  string
 	ContextFiles  []string
-	OutputTarget  string
-	ToolsEnabled  []string
-	FinishMarker  string
+	ContextBudget int // Bytes of context files; 0 uses DefaultContextBudget
+	// ContextProviders add generated context, e.g. a git summary.
+	ContextProviders []ContextProvider
+	OutputTarget     string
+	ToolsEnabled     []string
+	Tools            []Tool // The enabled tools, built from ToolsEnabled
+	FinishMarker     string
+	// FinishGates are commands that must pass in the sandbox before a finish
+	// is accepted, for at most FinishGateAttempts failing finishes.
+	FinishGates        []string
+	FinishGateAttempts int
+	// Critic, if set, reviews the final output before it is accepted.
+	Critic *Critic
+	// Sampling, if set, runs an agent with an OutputTarget best-of-N.
+	Sampling      *Sampling
 	MaxIterations int
+	Approval      ApprovalMode
 }
 
 // Agent represents an autonomous agent.
 type Agent struct {
 	Profile       AgentProfile
 	Task          string
+	Epic          string // Epic the task belongs to, recorded on every log entry
+	Worktree      string // Worktree the orchestrator runs the agent in, if any
+	PromptData    config.PromptData
 	LLM           llm.LLMClient
 	Sandbox       sandbox.Sandbox
-	MaxRetries    int
+	ActionRetries int             // Retries of an action whose sandbox execution fails
+	RetryPolicy   llm.RetryPolicy // Retries and backoff for LLM calls
 	MaxIterations int
 	Budget        int // Max tokens per session (0 = unlimited)
 	TotalUsage    int // Track total tokens used
+	TotalCost     float64
+	Model         string           // Configured model, used for pricing when a response doesn't name one
+	Pricing       llm.PricingTable // Per-model prices used for cost accounting
+	UsageByModel  map[string]ModelUsage
+	Approval      ApprovalMode
+	Approver      Approver // nil denies any action that needs approval
+	Redactor      *redact.Redactor
+	OnUsage       UsageHook   // Called after every LLM response, e.g. to record spend
+	Progress      Progress    // Renders streaming LLM output; nil disables it
+	StallPolicy   StallPolicy // Zero disables stall detection
+	// EscalationLLM serves EscalationModel, which a stall can switch to.
+	EscalationLLM   llm.LLMClient
+	EscalationModel string
+	// AllowedDecisions are the signals the agent may finish with. When set,
+	// a finish without a valid <decision> block is sent back to the model.
+	AllowedDecisions []string
+	DecisionFile     string             // Where the decision is written for the orchestrator
+	Decision         *decision.Decision // Set once the agent finishes with a valid decision
+	result           RunResult
+	gateFailures     int
+	critiques        int
+	output           string // The final output of the last run
+	readOnly         bool   // Only read-only actions and tools may run
 }
 
+// ModelUsage accumulates the LLM usage attributed to one model in a session.
+type ModelUsage struct {
+	Calls      int
+	TokenUsage llm.TokenUsage
+	Cost       float64
+}
+
+// UsageHook receives the usage and cost of each LLM response as it arrives.
+type UsageHook func(model string, usage llm.TokenUsage, cost float64)
+
 // New creates a new Agent with default settings.
 func New(profile AgentProfile, l llm.LLMClient, s sandbox.Sandbox) *Agent {
 	maxIterations := profile.MaxIterations
@@ -54,27 +110,52 @@ func New(profile AgentProfile, l llm.LLMClient, s sandbox.Sandbox) *Agent {
 		Profile:       profile,
 		LLM:           l,
 		Sandbox:       s,
-		MaxRetries:    3,
+		ActionRetries: 3,
+		RetryPolicy:   llm.DefaultRetryPolicy(),
 		MaxIterations: maxIterations,
+		Approval:      profile.Approval,
+		Redactor:      redact.Default(),
+		Pricing:       llm.DefaultPricing(),
+		UsageByModel:  make(map[string]ModelUsage),
 	}
 }
 
 func (a *Agent) log(message, level string, tokenUsage interface{}, cost float64) {
-	if err := logger.Log(message, level, a.Profile.Name, "", "", tokenUsage, cost, nil); err != nil {
+	a.logData(message, level, tokenUsage, cost, nil)
+}
+
+func (a *Agent) logData(message, level string, tokenUsage interface{}, cost float64, data map[string]interface{}) {
+	if err := logger.Log(message, level, a.Profile.Name, a.Epic, "", tokenUsage, cost, data); err != nil {
 		fmt.Fprintf(os.Stderr, "CRITICAL: Logger failed: %v\nMessage was: %s\n", err, message)
 	}
 }
 
 // Run executes the agent's task.
-// It implements the Runner interface.
-func (a *Agent) Run(ctx context.Context) error {
+// It implements the Runner interface. Errors it ends with can be matched
+// against ErrMaxIterations, ErrBudgetExceeded, ErrStalled, ErrActionBlocked
+// and ErrQuotaExceeded; Result describes the run either way.
+func (a *Agent) Run(ctx context.Context) (err error) {
 	task := a.Task
-	a.log(fmt.Sprintf("Starting task: %s", task), "INFO", nil, 0)
+	var startData map[string]interface{}
+	if a.Worktree != "" {
+		startData = map[string]interface{}{"worktree": a.Worktree}
+	}
+	a.logData(fmt.Sprintf("Starting task: %s", task), "INFO", nil, 0, startData)
+	defer a.logSessionSummary()
+	a.result = RunResult{}
+	a.gateFailures, a.critiques, a.output = 0, 0, ""
+	defer func() { a.finishRun(err) }()
+	if a.sampling() {
+		return a.runBestOfN(ctx)
+	}
 
 	systemPrompt := a.Profile.SystemPrompt
 	if systemPrompt == "" {
 		systemPrompt = fmt.Sprintf("You are %s, a %s.", a.Profile.Name, a.Profile.Role)
 	}
+	if len(a.Profile.Tools) > 0 {
+		systemPrompt += toolsPrompt(a.Profile.Tools)
+	}
 
 	messages := []llm.Message{
 		{Role: "system", Content: systemPrompt},
@@ -87,85 +168,164 @@ func (a *Agent) Run(ctx context.Context) error {
 			messages = append(messages, llm.Message{Role: "user", Content: fileContext})
 		}
 	}
+	for _, provider := range a.Profile.ContextProviders {
+		content, err := provider.Context(ctx, a.workDir())
+		if err != nil {
+			a.log(fmt.Sprintf("Warning: %s context unavailable: %v", provider.Name(), err), "WARNING", nil, 0)
+			continue
+		}
+		a.log(fmt.Sprintf("Context: %d bytes from %s", len(content), provider.Name()), "INFO", nil, 0)
+		messages = append(messages, llm.Message{Role: "user", Content: content})
+	}
 
 	messages = append(messages, llm.Message{Role: "user", Content: task})
 
+	stalls := &stallDetector{policy: a.StallPolicy}
+	blocked := 0
 	for iteration := 0; iteration < a.MaxIterations; iteration++ {
-		var resp llm.Response
-		var err error
-		for i := 0; i <= a.MaxRetries; i++ {
-			resp, err = a.LLM.Chat(ctx, messages)
-			if err == nil {
-				break
-			}
-			a.log(fmt.Sprintf("LLM error (attempt %d/%d): %v", i+1, a.MaxRetries+1, err), "WARNING", nil, 0)
-			if i == a.MaxRetries {
-				a.log("Max retries reached for LLM call.", "ERROR", nil, 0)
-				return err
+		a.result.Iterations = iteration + 1
+		resp, err := a.chatWithRetry(ctx, a.LLM, messages, fmt.Sprintf("[%s #%d]", a.Profile.Name, iteration+1))
+		if err != nil {
+			if class, _ := llm.ClassifyError(err); class == llm.ErrorQuota {
+				return quotaError{err}
 			}
+			return err
 		}
 
-		a.TotalUsage += resp.TokenUsage.TotalTokens
+		model, cost := a.recordUsage(resp)
+		if a.Model != "" && model != a.Model && !strings.HasSuffix(model, "/"+a.Model) {
+			a.logData(fmt.Sprintf("Turn %d served by %s instead of %s", iteration+1, model, a.Model), "INFO", nil, 0,
+				map[string]interface{}{"model": model})
+		}
 		if a.Budget > 0 && a.TotalUsage > a.Budget {
 			a.log(fmt.Sprintf("Budget exceeded: %d > %d", a.TotalUsage, a.Budget), "ERROR", nil, 0)
-			return fmt.Errorf("session budget exceeded: %d tokens used", a.TotalUsage)
+			return fmt.Errorf("%w: %d tokens used", ErrBudgetExceeded, a.TotalUsage)
 		}
 
-		cost := a.calculateCost(resp.TokenUsage)
-
 		// Extract thought if present
 		thought := extractThought(resp.Content)
 		if thought != "" {
 			a.log(fmt.Sprintf("Thought: %s", thought), "INFO", nil, 0)
 		}
 
-		a.log(fmt.Sprintf("LLM response: %s", resp.Content), "DEBUG", resp.TokenUsage, cost)
+		respData := map[string]interface{}{"model": model}
+		if resp.Cached {
+			respData["cached"] = true
+		}
+		a.logData(fmt.Sprintf("LLM response: %s", resp.Content), "DEBUG", resp.TokenUsage, cost, respData)
 		messages = append(messages, llm.Message{Role: "assistant", Content: resp.Content})
 
 		if a.isFinished(resp.Content) {
+			feedback, err := a.runFinishGates(ctx)
+			if err != nil {
+				return err
+			}
+			if feedback != "" {
+				messages = append(messages, llm.Message{Role: "user", Content: feedback})
+				continue
+			}
+			if a.Profile.Critic != nil {
+				feedback, err := a.critique(ctx, a.finalOutput(resp.Content))
+				if err != nil {
+					return err
+				}
+				if feedback != "" {
+					messages = append(messages, llm.Message{Role: "user", Content: feedback})
+					continue
+				}
+			}
+			if len(a.AllowedDecisions) > 0 {
+				if feedback, ok := a.acceptDecision(resp.Content); !ok {
+					messages = append(messages, llm.Message{Role: "user", Content: feedback})
+					continue
+				}
+			}
 			a.log("Task complete.", "INFO", nil, 0)
+			a.output = a.finalOutput(resp.Content)
 
 			// Persist output if target is specified
 			if a.Profile.OutputTarget != "" {
-				// Clean up tags from final response if present
-				cleanContent := resp.Content
-				if thought != "" {
-					cleanContent = strings.Replace(cleanContent, fmt.Sprintf("<thought>%s</thought>", thought), "", 1)
-				}
-				// We also want to strip thought tags entirely if they are in different formatting
-				cleanContent = thoughtTagRegex.ReplaceAllString(cleanContent, "")
-
-				if err := a.persistOutput(cleanContent); err != nil {
+				if err := a.persistOutput(a.output); err != nil {
 					a.log(fmt.Sprintf("Error persisting output to %s: %v", a.Profile.OutputTarget, err), "ERROR", nil, 0)
 					return err
 				}
+				a.result.OutputWritten = a.Profile.OutputTarget
 			}
 			return nil
 		}
 
-		// Improved action extraction
+		name, args, isTool := extractToolCall(resp.Content)
 		action := extractAction(resp.Content)
+		taken := action
+		if isTool {
+			taken = fmt.Sprintf("tool %s %s", name, args)
+		}
+		if s, stalled := stalls.observe(resp.Content, taken); stalled {
+			nudge, err := a.handleStall(stalls, s)
+			if err != nil {
+				return err
+			}
+			messages = append(messages, llm.Message{Role: "user", Content: nudge})
+			continue
+		}
+
+		if isTool {
+			a.result.ToolCalls++
+			result, err := a.callTool(ctx, name, args)
+			if err != nil {
+				return err
+			}
+			messages = append(messages, llm.Message{Role: "user", Content: result})
+			continue
+		}
+
+		// Improved action extraction
 		if action != "" {
 			if isUnsafeAction(action) {
 				a.log(fmt.Sprintf("Blocked unsafe action: %s", action), "ERROR", nil, 0)
+				if blocked++; blocked >= maxBlockedActions {
+					return fmt.Errorf("%w: %d actions in a row were blocked or denied", ErrActionBlocked, blocked)
+				}
 				messages = append(messages, llm.Message{Role: "user", Content: "Action blocked for security reasons."})
 				continue
 			}
+			if a.readOnly && !isReadOnlyAction(action) {
+				a.log(fmt.Sprintf("Blocked action that may write: %s", action), "WARNING", nil, 0)
+				if blocked++; blocked >= maxBlockedActions {
+					return fmt.Errorf("%w: %d actions in a row were blocked or denied", ErrActionBlocked, blocked)
+				}
+				messages = append(messages, llm.Message{Role: "user", Content: readOnlyFeedback})
+				continue
+			}
+
+			approved, feedback, err := a.approve(ctx, action)
+			if err != nil {
+				return err
+			}
+			if !approved {
+				if blocked++; blocked >= maxBlockedActions {
+					return fmt.Errorf("%w: %d actions in a row were blocked or denied", ErrActionBlocked, blocked)
+				}
+				messages = append(messages, llm.Message{Role: "user", Content: feedback})
+				continue
+			}
+			blocked = 0
 
 			a.log(fmt.Sprintf("Executing action: %s", action), "INFO", nil, 0)
 			var result *types.Result
-			for i := 0; i <= a.MaxRetries; i++ {
+			for i := 0; i <= a.ActionRetries; i++ {
 				result, err = a.Sandbox.Execute(ctx, action)
 				if err == nil {
 					break
 				}
-				a.log(fmt.Sprintf("Sandbox error (attempt %d/%d): %v", i+1, a.MaxRetries+1, err), "WARNING", nil, 0)
-				if i == a.MaxRetries {
+				a.log(fmt.Sprintf("Sandbox error (attempt %d/%d): %v", i+1, a.ActionRetries+1, err), "WARNING", nil, 0)
+				if i == a.ActionRetries {
 					a.log("Max retries reached for Sandbox execution.", "ERROR", nil, 0)
 					return err
 				}
 			}
 
+			a.result.ActionsExecuted++
 			resultStr := fmt.Sprintf("STDOUT: %s\nSTDERR: %s\nEXIT CODE: %d", result.Stdout, result.Stderr, result.ExitCode)
 			if ctxInfo := formatContext(result.Context); ctxInfo != "" {
 				resultStr += "\nSANDBOX CONTEXT: " + ctxInfo
@@ -179,52 +339,181 @@ func (a *Agent) Run(ctx context.Context) error {
 		}
 	}
 
-	return fmt.Errorf("max iterations reached")
+	return ErrMaxIterations
+}
+
+// chatWithRetry calls an LLM under the agent's retry policy. Quota, auth and
+// context-length errors are returned at once since retrying them only burns
+// quota.
+func (a *Agent) chatWithRetry(ctx context.Context, client llm.LLMClient, messages []llm.Message, label string) (llm.Response, error) {
+	var resp llm.Response
+	err := a.RetryPolicy.Do(ctx, func() error {
+		var err error
+		resp, err = a.chat(ctx, client, messages, label)
+		return err
+	}, func(attempt int, err error, class llm.ErrorClass, delay time.Duration) {
+		a.log(fmt.Sprintf("LLM error (attempt %d/%d, %s): %v; retrying in %s",
+			attempt, a.RetryPolicy.MaxRetries+1, class, err, delay.Round(time.Millisecond)), "WARNING", nil, 0)
+	})
+	if err != nil {
+		class, _ := llm.ClassifyError(err)
+		if class.Retriable() {
+			a.log("Max retries reached for LLM call.", "ERROR", nil, 0)
+		} else {
+			a.log(fmt.Sprintf("LLM error is not retriable (%s): %v", class, err), "ERROR", nil, 0)
+		}
+	}
+	return resp, err
+}
+
+// chat sends the conversation to an LLM, streaming progress under label when
+// a renderer is configured.
+func (a *Agent) chat(ctx context.Context, client llm.LLMClient, messages []llm.Message, label string) (llm.Response, error) {
+	if a.Progress == nil {
+		return client.Chat(ctx, messages)
+	}
+	a.Progress.Start(label)
+	resp, err := llm.ChatWithStream(ctx, client, messages, a.Progress.Event)
+	if err != nil {
+		a.Progress.Done("failed")
+	} else if resp.Cached {
+		a.Progress.Done("cached")
+	} else {
+		a.Progress.Done(fmt.Sprintf("%d tokens", resp.TokenUsage.TotalTokens))
+	}
+	return resp, err
+}
+
+// recordUsage attributes a response's token usage and cost to the model that
+// served it and returns both.
+func (a *Agent) recordUsage(resp llm.Response) (string, float64) {
+	model := resp.Model
+	if model == "" {
+		model = a.Model
+	}
+	cost := a.calculateCost(model, resp.TokenUsage)
+
+	a.TotalUsage += resp.TokenUsage.TotalTokens
+	a.TotalCost += cost
+
+	if a.UsageByModel == nil {
+		a.UsageByModel = make(map[string]ModelUsage)
+	}
+	u := a.UsageByModel[model]
+	u.Calls++
+	u.TokenUsage.PromptTokens += resp.TokenUsage.PromptTokens
+	u.TokenUsage.CompletionTokens += resp.TokenUsage.CompletionTokens
+	u.TokenUsage.TotalTokens += resp.TokenUsage.TotalTokens
+	u.TokenUsage.CacheReadTokens += resp.TokenUsage.CacheReadTokens
+	u.TokenUsage.CacheWriteTokens += resp.TokenUsage.CacheWriteTokens
+	u.Cost += cost
+	a.UsageByModel[model] = u
+
+	if a.OnUsage != nil {
+		a.OnUsage(model, resp.TokenUsage, cost)
+	}
+
+	return model, cost
 }
 
-func (a *Agent) calculateCost(usage llm.TokenUsage) float64 {
-	// Simple cost calculation. In the future this should be based on the model from config.
-	// Prices per 1M tokens.
-	const promptPrice = 0.075 / 1000000.0    // $0.075 / 1M
-	const completionPrice = 0.30 / 1000000.0 // $0.30 / 1M
-	return float64(usage.PromptTokens)*promptPrice + float64(usage.CompletionTokens)*completionPrice
+func (a *Agent) calculateCost(model string, usage llm.TokenUsage) float64 {
+	pricing := a.Pricing
+	if pricing == nil {
+		pricing = llm.DefaultPricing()
+	}
+	if _, ok := pricing.Lookup(model); !ok && usage.TotalTokens > 0 {
+		a.log(fmt.Sprintf("No pricing for model %q; charging the unknown-model rate", model), "WARNING", nil, 0)
+	}
+	return pricing.Cost(model, usage)
+}
+
+// logSessionSummary records the session's total tokens and cost, broken down
+// by the models that served it.
+func (a *Agent) logSessionSummary() {
+	byModel := make(map[string]interface{}, len(a.UsageByModel))
+	for model, u := range a.UsageByModel {
+		byModel[model] = map[string]interface{}{
+			"calls":       u.Calls,
+			"token_usage": u.TokenUsage,
+			"cost":        u.Cost,
+		}
+	}
+	a.logData(fmt.Sprintf("Session summary: %d tokens, $%.4f", a.TotalUsage, a.TotalCost), "INFO",
+		map[string]int{"total_tokens": a.TotalUsage}, a.TotalCost,
+		map[string]interface{}{"models": byModel})
+}
+
+// acceptDecision parses and validates the decision in a finishing response,
+// recording it if valid. Otherwise it returns feedback asking the model to
+// finish again.
+func (a *Agent) acceptDecision(resp string) (string, bool) {
+	d, err := decision.Parse(resp)
+	if err == nil {
+		err = d.Validate(a.AllowedDecisions)
+	}
+	if err != nil {
+		a.log(fmt.Sprintf("Finish rejected: %v", err), "WARNING", nil, 0)
+		return fmt.Sprintf("Your finish was not accepted: %v. Finish again with "+
+			`<decision>{"decision": "...", "summary": "...", "artefacts": []}</decision>`+
+			" before %s. Allowed decisions: %s.", err, a.finishMarker(), strings.Join(a.AllowedDecisions, ", ")), false
+	}
+
+	a.Decision = d
+	a.logData(fmt.Sprintf("Decision: %s", d.Decision), "INFO", nil, 0,
+		map[string]interface{}{"decision": d.Decision, "summary": d.Summary})
+	if a.DecisionFile != "" {
+		if err := decision.Write(a.DecisionFile, d); err != nil {
+			a.log(fmt.Sprintf("Error writing decision to %s: %v", a.DecisionFile, err), "ERROR", nil, 0)
+		}
+	}
+	return "", true
 }
 
 func (a *Agent) persistOutput(content string) error {
 	// Strip finish marker
-	marker := a.Profile.FinishMarker
-	if marker == "" {
-		marker = FinishMarker
-	}
-	content = strings.Replace(content, marker, "", -1)
+	content = strings.Replace(content, a.finishMarker(), "", -1)
 	content = strings.TrimSpace(content)
+	content = a.Redactor.Redact(content)
 
 	a.log(fmt.Sprintf("Persisting output to %s", a.Profile.OutputTarget), "INFO", nil, 0)
 	return os.WriteFile(a.Profile.OutputTarget, []byte(content), 0644)
 }
 
-func (a *Agent) loadFilesContext() string {
-	var parts []string
-	for _, file := range a.Profile.ContextFiles {
-		content, err := os.ReadFile(file)
-		if err != nil {
-			a.log(fmt.Sprintf("Warning: Could not read context file %s: %v", file, err), "WARNING", nil, 0)
-			continue
-		}
-		parts = append(parts, fmt.Sprintf("FILE: %s\nCONTENT:\n%s\n---", file, string(content)))
+// workDir is where context is gathered from: the agent's worktree, or the
+// current directory outside one.
+func (a *Agent) workDir() string {
+	if a.Worktree != "" {
+		return a.Worktree
 	}
-	if len(parts) == 0 {
-		return ""
+	return "."
+}
+
+// loadFilesContext loads the profile's context files within its budget and
+// logs a manifest of what was included, truncated or left out.
+func (a *Agent) loadFilesContext() string {
+	content, manifest := LoadContextFiles(a.workDir(), a.Profile.ContextFiles, a.Profile.ContextBudget)
+	for _, skipped := range manifest.Skipped {
+		a.log(fmt.Sprintf("Warning: Could not load context %s", skipped), "WARNING", nil, 0)
 	}
-	return "CURRENT CONTEXT FILES:\n\n" + strings.Join(parts, "\n\n")
+	a.logData(fmt.Sprintf("Context: %d files included, %d truncated, %d skipped (%d of %d bytes)",
+		len(manifest.Included), len(manifest.Truncated), len(manifest.Skipped), manifest.Bytes, manifest.Budget),
+		"INFO", nil, 0, map[string]interface{}{
+			"included":  manifest.Included,
+			"truncated": manifest.Truncated,
+			"skipped":   manifest.Skipped,
+		})
+	return content
 }
 
 func (a *Agent) isFinished(resp string) bool {
-	marker := a.Profile.FinishMarker
-	if marker == "" {
-		marker = FinishMarker
+	return strings.HasSuffix(strings.TrimSpace(resp), a.finishMarker())
+}
+
+func (a *Agent) finishMarker() string {
+	if a.Profile.FinishMarker != "" {
+		return a.Profile.FinishMarker
 	}
-	return strings.HasSuffix(strings.TrimSpace(resp), marker)
+	return FinishMarker
 }
 
 func formatContext(c types.ContextMetadata) string {
@@ -411,6 +411,27 @@ func TestAgent_Run_LLMRetry(t *testing.T) {
 	}
 }
 
+func TestAgent_Run_LLMRetriesDisabled(t *testing.T) {
+	mLLM := &mockLLM{
+		errors:    []error{errors.New("transient"), nil},
+		responses: []string{"", "[[FINISH]]"},
+	}
+	mSB := &mockSandbox{results: []*types.Result{{Stdout: "ok"}}}
+	a := New(AgentProfile{Name: "agent", Role: "role"}, mLLM, mSB)
+	a.Task = "task"
+	WithRetryPolicy(llm.RetryPolicy{MaxRetries: 0})(a)
+
+	if err := a.Run(context.Background()); err == nil {
+		t.Fatal("expected the first LLM error to end the run")
+	}
+	if mLLM.calls != 1 {
+		t.Errorf("LLM calls = %d, want 1 (no retries)", mLLM.calls)
+	}
+	if a.ActionRetries != 3 {
+		t.Errorf("the LLM retry policy changed action retries to %d", a.ActionRetries)
+	}
+}
+
 func TestAgent_Run_LLMMaxRetriesReached(t *testing.T) {
 	mLLM := &mockLLM{errors: []error{
 		errors.New("e1"), errors.New("e2"), errors.New("e3"), errors.New("e4"),
@@ -418,7 +439,7 @@ func TestAgent_Run_LLMMaxRetriesReached(t *testing.T) {
 	mSB := &mockSandbox{}
 	a := New(AgentProfile{Name: "agent", Role: "role"}, mLLM, mSB)
 	a.Task = "task"
-	a.MaxRetries = 2 // 3 total attempts
+	a.RetryPolicy.MaxRetries = 2 // 3 total attempts
 
 	err := a.Run(context.Background())
 	if err == nil {
@@ -478,3 +499,20 @@ func TestIsUnsafeAction(t *testing.T) {
 		}
 	}
 }
+
+func TestAgent_Run_LLMQuotaFailsFast(t *testing.T) {
+	mLLM := &mockLLM{errors: []error{
+		&llm.QuotaExceededError{Message: "You have exhausted your capacity on this model"},
+		nil,
+	}, responses: []string{"", "[[FINISH]]"}}
+	a := New(AgentProfile{Name: "agent", Role: "role"}, mLLM, &mockSandbox{})
+	a.Task = "task"
+
+	err := a.Run(context.Background())
+	if !llm.IsQuotaExceededError(err) {
+		t.Fatalf("expected quota error, got %v", err)
+	}
+	if mLLM.calls != 1 {
+		t.Errorf("LLM calls = %d, want 1 (quota errors are not retried)", mLLM.calls)
+	}
+}
@@ -0,0 +1,303 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ApprovalMode controls when a human must confirm an action before it runs.
+type ApprovalMode string
+
+const (
+	// ApprovalNever runs every permitted action without asking.
+	ApprovalNever ApprovalMode = "never"
+	// ApprovalRisky asks only for actions the policy classifies as risky.
+	ApprovalRisky ApprovalMode = "risky"
+	// ApprovalAlways asks before every action.
+	ApprovalAlways ApprovalMode = "always"
+)
+
+// ParseApprovalMode converts a configuration value into an ApprovalMode.
+// An empty string maps to ApprovalNever.
+func ParseApprovalMode(s string) (ApprovalMode, error) {
+	switch mode := ApprovalMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case "":
+		return ApprovalNever, nil
+	case ApprovalNever, ApprovalRisky, ApprovalAlways:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown approval mode %q (want never, risky or always)", s)
+}
+
+func (m ApprovalMode) strictness() int {
+	switch m {
+	case ApprovalRisky:
+		return 1
+	case ApprovalAlways:
+		return 2
+	}
+	return 0
+}
+
+// ApprovalRequest describes an action awaiting human confirmation.
+type ApprovalRequest struct {
+	ID        string `json:"id"`
+	Agent     string `json:"agent"`
+	Action    string `json:"action"`
+	Reason    string `json:"reason"`
+	Timestamp string `json:"timestamp"`
+}
+
+// ApprovalDecision is the human's answer to an ApprovalRequest.
+type ApprovalDecision struct {
+	Approved bool   `json:"approved"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Approver asks a human to confirm an action.
+type Approver interface {
+	Approve(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error)
+}
+
+// TTYApprover prompts on an interactive terminal. A single goroutine reads In
+// for the approver's lifetime, so an answer typed after a cancelled prompt
+// goes to the next one rather than to an abandoned reader.
+type TTYApprover struct {
+	In  io.Reader
+	Out io.Writer
+
+	once    sync.Once
+	answers chan string
+}
+
+// Approve prints the request and waits for a y/N answer.
+func (t *TTYApprover) Approve(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+	t.once.Do(t.readAnswers)
+	_, _ = fmt.Fprintf(t.Out, "\n⚠️  %s wants to run an action that %s:\n    %s\nApprove? [y/N] ", req.Agent, req.Reason, req.Action)
+
+	select {
+	case <-ctx.Done():
+		return ApprovalDecision{}, ctx.Err()
+	case a, ok := <-t.answers:
+		if !ok {
+			return ApprovalDecision{Approved: false, Reason: "no answer: the terminal was closed"}, nil
+		}
+		if a == "y" || a == "yes" {
+			return ApprovalDecision{Approved: true}, nil
+		}
+		return ApprovalDecision{Approved: false, Reason: "denied at the terminal"}, nil
+	}
+}
+
+// readAnswers starts the goroutine that reads In a line at a time until it
+// ends.
+func (t *TTYApprover) readAnswers() {
+	t.answers = make(chan string)
+	go func() {
+		defer close(t.answers)
+		scanner := bufio.NewScanner(t.In)
+		for scanner.Scan() {
+			t.answers <- strings.ToLower(strings.TrimSpace(scanner.Text()))
+		}
+	}()
+}
+
+// FileApprover implements a file-based approval queue for agents that run
+// without a terminal (e.g. under the orchestrator). Each request is written to
+// Dir as <id>.request.json and the agent waits until a matching
+// <id>.response.json appears, written by `springfield approve` or `deny`.
+type FileApprover struct {
+	Dir          string
+	PollInterval time.Duration
+	Timeout      time.Duration // 0 waits until the context is cancelled
+}
+
+// Approve enqueues the request and blocks until it is answered.
+func (f *FileApprover) Approve(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+	if err := os.MkdirAll(f.Dir, 0755); err != nil {
+		return ApprovalDecision{}, fmt.Errorf("failed to create approval queue %s: %w", f.Dir, err)
+	}
+	if req.ID == "" {
+		req.ID = newApprovalID()
+	}
+
+	data, err := json.MarshalIndent(req, "", "  ")
+	if err != nil {
+		return ApprovalDecision{}, fmt.Errorf("failed to marshal approval request: %w", err)
+	}
+	requestPath := filepath.Join(f.Dir, req.ID+".request.json")
+	if err := os.WriteFile(requestPath, data, 0644); err != nil {
+		return ApprovalDecision{}, fmt.Errorf("failed to enqueue approval request: %w", err)
+	}
+	defer os.Remove(requestPath)
+
+	interval := f.PollInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var deadline <-chan time.Time
+	if f.Timeout > 0 {
+		timer := time.NewTimer(f.Timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	responsePath := filepath.Join(f.Dir, req.ID+".response.json")
+	for {
+		if decision, ok, err := readApprovalResponse(responsePath); err != nil {
+			return ApprovalDecision{}, err
+		} else if ok {
+			os.Remove(responsePath)
+			return decision, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ApprovalDecision{}, ctx.Err()
+		case <-deadline:
+			return ApprovalDecision{Approved: false, Reason: fmt.Sprintf("no answer within %s", f.Timeout)}, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Pending lists unanswered requests, oldest first.
+func (f *FileApprover) Pending() ([]ApprovalRequest, error) {
+	matches, err := filepath.Glob(filepath.Join(f.Dir, "*.request.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []ApprovalRequest
+	for _, path := range matches {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue // answered and cleaned up between Glob and ReadFile
+		}
+		var req ApprovalRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, fmt.Errorf("malformed approval request %s: %w", path, err)
+		}
+		pending = append(pending, req)
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Timestamp < pending[j].Timestamp })
+	return pending, nil
+}
+
+// Respond answers a pending request.
+func (f *FileApprover) Respond(id string, decision ApprovalDecision) error {
+	if _, err := os.Stat(filepath.Join(f.Dir, id+".request.json")); err != nil {
+		return fmt.Errorf("no pending approval request %q", id)
+	}
+	data, err := json.Marshal(decision)
+	if err != nil {
+		return err
+	}
+	// Write then rename so the waiting agent never reads a partial response.
+	tmp := filepath.Join(f.Dir, id+".response.json.tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(f.Dir, id+".response.json"))
+}
+
+func readApprovalResponse(path string) (ApprovalDecision, bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ApprovalDecision{}, false, nil
+	}
+	if err != nil {
+		return ApprovalDecision{}, false, err
+	}
+	var decision ApprovalDecision
+	if err := json.Unmarshal(data, &decision); err != nil {
+		return ApprovalDecision{}, false, fmt.Errorf("malformed approval response %s: %w", path, err)
+	}
+	return decision, true, nil
+}
+
+func newApprovalID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// needsApproval reports whether the action must be confirmed under the
+// agent's approval mode, along with the reason shown to the human.
+func (a *Agent) needsApproval(action string) (bool, string) {
+	switch a.Approval {
+	case ApprovalAlways:
+		if risky, reason := classifyAction(action); risky {
+			return true, reason
+		}
+		return true, "is not pre-approved (approval mode is always)"
+	case ApprovalRisky:
+		return classifyAction(action)
+	}
+	return false, ""
+}
+
+// approve runs the approval gate for an action. It returns false along with
+// feedback for the LLM when the action must not run.
+func (a *Agent) approve(ctx context.Context, action string) (bool, string, error) {
+	needed, reason := a.needsApproval(action)
+	return a.requestApproval(ctx, action, needed, reason)
+}
+
+// approveWrite runs the approval gate for a tool call that changes files.
+// Such calls bypass the sandbox, so under risky and always approval every
+// one of them is confirmed.
+func (a *Agent) approveWrite(ctx context.Context, tool string, paths []string) (bool, string, error) {
+	needed := a.Approval == ApprovalRisky || a.Approval == ApprovalAlways
+	return a.requestApproval(ctx, fmt.Sprintf("%s %s", tool, strings.Join(paths, " ")), needed, "edits files outside the sandbox")
+}
+
+// requestApproval asks the approver to confirm an action when needed.
+func (a *Agent) requestApproval(ctx context.Context, action string, needed bool, reason string) (bool, string, error) {
+	if !needed {
+		return true, "", nil
+	}
+
+	if a.Approver == nil {
+		a.log(fmt.Sprintf("Action requires approval but no approver is available: %s", action), "WARNING", nil, 0)
+		return false, fmt.Sprintf("Action denied: it %s and requires human approval, but no approver is available in this session. Choose a different approach or finish and explain what a human needs to do.", reason), nil
+	}
+
+	a.log(fmt.Sprintf("Requesting approval for action: %s", action), "INFO", nil, 0)
+	decision, err := a.Approver.Approve(ctx, ApprovalRequest{
+		ID:        newApprovalID(),
+		Agent:     a.Profile.Name,
+		Action:    action,
+		Reason:    reason,
+		Timestamp: time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		return false, "", fmt.Errorf("%w: approval request failed: %w", ErrActionBlocked, err)
+	}
+
+	if !decision.Approved {
+		a.log(fmt.Sprintf("Action denied by human: %s (%s)", action, decision.Reason), "WARNING", nil, 0)
+		feedback := "Action denied by human reviewer."
+		if decision.Reason != "" {
+			feedback += " Reason: " + decision.Reason
+		}
+		return false, feedback, nil
+	}
+
+	a.log(fmt.Sprintf("Action approved: %s", action), "INFO", nil, 0)
+	return true, "", nil
+}
@@ -0,0 +1,342 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shalomb/axon/pkg/types"
+)
+
+type mockApprover struct {
+	decision ApprovalDecision
+	requests []ApprovalRequest
+}
+
+func (m *mockApprover) Approve(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+	m.requests = append(m.requests, req)
+	return m.decision, nil
+}
+
+func TestClassifyAction(t *testing.T) {
+	tests := []struct {
+		action string
+		risky  bool
+	}{
+		{"ls -la", false},
+		{"go test ./...", false},
+		{"git status", false},
+		{"git merge feat/epic-1", true},
+		{"git push origin main", true},
+		{"gh pr merge 12 --squash", true},
+		{"git reset --hard HEAD~1", true},
+		{"rm -rf build", true},
+		{"rm file.txt", false},
+	}
+
+	for _, tt := range tests {
+		risky, _ := classifyAction(tt.action)
+		if risky != tt.risky {
+			t.Errorf("classifyAction(%q) = %v, want %v", tt.action, risky, tt.risky)
+		}
+	}
+}
+
+func TestClassifyAction_GitSubcommands(t *testing.T) {
+	tests := []struct {
+		action string
+		reason string
+	}{
+		{"git -C repo merge feat/x", "merges a branch"},
+		{"git -c user.name=bot push origin main", "pushes to a remote"},
+		{"git --git-dir=.git --work-tree=. push", "pushes to a remote"},
+		{"git --git-dir .git push", "pushes to a remote"},
+		{"git --no-pager pull --rebase", "merges from a remote"},
+		{"/usr/bin/git pull", "merges from a remote"},
+		{"cd repo && git status && git push", "pushes to a remote"},
+		{"git fetch; git rebase origin/main", "rewrites branch history"},
+		{"git -C repo reset --hard", "discards local changes"},
+		{"git branch --delete old", "deletes a ref"},
+		{"git tag -d v1.0", "deletes a ref"},
+		{"git -C repo status", ""},
+		{"git log --grep=merge", ""},
+		{`git commit -m "merge the push fix"`, ""},
+		{"git reset HEAD~1 && echo --hard", ""},
+		{"git && ls", ""},
+		{"git -C", ""},
+	}
+
+	for _, tt := range tests {
+		_, reason := classifyAction(tt.action)
+		if reason != tt.reason {
+			t.Errorf("classifyAction(%q) reason = %q, want %q", tt.action, reason, tt.reason)
+		}
+	}
+}
+
+func TestIsReadOnlyAction(t *testing.T) {
+	tests := []struct {
+		action   string
+		readOnly bool
+	}{
+		{"ls -la", true},
+		{"cat go.mod | grep module", true},
+		{"cd internal && grep -rn Limiter .", true},
+		{"git -C repo log --oneline -5", true},
+		{"git diff main...HEAD", true},
+		{`sed -n '1,20p' main.go`, true},
+		{"find . -name '*.go'", true},
+		{"td query 'status = open'", true},
+		{`grep -rn "a|b;c" internal | sort | uniq -c`, true},
+		{"sed -n -e '/^func /p' -e '$=' main.go", true},
+		{"sed 's/foo/bar/g;10q' main.go", true},
+		{"go env GOPATH", true},
+		{"go list -f '{{.Dir}}' ./...", true},
+		{"git diff --stat main", true},
+		{"sort -u names.txt", true},
+		{"echo plan > PLAN.md", false},
+		{"cat a >> b", false},
+		{"git commit -am wip", false},
+		{"git -c k=v push", false},
+		{"git", false},
+		{"ls && rm -rf build", false},
+		{"sed -i s/a/b/ main.go", false},
+		{"sed -ni s/a/b/p main.go", false},
+		{"find . -name '*.tmp' -delete", false},
+		{"sort -o out.txt in.txt", false},
+		{"sort -uo out.txt in.txt", false},
+		{"sort --output=out.txt in.txt", false},
+		{"sort --compress-program=sh in.txt", false},
+		{"tree -o out.txt", false},
+		{"go env -w GOFLAGS=-mod=mod", false},
+		{"go list -toolexec ./run.sh ./...", false},
+		{"sed -n 'w out.txt' main.go", false},
+		{"sed 's/a/b/w out.txt' main.go", false},
+		{"sed '1e touch x' main.go", false},
+		{"sed 's/.*/touch x/e' main.go", false},
+		{"sed -f script.sed main.go", false},
+		{"rg --pre ./run.sh TODO", false},
+		{"rg --pre=./run.sh TODO", false},
+		{"git -c core.pager=./run.sh log", false},
+		{"git --config-env=core.pager=PAGER log", false},
+		{"git diff --output=out.txt", false},
+		{"git grep -O./run.sh TODO", false},
+		{"file -C -m magic", false},
+		{"uniq in.txt out.txt", false},
+		{"cat a;rm b", false},
+		{"echo $(rm -rf build)", false},
+		{"echo \"`rm -rf build`\"", false},
+		{"cat <(rm -rf build)", false},
+		{"ls\nrm -rf build", false},
+		{"ls & rm -rf build", false},
+		{"go test ./...", false},
+		{"td create 'New task'", false},
+		{"cat 'unterminated", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isReadOnlyAction(tt.action); got != tt.readOnly {
+			t.Errorf("isReadOnlyAction(%q) = %v, want %v", tt.action, got, tt.readOnly)
+		}
+	}
+}
+
+func TestParseApprovalMode(t *testing.T) {
+	for in, want := range map[string]ApprovalMode{"": ApprovalNever, "Risky": ApprovalRisky, "always": ApprovalAlways} {
+		got, err := ParseApprovalMode(in)
+		if err != nil || got != want {
+			t.Errorf("ParseApprovalMode(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseApprovalMode("sometimes"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestAgent_Run_ApprovalDenied(t *testing.T) {
+	mLLM := &mockLLM{responses: []string{"ACTION: git merge feat/epic-1", "[[FINISH]]"}}
+	mSB := &mockSandbox{}
+	approver := &mockApprover{decision: ApprovalDecision{Approved: false, Reason: "not before the release notes"}}
+	a := New(AgentProfile{Name: "lovejoy", Role: "role", Approval: ApprovalRisky}, mLLM, mSB)
+	a.Approver = approver
+	a.Task = "release"
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if mSB.calls != 0 {
+		t.Error("expected sandbox not to be called for denied action")
+	}
+	if len(approver.requests) != 1 || approver.requests[0].Agent != "lovejoy" {
+		t.Fatalf("unexpected approval requests: %+v", approver.requests)
+	}
+	lastMsg := mLLM.received[1][len(mLLM.received[1])-1]
+	if !strings.Contains(lastMsg.Content, "not before the release notes") {
+		t.Errorf("denial reason not fed back to LLM: %q", lastMsg.Content)
+	}
+}
+
+func TestAgent_Run_ApprovalGranted(t *testing.T) {
+	mLLM := &mockLLM{responses: []string{"ACTION: git merge feat/epic-1", "[[FINISH]]"}}
+	mSB := &mockSandbox{results: []*types.Result{{ExitCode: 0}}}
+	a := New(AgentProfile{Name: "lovejoy", Role: "role", Approval: ApprovalRisky}, mLLM, mSB)
+	a.Approver = &mockApprover{decision: ApprovalDecision{Approved: true}}
+	a.Task = "release"
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if mSB.calls != 1 {
+		t.Errorf("expected approved action to run, sandbox calls = %d", mSB.calls)
+	}
+}
+
+func TestAgent_Run_ApprovalModes(t *testing.T) {
+	tests := []struct {
+		mode      ApprovalMode
+		action    string
+		wantAsked bool
+	}{
+		{ApprovalNever, "git merge x", false},
+		{ApprovalRisky, "ls", false},
+		{ApprovalRisky, "git push", true},
+		{ApprovalAlways, "ls", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode)+"/"+tt.action, func(t *testing.T) {
+			mLLM := &mockLLM{responses: []string{"ACTION: " + tt.action, "[[FINISH]]"}}
+			mSB := &mockSandbox{results: []*types.Result{{ExitCode: 0}}}
+			approver := &mockApprover{decision: ApprovalDecision{Approved: true}}
+			a := New(AgentProfile{Name: "agent", Role: "role"}, mLLM, mSB)
+			a.Approval = tt.mode
+			a.Approver = approver
+			a.Task = "task"
+
+			if err := a.Run(context.Background()); err != nil {
+				t.Fatalf("Run() unexpected error: %v", err)
+			}
+			if asked := len(approver.requests) > 0; asked != tt.wantAsked {
+				t.Errorf("approval asked = %v, want %v", asked, tt.wantAsked)
+			}
+		})
+	}
+}
+
+func TestAgent_Run_ApprovalWithoutApproverDenies(t *testing.T) {
+	mLLM := &mockLLM{responses: []string{"ACTION: git push", "[[FINISH]]"}}
+	mSB := &mockSandbox{}
+	a := New(AgentProfile{Name: "agent", Role: "role", Approval: ApprovalRisky}, mLLM, mSB)
+	a.Task = "task"
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if mSB.calls != 0 {
+		t.Error("expected sandbox not to be called without an approver")
+	}
+}
+
+func TestWithApproval_CannotRelaxProfile(t *testing.T) {
+	a := New(AgentProfile{Name: "lovejoy", Approval: ApprovalRisky}, nil, nil)
+	WithApproval(ApprovalNever, nil)(a)
+	if a.Approval != ApprovalRisky {
+		t.Errorf("Approval = %q, want %q", a.Approval, ApprovalRisky)
+	}
+	WithApproval(ApprovalAlways, nil)(a)
+	if a.Approval != ApprovalAlways {
+		t.Errorf("Approval = %q, want %q", a.Approval, ApprovalAlways)
+	}
+}
+
+func TestTTYApprover(t *testing.T) {
+	out := &bytes.Buffer{}
+	approver := &TTYApprover{In: strings.NewReader("y\n"), Out: out}
+
+	decision, err := approver.Approve(context.Background(), ApprovalRequest{Agent: "lovejoy", Action: "git merge x", Reason: "merges a branch"})
+	if err != nil {
+		t.Fatalf("Approve() error: %v", err)
+	}
+	if !decision.Approved {
+		t.Error("expected approval for 'y'")
+	}
+	if !strings.Contains(out.String(), "git merge x") {
+		t.Errorf("prompt did not show the action: %q", out.String())
+	}
+}
+
+func TestTTYApprover_SharesOneReader(t *testing.T) {
+	in, w := io.Pipe()
+	approver := &TTYApprover{In: in, Out: io.Discard}
+	req := ApprovalRequest{Agent: "lovejoy", Action: "git push", Reason: "pushes to a remote"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := approver.Approve(ctx, req); err == nil {
+		t.Fatal("expected a cancelled prompt to fail")
+	}
+
+	go func() {
+		_, _ = io.WriteString(w, "yes\nn\n")
+		_ = w.Close()
+	}()
+	for i, want := range []bool{true, false, false} {
+		decision, err := approver.Approve(context.Background(), req)
+		if err != nil {
+			t.Fatalf("answer %d: %v", i, err)
+		}
+		if decision.Approved != want {
+			t.Errorf("answer %d: approved = %v, want %v", i, decision.Approved, want)
+		}
+	}
+}
+
+func TestFileApprover_RoundTrip(t *testing.T) {
+	queue := &FileApprover{Dir: t.TempDir(), PollInterval: 10 * time.Millisecond}
+
+	done := make(chan ApprovalDecision, 1)
+	go func() {
+		decision, err := queue.Approve(context.Background(), ApprovalRequest{ID: "req-1", Agent: "lovejoy", Action: "git merge x"})
+		if err != nil {
+			t.Errorf("Approve() error: %v", err)
+		}
+		done <- decision
+	}()
+
+	var pending []ApprovalRequest
+	for i := 0; i < 100 && len(pending) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		pending, _ = queue.Pending()
+	}
+	if len(pending) != 1 || pending[0].ID != "req-1" {
+		t.Fatalf("expected one pending request, got %+v", pending)
+	}
+
+	if err := queue.Respond("req-1", ApprovalDecision{Approved: false, Reason: "wait for QA"}); err != nil {
+		t.Fatalf("Respond() error: %v", err)
+	}
+
+	select {
+	case decision := <-done:
+		if decision.Approved || decision.Reason != "wait for QA" {
+			t.Errorf("unexpected decision: %+v", decision)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Approve() did not return after Respond()")
+	}
+
+	if pending, _ := queue.Pending(); len(pending) != 0 {
+		t.Errorf("expected queue to be empty, got %+v", pending)
+	}
+}
+
+func TestFileApprover_RespondUnknown(t *testing.T) {
+	queue := &FileApprover{Dir: t.TempDir()}
+	if err := queue.Respond("missing", ApprovalDecision{Approved: true}); err == nil {
+		t.Error("expected error for unknown request")
+	}
+}
@@ -0,0 +1,332 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shalomb/springfield/internal/codeindex"
+)
+
+// DefaultContextBudget is the byte budget for context files when a profile
+// doesn't set one, roughly 25k tokens.
+const DefaultContextBudget = 100_000
+
+// DiffSource is the context entry for the files changed on the current
+// branch. "@diff:<ref>" diffs against ref instead of the default branch.
+const DiffSource = "@diff"
+
+// minTruncatedBytes is the smallest useful excerpt of a file; below it the
+// file is skipped rather than truncated.
+const minTruncatedBytes = 512
+
+// recencyCommits bounds how far back git history is read to rank files.
+const recencyCommits = 500
+
+// ContextManifest records what went into an agent's context.
+type ContextManifest struct {
+	Included  []string // Files included whole
+	Truncated []string // Files cut short by the budget
+	Skipped   []string // Files left out, with the reason
+	Bytes     int
+	Budget    int
+}
+
+// cutText shortens text to at most n bytes, ending after a line break if
+// there is one in the second half, and otherwise on a UTF-8 rune boundary.
+func cutText(text []byte, n int) []byte {
+	if len(text) <= n {
+		return text
+	}
+	if i := bytes.LastIndexByte(text[:n], '\n'); i >= n/2 {
+		return text[:i+1]
+	}
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n]
+}
+
+// contextFile is a candidate file for the context, relative to the root.
+type contextFile struct {
+	path    string
+	changed int64 // Unix time of the last change; uncommitted changes rank highest
+}
+
+// LoadContextFiles expands patterns against root and reads the matching
+// files into a single context message of at most budget bytes.
+//
+// Patterns are exact paths, directories, globs (where ** matches any number
+// of directories) or DiffSource. Directories and globs only match files git
+// doesn't ignore. Files named exactly come first in the order given; matched
+// files follow, most recently changed first. Once the budget runs out, the
+// next file is truncated and the rest are skipped.
+func LoadContextFiles(root string, patterns []string, budget int) (string, ContextManifest) {
+	if budget <= 0 {
+		budget = DefaultContextBudget
+	}
+	manifest := ContextManifest{Budget: budget}
+	files := expandContextPatterns(root, patterns, &manifest)
+
+	var parts []string
+	used, full := 0, false
+	for _, f := range files {
+		content, err := codeindex.ReadFile(root, f.path)
+		if err != nil {
+			manifest.Skipped = append(manifest.Skipped, fmt.Sprintf("%s (%v)", f.path, err))
+			continue
+		}
+		if isBinary(content) {
+			manifest.Skipped = append(manifest.Skipped, f.path+" (binary)")
+			continue
+		}
+		if !full && used+len(content) <= budget {
+			parts = append(parts, fmt.Sprintf("FILE: %s\nCONTENT:\n%s\n---", f.path, content))
+			manifest.Included = append(manifest.Included, f.path)
+			used += len(content)
+			continue
+		}
+		if full || budget-used < minTruncatedBytes {
+			manifest.Skipped = append(manifest.Skipped, f.path+" (over budget)")
+			continue
+		}
+		shown := cutText(content, budget-used)
+		parts = append(parts, fmt.Sprintf("FILE: %s\nCONTENT:\n%s\n[... truncated: showing %d of %d bytes]\n---",
+			f.path, shown, len(shown), len(content)))
+		manifest.Truncated = append(manifest.Truncated, f.path)
+		used += len(shown)
+		full = true
+	}
+	manifest.Bytes = used
+	if len(parts) == 0 {
+		return "", manifest
+	}
+	return "CURRENT CONTEXT FILES:\n\n" + strings.Join(parts, "\n\n"), manifest
+}
+
+// expandContextPatterns resolves patterns to a de-duplicated, prioritised
+// list of files. Exact paths that are missing, or aren't regular files inside
+// root, are recorded in the manifest.
+func expandContextPatterns(root string, patterns []string, manifest *ContextManifest) []contextFile {
+	var explicit, matched []contextFile
+	seen := make(map[string]bool)
+	// Matches that aren't regular files inside root, such as symlinks out of
+	// it, are left out.
+	add := func(list *[]contextFile, f contextFile) {
+		if _, err := codeindex.Stat(root, f.path); err != nil {
+			return
+		}
+		if !seen[f.path] {
+			seen[f.path] = true
+			*list = append(*list, f)
+		}
+	}
+
+	var tracked []string // Lazily listed: only globs and directories need it
+	listed := false
+	listFiles := func() []string {
+		if !listed {
+			tracked, listed = codeindex.ListFiles(root), true
+		}
+		return tracked
+	}
+
+	for _, pattern := range patterns {
+		pattern = filepath.ToSlash(strings.TrimSpace(pattern))
+		switch {
+		case pattern == "":
+			continue
+		case pattern == DiffSource || strings.HasPrefix(pattern, DiffSource+":"):
+			changed, err := diffFiles(root, strings.TrimPrefix(strings.TrimPrefix(pattern, DiffSource), ":"))
+			if err != nil {
+				manifest.Skipped = append(manifest.Skipped, fmt.Sprintf("%s (%v)", pattern, err))
+				continue
+			}
+			for _, p := range changed {
+				add(&matched, contextFile{path: p})
+			}
+		case strings.ContainsAny(pattern, "*?["):
+			for _, p := range listFiles() {
+				if matchGlob(pattern, p) {
+					add(&matched, contextFile{path: p})
+				}
+			}
+		default:
+			info, err := os.Lstat(filepath.Join(root, pattern))
+			if os.IsNotExist(err) {
+				manifest.Skipped = append(manifest.Skipped, pattern+" (not found)")
+				continue
+			}
+			if err != nil {
+				manifest.Skipped = append(manifest.Skipped, fmt.Sprintf("%s (%v)", pattern, err))
+				continue
+			}
+			if !info.IsDir() {
+				if _, err := codeindex.Stat(root, pattern); err != nil {
+					manifest.Skipped = append(manifest.Skipped, fmt.Sprintf("%s (%v)", pattern, err))
+					continue
+				}
+				add(&explicit, contextFile{path: path.Clean(pattern)})
+				continue
+			}
+			prefix := strings.TrimSuffix(path.Clean(pattern), "/") + "/"
+			for _, p := range listFiles() {
+				if prefix == "./" || strings.HasPrefix(p, prefix) {
+					add(&matched, contextFile{path: p})
+				}
+			}
+		}
+	}
+
+	if len(matched) > 1 {
+		recency := fileRecency(root)
+		for i := range matched {
+			matched[i].changed = recency[matched[i].path]
+		}
+		sort.SliceStable(matched, func(i, j int) bool {
+			if matched[i].changed != matched[j].changed {
+				return matched[i].changed > matched[j].changed
+			}
+			return matched[i].path < matched[j].path
+		})
+	}
+	return append(explicit, matched...)
+}
+
+// matchGlob matches a slash-separated path against a glob in which **
+// matches zero or more whole path segments.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// diffFiles lists the files changed on the current branch since it left
+// base, including uncommitted changes to tracked files. An empty base means
+// the default branch.
+func diffFiles(root, base string) ([]string, error) {
+	if base == "" {
+		base = defaultBranch(root)
+		if base == "" {
+			return nil, fmt.Errorf("no default branch to diff against")
+		}
+	}
+	mergeBase, err := gitOutput(root, "merge-base", "HEAD", base)
+	if err != nil {
+		return nil, fmt.Errorf("no merge base with %s: %w", base, err)
+	}
+	out, err := gitOutput(root, "diff", "--relative", "--name-only", "-z", strings.TrimSpace(mergeBase))
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, p := range strings.Split(out, "\x00") {
+		if p != "" {
+			files = append(files, p)
+		}
+	}
+	return files, nil
+}
+
+// defaultBranch guesses the branch work is merged into: origin's HEAD, then
+// main, then master.
+func defaultBranch(root string) string {
+	if out, err := gitOutput(root, "symbolic-ref", "--quiet", "--short", "refs/remotes/origin/HEAD"); err == nil {
+		return strings.TrimSpace(out)
+	}
+	for _, b := range []string{"main", "master"} {
+		if _, err := gitOutput(root, "rev-parse", "--verify", "--quiet", b); err == nil {
+			return b
+		}
+	}
+	return ""
+}
+
+// fileRecency maps files to the time they last changed: uncommitted changes
+// rank above any commit, then the most recent of the last recencyCommits
+// commits to touch the file. Untouched files are absent.
+func fileRecency(root string) map[string]int64 {
+	recency := make(map[string]int64)
+	out, err := gitOutput(root, "log", "-n", strconv.Itoa(recencyCommits), "--format=%x01%ct", "--name-only", "--relative")
+	if err != nil {
+		return recency
+	}
+	var when int64
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "\x01") {
+			when, _ = strconv.ParseInt(line[1:], 10, 64)
+			continue
+		}
+		if line != "" && recency[line] == 0 {
+			recency[line] = when // Log is newest first
+		}
+	}
+
+	// Porcelain status paths are relative to the top of the repository.
+	prefix, _ := gitOutput(root, "rev-parse", "--show-prefix")
+	prefix = strings.TrimSpace(prefix)
+	if status, err := gitOutput(root, "status", "--porcelain", "-z", "--untracked-files=all", "."); err == nil {
+		entries := strings.Split(status, "\x00")
+		for i := 0; i < len(entries); i++ {
+			entry := entries[i]
+			if len(entry) < 4 {
+				continue
+			}
+			recency[strings.TrimPrefix(entry[3:], prefix)] = 1<<63 - 1
+			if entry[0] == 'R' || entry[0] == 'C' {
+				i++ // The source path of a rename or copy follows
+			}
+		}
+	}
+	return recency
+}
+
+func gitOutput(root string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = root
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return string(out), nil
+}
+
+// isBinary reports whether content looks binary: a NUL byte in its first
+// few kilobytes.
+func isBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
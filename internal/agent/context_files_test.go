@@ -0,0 +1,180 @@
+package agent
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func git(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.com",
+		"GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.com")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.md", "README.md", true},
+		{"*.md", "docs/README.md", false},
+		{"docs/**/*.md", "docs/README.md", true},
+		{"docs/**/*.md", "docs/how-to/setup.md", true},
+		{"**/*_test.go", "internal/agent/agent_test.go", true},
+		{"**", "any/thing", true},
+		{"internal/*/agent.go", "internal/agent/agent.go", true},
+		{"internal/*/agent.go", "internal/x/y/agent.go", false},
+	}
+	for _, c := range cases {
+		if got := matchGlob(c.pattern, c.name); got != c.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", c.pattern, c.name, got, c.want)
+		}
+	}
+}
+
+func TestLoadContextFiles_PatternsAndBudget(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"TODO.md":           "todo",
+		"docs/a.md":         "alpha",
+		"docs/sub/b.md":     "bravo",
+		"docs/skip.txt":     "not markdown",
+		".hidden/c.md":      "hidden",
+		"big.md":            strings.Repeat("x", 2000),
+		"internal/x/one.go": "package x",
+	})
+
+	content, manifest := LoadContextFiles(root, []string{"TODO.md", "docs/**/*.md", "internal", "TODO.md", "missing.md"}, 0)
+	wantIncluded := []string{"TODO.md", "docs/a.md", "docs/sub/b.md", "internal/x/one.go"}
+	if !reflect.DeepEqual(manifest.Included, wantIncluded) {
+		t.Errorf("included %v, want %v", manifest.Included, wantIncluded)
+	}
+	if len(manifest.Skipped) != 1 || manifest.Skipped[0] != "missing.md (not found)" {
+		t.Errorf("unexpected skipped: %v", manifest.Skipped)
+	}
+	if !strings.HasPrefix(content, "CURRENT CONTEXT FILES:\n\nFILE: TODO.md\nCONTENT:\ntodo\n---") {
+		t.Errorf("unexpected content: %q", content)
+	}
+	if strings.Contains(content, "hidden") {
+		t.Error("dot-directories should be skipped outside git")
+	}
+
+	// A 600 byte budget truncates big.md after TODO.md and skips the rest.
+	content, manifest = LoadContextFiles(root, []string{"TODO.md", "big.md", "docs/a.md"}, 600)
+	if !reflect.DeepEqual(manifest.Included, []string{"TODO.md"}) || !reflect.DeepEqual(manifest.Truncated, []string{"big.md"}) {
+		t.Errorf("unexpected manifest: %+v", manifest)
+	}
+	if !reflect.DeepEqual(manifest.Skipped, []string{"docs/a.md (over budget)"}) {
+		t.Errorf("unexpected skipped: %v", manifest.Skipped)
+	}
+	if manifest.Bytes != 600 || !strings.Contains(content, "[... truncated: showing 596 of 2000 bytes]") {
+		t.Errorf("unexpected truncation (%d bytes): %q", manifest.Bytes, content)
+	}
+}
+
+func TestLoadContextFiles_Symlinks(t *testing.T) {
+	outside := t.TempDir()
+	writeFiles(t, outside, map[string]string{"id_rsa": "PRIVATE KEY"})
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"notes.md": "notes"})
+	for name, target := range map[string]string{
+		"key.md":      filepath.Join(outside, "id_rsa"),
+		"FEEDBACK.md": filepath.Join(outside, "id_rsa"),
+		"ssh":         outside,
+	} {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skip("symlinks not supported:", err)
+		}
+	}
+
+	content, manifest := LoadContextFiles(root, []string{"FEEDBACK.md", "*.md", "ssh", "ssh/id_rsa", "../" + filepath.Base(outside) + "/id_rsa"}, 0)
+	if strings.Contains(content, "PRIVATE KEY") {
+		t.Fatalf("loaded a file from outside the root: %q", content)
+	}
+	if !reflect.DeepEqual(manifest.Included, []string{"notes.md"}) {
+		t.Errorf("included %v, want [notes.md]", manifest.Included)
+	}
+	if len(manifest.Skipped) != 4 || manifest.Skipped[0] != "FEEDBACK.md (not a regular file)" {
+		t.Errorf("expected the named paths to be skipped, got %v", manifest.Skipped)
+	}
+}
+
+func TestCutText(t *testing.T) {
+	tests := []struct {
+		text string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"line one\nline two\nline three", 22, "line one\nline two\n"},
+		{"héllo wörld", 2, "h"},
+		{"日本語", 4, "日"},
+		{"a\n" + strings.Repeat("é", 10), 12, "a\nééééé"},
+	}
+	for _, tt := range tests {
+		got := string(cutText([]byte(tt.text), tt.n))
+		if got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("cutText(%q, %d) = %q, want %q", tt.text, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestLoadContextFiles_GitAware(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := t.TempDir()
+	git(t, root, "init", "-q", "-b", "main")
+	writeFiles(t, root, map[string]string{
+		".gitignore":   "build/\n",
+		"old.md":       "old",
+		"touched.md":   "v1",
+		"build/out.md": "ignored",
+	})
+	git(t, root, "add", ".")
+	git(t, root, "commit", "-q", "-m", "base")
+
+	git(t, root, "checkout", "-q", "-b", "feature")
+	writeFiles(t, root, map[string]string{"touched.md": "v2", "new.md": "new"})
+	git(t, root, "add", "touched.md")
+	git(t, root, "commit", "-q", "-m", "change")
+
+	// Globs skip ignored files and rank the uncommitted file first.
+	_, manifest := LoadContextFiles(root, []string{"*.md", "build/*.md"}, 0)
+	if manifest.Included[0] != "new.md" || len(manifest.Included) != 3 {
+		t.Errorf("unexpected included: %v", manifest.Included)
+	}
+
+	// @diff brings in what the branch changed, committed or not.
+	_, manifest = LoadContextFiles(root, []string{DiffSource}, 0)
+	if !reflect.DeepEqual(manifest.Included, []string{"touched.md"}) {
+		t.Errorf("@diff included %v, want [touched.md]", manifest.Included)
+	}
+	_, manifest = LoadContextFiles(root, []string{DiffSource + ":nope"}, 0)
+	if len(manifest.Skipped) != 1 || !strings.HasPrefix(manifest.Skipped[0], "@diff:nope (") {
+		t.Errorf("expected @diff:nope to be skipped, got %v", manifest.Skipped)
+	}
+}
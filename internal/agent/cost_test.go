@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shalomb/springfield/internal/llm"
+)
+
+// modelLLM replies as a specific model with fixed usage.
+type modelLLM struct {
+	model     string
+	responses []string
+	calls     int
+}
+
+func (m *modelLLM) Chat(ctx context.Context, messages []llm.Message) (llm.Response, error) {
+	resp := m.responses[m.calls]
+	m.calls++
+	return llm.Response{
+		Content:    resp,
+		Model:      m.model,
+		TokenUsage: llm.TokenUsage{PromptTokens: 1000000, CompletionTokens: 100000, TotalTokens: 1100000},
+	}, nil
+}
+
+func TestAgent_Run_CostUsesServingModel(t *testing.T) {
+	pricing := llm.PricingTable{
+		"anthropic/primary":  {Input: 1, Output: 10},
+		"anthropic/fallback": {Input: 2, Output: 20},
+	}
+	mLLM := &modelLLM{model: "anthropic/fallback", responses: []string{"[[FINISH]]"}}
+	a := New(AgentProfile{Name: "agent", Role: "role"}, mLLM, &mockSandbox{})
+	a.Task = "task"
+	WithPricing("anthropic/primary", pricing)(a)
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+
+	// 1M prompt tokens at $2 + 100k completion tokens at $20 = $4
+	if a.TotalCost < 3.999 || a.TotalCost > 4.001 {
+		t.Errorf("TotalCost = %v, want 4 (priced as the fallback model)", a.TotalCost)
+	}
+	u, ok := a.UsageByModel["anthropic/fallback"]
+	if !ok || u.Calls != 1 || u.TokenUsage.TotalTokens != 1100000 {
+		t.Errorf("usage not attributed to serving model: %+v", a.UsageByModel)
+	}
+}
+
+func TestAgent_Run_CostFallsBackToConfiguredModel(t *testing.T) {
+	mLLM := &modelLLM{responses: []string{"[[FINISH]]"}} // response names no model
+	a := New(AgentProfile{Name: "agent", Role: "role"}, mLLM, &mockSandbox{})
+	a.Task = "task"
+	WithPricing("anthropic/primary", llm.PricingTable{"anthropic/primary": {Input: 1, Output: 10}})(a)
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if _, ok := a.UsageByModel["anthropic/primary"]; !ok {
+		t.Errorf("usage should be attributed to the configured model: %+v", a.UsageByModel)
+	}
+	if a.TotalCost < 1.999 || a.TotalCost > 2.001 {
+		t.Errorf("TotalCost = %v, want 2", a.TotalCost)
+	}
+}
+
+func TestAgent_Run_UsageHookSeesEveryResponse(t *testing.T) {
+	mLLM := &modelLLM{model: "anthropic/primary", responses: []string{"thinking", "[[FINISH]]"}}
+	a := New(AgentProfile{Name: "agent", Role: "role"}, mLLM, &mockSandbox{})
+	a.Task = "task"
+	WithPricing("anthropic/primary", llm.PricingTable{"anthropic/primary": {Input: 1, Output: 10}})(a)
+
+	var calls int
+	var total float64
+	WithUsageHook(func(model string, usage llm.TokenUsage, cost float64) {
+		calls++
+		total += cost
+		if model != "anthropic/primary" {
+			t.Errorf("hook model = %q", model)
+		}
+	})(a)
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("hook called %d times, want 2", calls)
+	}
+	if total != a.TotalCost {
+		t.Errorf("hook saw $%v, agent recorded $%v", total, a.TotalCost)
+	}
+}
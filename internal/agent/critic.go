@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/shalomb/springfield/internal/decision"
+	"github.com/shalomb/springfield/internal/llm"
+)
+
+// DefaultCriticRounds is how many revisions a critic may ask for before the
+// agent's output is accepted regardless.
+const DefaultCriticRounds = 2
+
+// Critic reviews an agent's final output against a rubric before it is
+// accepted, sending it back for revision on rejection.
+type Critic struct {
+	LLM       llm.LLMClient // nil reviews with the agent's own client
+	Model     string        // Model LLM serves, for pricing and logs
+	Rubric    string
+	MaxRounds int // Revisions the critic may ask for; 0 uses DefaultCriticRounds
+}
+
+const criticPrompt = `You are a critic reviewing another agent's final output against a rubric.
+Check the output against every point of the rubric and the task it was given.
+Start your reply with <verdict>accept</verdict> if the output meets the rubric,
+or <verdict>revise</verdict> if it doesn't, then list specific, actionable
+changes. Don't rewrite the output yourself.`
+
+var verdictRegex = regexp.MustCompile(`(?i)<verdict>\s*(accept|revise)\s*</verdict>`)
+
+// critique has the critic review the agent's final output. It returns
+// feedback asking the agent to revise, or "" once the critic accepts, has
+// used up its rounds or can't be reached. The critic's usage counts against
+// the agent's budget.
+func (a *Agent) critique(ctx context.Context, output string) (string, error) {
+	c := a.Profile.Critic
+	rounds := c.MaxRounds
+	if rounds <= 0 {
+		rounds = DefaultCriticRounds
+	}
+	if a.critiques >= rounds {
+		a.log(fmt.Sprintf("Critic has asked for %d revisions; accepting the output.", a.critiques), "WARNING", nil, 0)
+		return "", nil
+	}
+
+	client, model := c.LLM, c.Model
+	if client == nil {
+		client, model = a.LLM, a.Model
+	}
+	messages := []llm.Message{
+		{Role: "system", Content: criticPrompt},
+		{Role: "user", Content: fmt.Sprintf("RUBRIC:\n%s\n\nTASK:\n%s\n\nOUTPUT:\n%s", c.Rubric, a.Task, output)},
+	}
+	resp, err := a.chatWithRetry(ctx, client, messages, fmt.Sprintf("[%s critic]", a.Profile.Name))
+	if err != nil {
+		// The output already met the agent's gates: don't throw it away.
+		a.log(fmt.Sprintf("Critic failed: %v; accepting the output unreviewed.", err), "WARNING", nil, 0)
+		return "", nil
+	}
+	if resp.Model == "" {
+		resp.Model = model
+	}
+	served, cost := a.recordUsage(resp)
+	if a.Budget > 0 && a.TotalUsage > a.Budget {
+		a.log(fmt.Sprintf("Budget exceeded: %d > %d", a.TotalUsage, a.Budget), "ERROR", nil, 0)
+		return "", fmt.Errorf("%w: %d tokens used", ErrBudgetExceeded, a.TotalUsage)
+	}
+
+	verdict := "accept"
+	if m := verdictRegex.FindStringSubmatch(resp.Content); m != nil {
+		verdict = strings.ToLower(m[1])
+	} else {
+		a.log("Critic gave no verdict; accepting the output.", "WARNING", nil, 0)
+	}
+	a.logData(fmt.Sprintf("Critic verdict: %s", verdict), "INFO", resp.TokenUsage, cost,
+		map[string]interface{}{"model": served, "verdict": verdict, "round": a.critiques + 1, "critique": resp.Content})
+	if verdict == "accept" {
+		return "", nil
+	}
+
+	a.critiques++
+	a.result.Critiques = a.critiques
+	feedback := strings.TrimSpace(verdictRegex.ReplaceAllString(resp.Content, ""))
+	return fmt.Sprintf("A reviewer asked for changes to your output (revision %d of %d):\n%s\n\n"+
+		"Revise your output accordingly, then finish again with %s.", a.critiques, rounds, feedback, a.finishMarker()), nil
+}
+
+// finalOutput is a finishing response without its thoughts, decision block
+// and finish marker.
+func (a *Agent) finalOutput(content string) string {
+	content = thoughtTagRegex.ReplaceAllString(content, "")
+	content = decision.Strip(content)
+	content = strings.Replace(content, a.finishMarker(), "", -1)
+	return strings.TrimSpace(content)
+}
@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAgent_Run_CriticRevises(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "PLAN.md")
+	mLLM := &mockLLM{responses: []string{"Plan: do it.\n[[FINISH]]", "Plan: test it, then do it.\n[[FINISH]]"}}
+	critic := &mockLLM{responses: []string{
+		"<verdict>revise</verdict>\nThe plan has no tests.",
+		"<verdict>accept</verdict>",
+	}}
+	profile := AgentProfile{Name: "lisa", Role: "role", OutputTarget: target,
+		Critic: &Critic{LLM: critic, Model: "critic-model", Rubric: "Every plan is tested."}}
+	a := New(profile, mLLM, &mockSandbox{})
+	a.Task = "plan the work"
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if mLLM.calls != 2 || critic.calls != 2 {
+		t.Fatalf("expected 2 agent and 2 critic calls, got %d and %d", mLLM.calls, critic.calls)
+	}
+	review := critic.received[0][1].Content
+	for _, want := range []string{"RUBRIC:\nEvery plan is tested.", "TASK:\nplan the work", "OUTPUT:\nPlan: do it."} {
+		if !strings.Contains(review, want) {
+			t.Errorf("critic request %q missing %q", review, want)
+		}
+	}
+	feedback := mLLM.received[1][len(mLLM.received[1])-1].Content
+	if !strings.Contains(feedback, "(revision 1 of 2):\nThe plan has no tests.") {
+		t.Errorf("unexpected revision request: %q", feedback)
+	}
+	if got, _ := os.ReadFile(target); string(got) != "Plan: test it, then do it." {
+		t.Errorf("unexpected output: %q", got)
+	}
+	// Both the agent's and the critic's calls are counted.
+	if a.TotalUsage != 80 || a.UsageByModel["critic-model"].Calls != 2 || a.Result().Critiques != 1 {
+		t.Errorf("unexpected usage: %d tokens, %+v, %+v", a.TotalUsage, a.UsageByModel, a.Result())
+	}
+}
+
+func TestAgent_Run_CriticRoundsRunOut(t *testing.T) {
+	mLLM := &mockLLM{responses: repeat("Done.\n[[FINISH]]", 3)}
+	critic := &mockLLM{responses: repeat("<verdict>revise</verdict> Try harder.", 3)}
+	profile := AgentProfile{Name: "lisa", Role: "role", Critic: &Critic{LLM: critic, Rubric: "Be perfect.", MaxRounds: 1}}
+	a := New(profile, mLLM, &mockSandbox{})
+	a.StallPolicy = StallPolicy{}
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if mLLM.calls != 2 || critic.calls != 1 {
+		t.Errorf("expected the second finish to be accepted unreviewed, got %d and %d calls", mLLM.calls, critic.calls)
+	}
+}
+
+func TestAgent_Run_CriticFailureAcceptsOutput(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "PLAN.md")
+	mLLM := &mockLLM{responses: []string{"Plan: do it.\n[[FINISH]]"}}
+	critic := &mockLLM{errors: []error{errors.New("critic model unavailable")}}
+	profile := AgentProfile{Name: "lisa", Role: "role", OutputTarget: target,
+		Critic: &Critic{LLM: critic, Rubric: "Every plan is tested."}}
+	a := New(profile, mLLM, &mockSandbox{})
+	a.RetryPolicy.MaxRetries = 0
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if critic.calls != 1 || a.Result().Critiques != 0 {
+		t.Errorf("expected one failed review and no revisions, got %d calls and %+v", critic.calls, a.Result())
+	}
+	if got, _ := os.ReadFile(target); string(got) != "Plan: do it." {
+		t.Errorf("expected the output to be kept unreviewed, got %q", got)
+	}
+}
+
+func TestAgent_Run_CriticCountsAgainstBudget(t *testing.T) {
+	mLLM := &mockLLM{responses: []string{"Done.\n[[FINISH]]"}}
+	profile := AgentProfile{Name: "lisa", Role: "role", Critic: &Critic{LLM: &mockLLM{responses: []string{"<verdict>accept</verdict>"}}, Rubric: "Be brief."}}
+	a := New(profile, mLLM, &mockSandbox{})
+	a.Budget = 30
+
+	if err := a.Run(context.Background()); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("expected the critic's call to exceed the budget, got %v", err)
+	}
+}
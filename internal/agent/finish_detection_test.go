@@ -2,9 +2,12 @@ package agent
 
 import (
 	"context"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/shalomb/axon/pkg/types"
+	"github.com/shalomb/springfield/internal/decision"
 )
 
 func TestAgent_Run_RobustFinishDetection(t *testing.T) {
@@ -80,3 +83,33 @@ func TestAgent_Run_RobustFinishDetection(t *testing.T) {
 		})
 	}
 }
+
+func TestAgent_Run_RequiresValidDecision(t *testing.T) {
+	mLLM := &mockLLM{responses: []string{
+		"All done. [[FINISH]]",
+		`<decision>{"decision": "bart_ok"}</decision> [[FINISH]]`,
+		`<decision>{"decision": "ralph_done", "summary": "feature complete"}</decision> [[FINISH]]`,
+	}}
+	decisionFile := filepath.Join(t.TempDir(), "decision.json")
+	a := New(AgentProfile{Name: "ralph", Role: "builder"}, mLLM, &mockSandbox{})
+	WithDecisions([]string{"ralph_done"}, decisionFile)(a)
+	a.Task = "task"
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if mLLM.calls != 3 {
+		t.Fatalf("expected the missing and the disallowed decision to be sent back, got %d calls", mLLM.calls)
+	}
+	last := mLLM.received[2]
+	if feedback := last[len(last)-1].Content; !strings.Contains(feedback, "ralph_done") {
+		t.Errorf("feedback should list the allowed decisions: %q", feedback)
+	}
+	if a.Decision == nil || a.Decision.Decision != "ralph_done" {
+		t.Errorf("unexpected decision: %+v", a.Decision)
+	}
+	d, err := decision.Read(decisionFile)
+	if err != nil || d == nil || d.Summary != "feature complete" {
+		t.Errorf("decision file not written: %+v, %v", d, err)
+	}
+}
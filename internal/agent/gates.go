@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrGateFailed is returned when the agent keeps finishing with a finish
+// gate failing and runs out of gate attempts.
+var ErrGateFailed = errors.New("finish gate failed")
+
+// DefaultFinishGateAttempts is how many finishes a profile's finish gates
+// may reject before the run fails.
+const DefaultFinishGateAttempts = 3
+
+// maxGateOutput is how much of a failing gate's stdout and stderr, from the
+// end, is fed back to the model.
+const maxGateOutput = 4000
+
+// runFinishGates runs the profile's finish gates in the sandbox, in order,
+// when the model signals finish. It returns feedback for the model if one
+// fails, or ErrGateFailed once the failures use up the gate attempts.
+func (a *Agent) runFinishGates(ctx context.Context) (string, error) {
+	for _, gate := range a.Profile.FinishGates {
+		a.log(fmt.Sprintf("Running finish gate: %s", gate), "INFO", nil, 0)
+		result, err := a.Sandbox.Execute(ctx, gate)
+		if err != nil {
+			return "", fmt.Errorf("finish gate %q: %w", gate, err)
+		}
+		if result.ExitCode == 0 {
+			continue
+		}
+
+		a.gateFailures++
+		attempts := a.Profile.FinishGateAttempts
+		if attempts <= 0 {
+			attempts = DefaultFinishGateAttempts
+		}
+		a.logData(fmt.Sprintf("Finish gate failed (%d of %d): %s exited %d", a.gateFailures, attempts, gate, result.ExitCode),
+			"WARNING", nil, 0, map[string]interface{}{"gate": gate, "exit_code": result.ExitCode, "attempt": a.gateFailures})
+		if a.gateFailures >= attempts {
+			return "", fmt.Errorf("%w: %s exited %d on %d finishes", ErrGateFailed, gate, result.ExitCode, a.gateFailures)
+		}
+		return fmt.Sprintf("Your finish was not accepted: the finish gate `%s` failed with exit code %d "+
+			"(attempt %d of %d).\nSTDOUT: %s\nSTDERR: %s\nFix the failures, then finish again with %s.",
+			gate, result.ExitCode, a.gateFailures, attempts,
+			tail(result.Stdout, maxGateOutput), tail(result.Stderr, maxGateOutput), a.finishMarker()), nil
+	}
+	if len(a.Profile.FinishGates) > 0 {
+		a.log("Finish gates passed.", "INFO", nil, 0)
+	}
+	return "", nil
+}
+
+// tail returns the last n bytes of s, noting what was cut.
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return fmt.Sprintf("[... %d bytes omitted]\n%s", len(s)-n, s[len(s)-n:])
+}
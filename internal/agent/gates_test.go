@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/shalomb/axon/pkg/types"
+)
+
+func TestAgent_Run_FinishGateFeedsBackFailures(t *testing.T) {
+	mLLM := &mockLLM{responses: []string{"All done.\n[[FINISH]]", "<action>go fix</action>", "Fixed.\n[[FINISH]]"}}
+	sb := &mockSandbox{results: []*types.Result{
+		{Stdout: "--- FAIL: TestAdd", Stderr: "exit status 1", ExitCode: 1},
+		{ExitCode: 0},
+		{Stdout: "ok", ExitCode: 0},
+	}}
+	a := New(AgentProfile{Name: "ralph", Role: "role", FinishGates: []string{"just test-unit"}}, mLLM, sb)
+	a.Task = "add numbers"
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if mLLM.calls != 3 || strings.Join(sb.commands, ",") != "just test-unit,go fix,just test-unit" {
+		t.Errorf("unexpected run: %d LLM calls, commands %v", mLLM.calls, sb.commands)
+	}
+	feedback := mLLM.received[1][len(mLLM.received[1])-1].Content
+	for _, want := range []string{"the finish gate `just test-unit` failed with exit code 1 (attempt 1 of 3)", "--- FAIL: TestAdd"} {
+		if !strings.Contains(feedback, want) {
+			t.Errorf("feedback %q missing %q", feedback, want)
+		}
+	}
+}
+
+func TestAgent_Run_FinishGateAttempts(t *testing.T) {
+	mLLM := &mockLLM{responses: repeat("Done.\n[[FINISH]]", 3)}
+	failing := &types.Result{ExitCode: 2}
+	sb := &mockSandbox{results: []*types.Result{failing, failing}}
+	profile := AgentProfile{Name: "ralph", Role: "role", FinishGates: []string{"make test"}, FinishGateAttempts: 2}
+	a := New(profile, mLLM, sb)
+	a.Task = "add numbers"
+
+	err := a.Run(context.Background())
+	if !errors.Is(err, ErrGateFailed) || !strings.Contains(err.Error(), "make test exited 2 on 2 finishes") {
+		t.Fatalf("expected ErrGateFailed, got %v", err)
+	}
+	if mLLM.calls != 2 || a.Result().Reason != FinishGateFailed {
+		t.Errorf("expected the run to end on the second finish, got %d calls, %+v", mLLM.calls, a.Result())
+	}
+}
@@ -0,0 +1,194 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/shalomb/axon/pkg/types"
+)
+
+// ContextProvider supplies context about the run's working directory that
+// is added to the conversation before the task.
+type ContextProvider interface {
+	Name() string
+	Context(ctx context.Context, dir string) (string, error)
+}
+
+// NewContextProvider returns the named provider, as listed in a profile's
+// context_providers.
+func NewContextProvider(name string) (ContextProvider, error) {
+	switch name {
+	case "git":
+		return &GitContext{}, nil
+	case "codeindex":
+		return &CodeIndexContext{}, nil
+	default:
+		return nil, fmt.Errorf("unknown context provider %q", name)
+	}
+}
+
+// Defaults for GitContext.
+const (
+	DefaultMaxDiffBytes = 20_000
+	DefaultCommitCount  = 10
+)
+
+// GitContext summarises the repository: branch, how far it is from the
+// default branch, the diff stat, a truncated diff and recent commits.
+type GitContext struct {
+	Base         string // Branch the diff is taken against; defaults to the default branch
+	MaxDiffBytes int
+	CommitCount  int
+}
+
+// RepoSummary is what GitContext reports about a repository.
+type RepoSummary struct {
+	types.ContextMetadata
+	Branch        string
+	Base          string
+	Ahead, Behind int
+	DiffStat      string
+	Diff          string
+	DiffBytes     int // Size of the whole diff, before truncation
+	Commits       []string
+}
+
+// Name implements ContextProvider.
+func (g *GitContext) Name() string { return "git" }
+
+// Context implements ContextProvider.
+func (g *GitContext) Context(ctx context.Context, dir string) (string, error) {
+	s, err := g.Summarize(dir)
+	if err != nil {
+		return "", err
+	}
+	return s.String(), nil
+}
+
+// Summarize gathers the repository summary for dir.
+func (g *GitContext) Summarize(dir string) (*RepoSummary, error) {
+	branch, err := gitOutput(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	s := &RepoSummary{ContextMetadata: detectProject(dir), Branch: strings.TrimSpace(branch)}
+
+	status, err := gitOutput(dir, "status", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	if changes := strings.Count(status, "\n"); changes > 0 {
+		s.GitStatus = fmt.Sprintf("%d uncommitted changes", changes)
+	} else {
+		s.GitStatus = "clean"
+	}
+
+	s.Base = g.Base
+	if s.Base == "" {
+		s.Base = defaultBranch(dir)
+	}
+	logRange := []string{}
+	if s.Base != "" && s.Base != s.Branch {
+		if counts, err := gitOutput(dir, "rev-list", "--left-right", "--count", s.Base+"...HEAD"); err == nil {
+			if fields := strings.Fields(counts); len(fields) == 2 {
+				s.Behind, _ = strconv.Atoi(fields[0])
+				s.Ahead, _ = strconv.Atoi(fields[1])
+			}
+		}
+		if mergeBase, err := gitOutput(dir, "merge-base", "HEAD", s.Base); err == nil {
+			mergeBase = strings.TrimSpace(mergeBase)
+			s.DiffStat, _ = gitOutput(dir, "diff", "--stat", mergeBase)
+			s.Diff, _ = gitOutput(dir, "diff", mergeBase)
+			logRange = append(logRange, mergeBase+"..HEAD")
+		}
+	} else {
+		// On the default branch: what's uncommitted.
+		s.DiffStat, _ = gitOutput(dir, "diff", "--stat", "HEAD")
+		s.Diff, _ = gitOutput(dir, "diff", "HEAD")
+	}
+	s.DiffStat = strings.TrimRight(s.DiffStat, "\n")
+	s.DiffBytes = len(s.Diff)
+	maxDiff := g.MaxDiffBytes
+	if maxDiff <= 0 {
+		maxDiff = DefaultMaxDiffBytes
+	}
+	s.Diff = string(cutText([]byte(s.Diff), maxDiff))
+
+	commitCount := g.CommitCount
+	if commitCount <= 0 {
+		commitCount = DefaultCommitCount
+	}
+	args := append([]string{"log", "--oneline", "-n", strconv.Itoa(commitCount)}, logRange...)
+	if commits, err := gitOutput(dir, args...); err == nil {
+		for _, c := range strings.Split(strings.TrimSpace(commits), "\n") {
+			if c != "" {
+				s.Commits = append(s.Commits, c)
+			}
+		}
+	}
+	return s, nil
+}
+
+// String renders the summary for the model.
+func (s *RepoSummary) String() string {
+	var b strings.Builder
+	b.WriteString("REPOSITORY CONTEXT:\n")
+	if meta := formatContext(s.ContextMetadata); meta != "" {
+		b.WriteString(meta + "\n")
+	}
+	fmt.Fprintf(&b, "Branch: %s", s.Branch)
+	if s.Base != "" && s.Base != s.Branch {
+		fmt.Fprintf(&b, " (%d ahead, %d behind %s)", s.Ahead, s.Behind, s.Base)
+	}
+	b.WriteString("\n")
+
+	if len(s.Commits) > 0 {
+		b.WriteString("\nRecent commits:\n")
+		for _, c := range s.Commits {
+			b.WriteString("- " + c + "\n")
+		}
+	}
+	if s.DiffStat != "" {
+		b.WriteString("\nDiff stat:\n" + s.DiffStat + "\n")
+	}
+	if s.Diff != "" {
+		b.WriteString("\nDiff:\n```diff\n" + strings.TrimRight(s.Diff, "\n") + "\n```\n")
+		if len(s.Diff) < s.DiffBytes {
+			fmt.Fprintf(&b, "[... diff truncated: showing %d of %d bytes]\n", len(s.Diff), s.DiffBytes)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// projectMarkers identify a project's type, build tool and test framework
+// from files at its root, in order of precedence.
+var projectMarkers = []struct {
+	file string
+	meta types.ContextMetadata
+}{
+	{"go.mod", types.ContextMetadata{ProjectType: "go", BuildTool: "go", TestFramework: "go test"}},
+	{"Cargo.toml", types.ContextMetadata{ProjectType: "rust", BuildTool: "cargo", TestFramework: "cargo test"}},
+	{"package.json", types.ContextMetadata{ProjectType: "node", BuildTool: "npm", TestFramework: "npm test"}},
+	{"pyproject.toml", types.ContextMetadata{ProjectType: "python", BuildTool: "pip", TestFramework: "pytest"}},
+}
+
+func detectProject(dir string) types.ContextMetadata {
+	var meta types.ContextMetadata
+	for _, m := range projectMarkers {
+		if _, err := os.Stat(filepath.Join(dir, m.file)); err == nil {
+			meta = m.meta
+			break
+		}
+	}
+	for _, f := range []string{"Justfile", "justfile"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err == nil {
+			meta.BuildTool = "just"
+			break
+		}
+	}
+	return meta
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/shalomb/springfield/internal/config"
+)
+
+func TestGitContext_Summarize(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := t.TempDir()
+	git(t, root, "init", "-q", "-b", "main")
+	writeFiles(t, root, map[string]string{"go.mod": "module x\n", "a.go": "package x\n"})
+	git(t, root, "add", ".")
+	git(t, root, "commit", "-q", "-m", "initial")
+
+	git(t, root, "checkout", "-q", "-b", "feature")
+	writeFiles(t, root, map[string]string{"a.go": "package x\n\nfunc A() {}\n" + strings.Repeat("// padding\n", 50)})
+	git(t, root, "commit", "-q", "-am", "add A")
+	writeFiles(t, root, map[string]string{"b.go": "package x\n"})
+
+	s, err := (&GitContext{MaxDiffBytes: 200}).Summarize(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Branch != "feature" || s.Base != "main" || s.Ahead != 1 || s.Behind != 0 {
+		t.Errorf("unexpected branch info: %+v", s)
+	}
+	if s.ProjectType != "go" || s.GitStatus != "1 uncommitted changes" {
+		t.Errorf("unexpected metadata: %+v", s.ContextMetadata)
+	}
+	if len(s.Commits) != 1 || !strings.HasSuffix(s.Commits[0], "add A") {
+		t.Errorf("unexpected commits: %v", s.Commits)
+	}
+	// The diff is cut at the end of a line.
+	if !strings.Contains(s.DiffStat, "a.go") || len(s.Diff) > 200 || len(s.Diff) < 100 ||
+		!strings.HasSuffix(s.Diff, "\n") || s.DiffBytes <= 200 {
+		t.Errorf("unexpected diff (%d of %d bytes), stat %q", len(s.Diff), s.DiffBytes, s.DiffStat)
+	}
+
+	out := s.String()
+	for _, want := range []string{
+		"Project type: go, Build tool: go, Test framework: go test, Git status: 1 uncommitted changes",
+		"Branch: feature (1 ahead, 0 behind main)",
+		fmt.Sprintf("[... diff truncated: showing %d of", len(s.Diff)),
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("summary missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestGitContext_NotARepository(t *testing.T) {
+	if _, err := (&GitContext{}).Context(context.Background(), t.TempDir()); err == nil {
+		t.Error("expected an error outside a git repository")
+	}
+}
+
+func TestProfileFromConfig_ContextProviders(t *testing.T) {
+	profile, err := ProfileFromConfig("bart", config.BuiltinAgent("bart"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profile.ContextProviders) != 1 || profile.ContextProviders[0].Name() != "git" {
+		t.Errorf("expected bart to get the git provider, got %v", profile.ContextProviders)
+	}
+
+	cfg := config.AgentConfig{Role: "Reviewer", ContextProviders: []string{"jira"}}
+	if _, err := ProfileFromConfig("reviewer", cfg); err == nil {
+		t.Error("expected an unknown provider to be rejected")
+	}
+}
+
+// dirProvider records the directory it was asked about.
+type dirProvider struct{ dir string }
+
+func (p *dirProvider) Name() string { return "dir" }
+
+func (p *dirProvider) Context(_ context.Context, dir string) (string, error) {
+	p.dir = dir
+	return "dir context", nil
+}
+
+func TestAgent_Run_ContextFromWorktree(t *testing.T) {
+	worktree := t.TempDir()
+	writeFiles(t, worktree, map[string]string{"NOTES.md": "worktree notes"})
+	provider := &dirProvider{}
+	mLLM := &mockLLM{responses: []string{"Done.\n[[FINISH]]"}}
+	a := New(AgentProfile{Name: "bart", Role: "role", ContextFiles: []string{"NOTES.md"},
+		ContextProviders: []ContextProvider{provider}}, mLLM, &mockSandbox{})
+	a.Task = "review"
+	a.Worktree = worktree
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if provider.dir != worktree {
+		t.Errorf("expected the provider to be given the worktree %q, got %q", worktree, provider.dir)
+	}
+	var sent strings.Builder
+	for _, m := range mLLM.received[0] {
+		sent.WriteString(m.Content)
+	}
+	if !strings.Contains(sent.String(), "worktree notes") {
+		t.Errorf("expected context files to be read from the worktree, got %q", sent.String())
+	}
+}
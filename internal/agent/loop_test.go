@@ -59,7 +59,7 @@ func TestAgent_Run_SandboxMaxRetriesReached(t *testing.T) {
 	}}
 	a := New(AgentProfile{Name: "agent", Role: "role"}, mLLM, mSB)
 	a.Task = "task"
-	a.MaxRetries = 2
+	a.ActionRetries = 2
 
 	err := a.Run(context.Background())
 	if err == nil {
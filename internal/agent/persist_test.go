@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAgent_Run_PersistsOutput(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "PLAN.md")
+	mLLM := &mockLLM{responses: []string{"<thought>plan it</thought>\n# Plan\n- step one\n[[FINISH]]"}}
+	a := New(AgentProfile{Name: "lisa", Role: "role", OutputTarget: target}, mLLM, &mockSandbox{})
+	a.Task = "plan"
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+
+	got, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("output not written: %v", err)
+	}
+	if string(got) != "# Plan\n- step one" {
+		t.Errorf("unexpected output: %q", got)
+	}
+}
+
+func TestAgent_Run_PersistedOutputIsRedacted(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "FEEDBACK.md")
+	secret := "sk-ant-REDACTED"
+	mLLM := &mockLLM{responses: []string{"Found a leaked key in config: " + secret + "\n[[FINISH]]"}}
+	a := New(AgentProfile{Name: "bart", Role: "role", OutputTarget: target}, mLLM, &mockSandbox{})
+	a.Task = "review"
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+
+	got, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("output not written: %v", err)
+	}
+	if strings.Contains(string(got), secret) {
+		t.Errorf("secret persisted to %s: %q", target, got)
+	}
+}
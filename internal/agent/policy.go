@@ -0,0 +1,428 @@
+package agent
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/google/shlex"
+)
+
+// riskyActionRule flags an action that is allowed to run but has consequences
+// a human may want to confirm first (history rewrites, merges, deletions).
+type riskyActionRule struct {
+	pattern *regexp.Regexp
+	reason  string
+}
+
+// riskyActionRules cover commands other than git, whose subcommands are
+// classified by gitRisk.
+var riskyActionRules = []riskyActionRule{
+	{regexp.MustCompile(`\bgh\s+pr\s+merge\b`), "merges a pull request"},
+	{regexp.MustCompile(`\brm\s+(-\w*[rRf]\w*\s+)+`), "deletes files recursively or forcibly"},
+	{regexp.MustCompile(`\btd\s+(close|delete)\b`), "closes planning items"},
+	{regexp.MustCompile(`\bsudo\b`), "escalates privileges"},
+}
+
+// riskyGitSubcommands are risky whatever their arguments.
+var riskyGitSubcommands = map[string]string{
+	"merge":  "merges a branch",
+	"pull":   "merges from a remote",
+	"push":   "pushes to a remote",
+	"rebase": "rewrites branch history",
+	"clean":  "deletes untracked files",
+}
+
+// gitValueOptions are git's global options that take their value as the
+// next argument.
+var gitValueOptions = map[string]bool{
+	"-C": true, "-c": true, "--git-dir": true, "--work-tree": true,
+	"--namespace": true, "--config-env": true, "--super-prefix": true,
+}
+
+// classifyAction reports whether an action is risky according to the policy
+// and, if so, why. Unsafe actions are handled separately by isUnsafeAction.
+func classifyAction(action string) (risky bool, reason string) {
+	if reason := gitRisk(action); reason != "" {
+		return true, reason
+	}
+	for _, rule := range riskyActionRules {
+		if rule.pattern.MatchString(action) {
+			return true, rule.reason
+		}
+	}
+	return false, ""
+}
+
+// gitRisk finds the git commands in an action and returns why the first
+// risky one is risky. Global options such as -C, -c and --git-dir are
+// skipped to reach the subcommand.
+func gitRisk(action string) string {
+	words, err := shlex.Split(action)
+	if err != nil {
+		words = strings.Fields(action)
+	}
+	for i := 0; i < len(words); i++ {
+		if path.Base(words[i]) != "git" {
+			continue
+		}
+		j := i + 1
+		for j < len(words) && strings.HasPrefix(words[j], "-") {
+			if gitValueOptions[words[j]] {
+				j++
+			}
+			j++
+		}
+		if j >= len(words) {
+			return ""
+		}
+		sub, args, _ := commandArgs(words[j:])
+		if reason := gitSubcommandRisk(sub, args); reason != "" {
+			return reason
+		}
+		i = j
+	}
+	return ""
+}
+
+// gitSubcommandRisk says why a git subcommand with the given arguments is
+// risky, or returns "".
+func gitSubcommandRisk(sub string, args []string) string {
+	if reason, ok := riskyGitSubcommands[sub]; ok {
+		return reason
+	}
+	switch sub {
+	case "reset":
+		if hasArg(args, "--hard") {
+			return "discards local changes"
+		}
+	case "branch", "tag":
+		if hasArg(args, "-d", "-D", "--delete") {
+			return "deletes a ref"
+		}
+	}
+	return ""
+}
+
+func hasArg(args []string, want ...string) bool {
+	for _, a := range args {
+		for _, w := range want {
+			if a == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// commandArgs splits a command's name and arguments from the words that
+// follow the shell operator ending it.
+func commandArgs(words []string) (name string, args, rest []string) {
+	var cmd []string
+	rest = words
+	for len(rest) > 0 {
+		w := rest[0]
+		rest = rest[1:]
+		if w == "&&" || w == "||" || w == ";" || w == "|" || w == "&" {
+			break
+		}
+		trimmed := strings.TrimRight(w, ";&|")
+		cmd = append(cmd, trimmed)
+		if trimmed != w {
+			break
+		}
+	}
+	if len(cmd) == 0 {
+		return "", nil, rest
+	}
+	return cmd[0], cmd[1:], rest
+}
+
+// readOnlyCommands are the programs a read-only agent may run, with the
+// subcommands allowed for those that have them (nil allows any).
+var readOnlyCommands = map[string][]string{
+	"cat": nil, "cd": nil, "cut": nil, "diff": nil, "dirname": nil, "basename": nil,
+	"du": nil, "echo": nil, "file": nil, "find": nil, "grep": nil, "head": nil,
+	"jq": nil, "ls": nil, "pwd": nil, "realpath": nil, "rg": nil, "sed": nil,
+	"sort": nil, "stat": nil, "tail": nil, "tree": nil, "true": nil, "uniq": nil,
+	"wc": nil, "which": nil,
+	"git": {"blame", "diff", "grep", "log", "ls-files", "ls-tree", "rev-parse", "show", "status"},
+	"go":  {"doc", "env", "list", "version"},
+	"td":  {"list", "query", "ready", "show", "status", "usage"},
+}
+
+// writingFlags are the options that make a read-only program, or one of its
+// subcommands ("go env"), write files or run other programs. For git they
+// are the options before the subcommand.
+var writingFlags = map[string][]string{
+	"file":     {"-C", "--compile"},
+	"find":     {"-delete", "-exec", "-execdir", "-ok", "-okdir", "-fprint", "-fprint0", "-fprintf", "-fls"},
+	"rg":       {"--pre", "--hostname-bin"},
+	"sort":     {"-o", "--output", "--compress-program"},
+	"tree":     {"-o", "-R"},
+	"git":      {"-c", "--config-env", "--exec-path"},
+	"git diff": {"--output", "--ext-diff"},
+	"git grep": {"-O", "--open-files-in-pager"},
+	"git log":  {"--output", "--ext-diff"},
+	"git show": {"--output", "--ext-diff"},
+	"go env":   {"-w", "-u"},
+	"go list":  {"-toolexec", "-compiled", "-export", "-mod"},
+}
+
+// hasFlag reports whether arg sets flag: exactly, as "flag=value", or for a
+// one-letter flag among combined letters ("-ro") or with its value attached
+// ("-oFILE").
+func hasFlag(arg, flag string) bool {
+	if arg == flag || strings.HasPrefix(arg, flag+"=") {
+		return true
+	}
+	return len(flag) == 2 && len(arg) > 2 && arg[0] == '-' && arg[1] != '-' && strings.Contains(arg[1:], flag[1:])
+}
+
+// isReadOnlyAction reports whether every command in an action only reads:
+// no redirections or substitutions, and each program, subcommand and flag is
+// known not to write or run anything else.
+func isReadOnlyAction(action string) bool {
+	words, ok := shellWords(action)
+	if !ok || len(words) == 0 {
+		return false
+	}
+	start := 0
+	for i := 0; i <= len(words); i++ {
+		if i < len(words) && !shellOperators[words[i]] {
+			continue
+		}
+		if i == start || !readOnlyCommand(path.Base(words[start]), words[start+1:i]) {
+			return false
+		}
+		start = i + 1
+	}
+	return true
+}
+
+var shellOperators = map[string]bool{";": true, "&": true, "|": true, "&&": true, "||": true}
+
+// shellWords splits an action into words and the control operators between
+// them, honouring quotes. It refuses anything that could run or write more
+// than the words show: redirections, substitutions, subshells and newlines.
+func shellWords(action string) ([]string, bool) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	flush := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	for i := 0; i < len(action); i++ {
+		c := action[i]
+		switch {
+		case c == '\'':
+			end := strings.IndexByte(action[i+1:], '\'')
+			if end < 0 {
+				return nil, false
+			}
+			word.WriteString(action[i+1 : i+1+end])
+			inWord = true
+			i += end + 1
+		case c == '"':
+			inWord = true
+			for i++; i < len(action) && action[i] != '"'; i++ {
+				switch {
+				case action[i] == '`', action[i] == '$' && i+1 < len(action) && action[i+1] == '(':
+					return nil, false
+				case action[i] == '\\' && i+1 < len(action) && strings.IndexByte("$`\"\\", action[i+1]) >= 0:
+					i++
+				}
+				word.WriteByte(action[i])
+			}
+			if i >= len(action) {
+				return nil, false
+			}
+		case c == '\\' && i+1 < len(action) && action[i+1] != '\n':
+			i++
+			word.WriteByte(action[i])
+			inWord = true
+		case c == ' ' || c == '\t':
+			flush()
+		case c == ';' || c == '&' || c == '|':
+			flush()
+			op := string(c)
+			if c != ';' && i+1 < len(action) && action[i+1] == c {
+				op += op
+				i++
+			}
+			words = append(words, op)
+		case strings.IndexByte("<>()`\n\\", c) >= 0, c == '$' && i+1 < len(action) && action[i+1] == '(':
+			return nil, false
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	flush()
+	return words, true
+}
+
+func readOnlyCommand(name string, args []string) bool {
+	subcommands, ok := readOnlyCommands[name]
+	if !ok {
+		return false
+	}
+	i := 0
+	if name == "git" {
+		for i < len(args) && strings.HasPrefix(args[i], "-") {
+			if gitValueOptions[args[i]] {
+				i++
+			}
+			i++
+		}
+	}
+	if subcommands != nil {
+		if i >= len(args) || !contains(subcommands, args[i]) {
+			return false
+		}
+	}
+
+	global := args
+	if name == "git" {
+		global = args[:i]
+	}
+	if anyFlag(global, writingFlags[name]) ||
+		subcommands != nil && anyFlag(args[i+1:], writingFlags[name+" "+args[i]]) {
+		return false
+	}
+
+	switch name {
+	case "sed":
+		return readOnlySed(args)
+	case "uniq":
+		// A second operand is the file uniq writes to.
+		return len(operands(args)) <= 1
+	}
+	return true
+}
+
+func anyFlag(args, flags []string) bool {
+	for _, a := range args {
+		for _, flag := range flags {
+			if hasFlag(a, flag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// operands returns the arguments that aren't options.
+func operands(args []string) []string {
+	var out []string
+	for i, a := range args {
+		if a == "--" {
+			return append(out, args[i+1:]...)
+		}
+		if a == "-" || !strings.HasPrefix(a, "-") {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// readOnlySed accepts sed invocations that only print: options that don't
+// edit in place or read a script file, and scripts readOnlySedScript allows.
+func readOnlySed(args []string) bool {
+	var scripts []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "-e" || a == "--expression":
+			if i+1 >= len(args) {
+				return false
+			}
+			i++
+			scripts = append(scripts, args[i])
+		case strings.HasPrefix(a, "--expression="):
+			scripts = append(scripts, strings.TrimPrefix(a, "--expression="))
+		case strings.HasPrefix(a, "-e") && !strings.HasPrefix(a, "--"):
+			scripts = append(scripts, a[2:])
+		case a == "--quiet", a == "--silent", a == "--regexp-extended", a == "--separate",
+			a == "--null-data", a == "--posix", a == "--debug", a == "--unbuffered":
+		case strings.HasPrefix(a, "-") && len(a) > 1 && !strings.HasPrefix(a, "--"):
+			if strings.Trim(a[1:], "nErsuz") != "" {
+				return false
+			}
+		case strings.HasPrefix(a, "-") && len(a) > 1:
+			return false
+		case len(scripts) == 0:
+			scripts = append(scripts, a)
+		}
+	}
+	if len(scripts) == 0 {
+		return false
+	}
+	for _, script := range scripts {
+		if !readOnlySedScript(script) {
+			return false
+		}
+	}
+	return true
+}
+
+// readOnlySedScript reports whether a sed script only selects and prints
+// lines: addresses, the commands p, l, =, d, q, n, N, P, D, g, G, h, H, x and
+// braces, and s commands without the w or e flags. Anything else, including
+// the w, W, e, r and R commands, is refused.
+func readOnlySedScript(script string) bool {
+	for i := 0; i < len(script); {
+		c := script[i]
+		switch {
+		case strings.IndexByte(" \t\n;!,$~+0123456789", c) >= 0:
+			i++
+		case strings.IndexByte("pl=dqnNPDgGhHx{}", c) >= 0:
+			i++
+		case c == '/':
+			if i = skipDelimited(script, i+1, '/'); i < 0 {
+				return false
+			}
+		case c == 's' && i+1 < len(script) && script[i+1] != '\\' && script[i+1] != '\n':
+			delim := script[i+1]
+			if i = skipDelimited(script, i+2, delim); i < 0 {
+				return false
+			}
+			if i = skipDelimited(script, i, delim); i < 0 {
+				return false
+			}
+			for i < len(script) && strings.IndexByte("gpiIm0123456789", script[i]) >= 0 {
+				i++
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// skipDelimited returns the index just past the next unescaped delim from
+// i, or -1 if there isn't one.
+func skipDelimited(s string, i int, delim byte) int {
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case delim:
+			return i + 1
+		}
+	}
+	return -1
+}
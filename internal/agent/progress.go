@@ -0,0 +1,170 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shalomb/springfield/internal/llm"
+)
+
+// Progress renders the live state of an LLM call so long generations don't
+// look like a hang.
+type Progress interface {
+	Start(label string)
+	Event(ev llm.StreamEvent)
+	Done(summary string)
+}
+
+// NewProgress returns a spinner line when w is a terminal and a plain
+// line-per-event log otherwise, e.g. when output is piped to a file or the
+// orchestrator.
+func NewProgress(w io.Writer) Progress {
+	if f, ok := w.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			return &ttyProgress{w: w}
+		}
+	}
+	return &lineProgress{w: w}
+}
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// ttyProgress redraws a single status line: spinner, elapsed time, characters
+// received and the tail of the latest output.
+type ttyProgress struct {
+	w io.Writer
+
+	mu      sync.Mutex
+	label   string
+	start   time.Time
+	frame   int
+	chars   int
+	last    string
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func (p *ttyProgress) Start(label string) {
+	p.mu.Lock()
+	p.label = label
+	p.start = time.Now()
+	p.chars = 0
+	p.last = "waiting for model"
+	p.stop = make(chan struct{})
+	p.stopped = make(chan struct{})
+	p.mu.Unlock()
+
+	go func() {
+		defer close(p.stopped)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.mu.Lock()
+				p.redraw()
+				p.mu.Unlock()
+			}
+		}
+	}()
+}
+
+func (p *ttyProgress) Event(ev llm.StreamEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch ev.Type {
+	case llm.StreamText:
+		p.chars += len(ev.Text)
+		p.last = lastLine(p.last + ev.Text)
+	case llm.StreamThinking:
+		p.last = "thinking…"
+	case llm.StreamTool:
+		p.last = "tool: " + ev.Text
+	}
+	p.redraw()
+}
+
+func (p *ttyProgress) Done(summary string) {
+	if p.stop != nil {
+		close(p.stop)
+		<-p.stopped
+		p.stop = nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.w, "\r\033[K%s %s (%s)\n", p.label, summary, time.Since(p.start).Round(100*time.Millisecond))
+}
+
+// redraw must be called with mu held.
+func (p *ttyProgress) redraw() {
+	p.frame = (p.frame + 1) % len(spinnerFrames)
+	status := fmt.Sprintf("%s %s %s · %d chars · %s", spinnerFrames[p.frame], p.label,
+		time.Since(p.start).Round(time.Second), p.chars, p.last)
+	fmt.Fprintf(p.w, "\r\033[K%s", truncate(status, 100))
+}
+
+// lineProgress writes one line per event. Text deltas are buffered into whole
+// lines so piped output stays readable.
+type lineProgress struct {
+	w     io.Writer
+	label string
+	start time.Time
+	buf   strings.Builder
+}
+
+func (p *lineProgress) Start(label string) {
+	p.label = label
+	p.start = time.Now()
+	p.buf.Reset()
+	fmt.Fprintf(p.w, "%s: waiting for model\n", p.label)
+}
+
+func (p *lineProgress) Event(ev llm.StreamEvent) {
+	switch ev.Type {
+	case llm.StreamText:
+		p.buf.WriteString(ev.Text)
+		text := p.buf.String()
+		if i := strings.LastIndex(text, "\n"); i >= 0 {
+			for _, line := range strings.Split(text[:i], "\n") {
+				fmt.Fprintf(p.w, "%s: %s\n", p.label, line)
+			}
+			p.buf.Reset()
+			p.buf.WriteString(text[i+1:])
+		}
+	case llm.StreamTool:
+		fmt.Fprintf(p.w, "%s: tool %s\n", p.label, ev.Text)
+	}
+}
+
+func (p *lineProgress) Done(summary string) {
+	if p.buf.Len() > 0 {
+		fmt.Fprintf(p.w, "%s: %s\n", p.label, p.buf.String())
+		p.buf.Reset()
+	}
+	fmt.Fprintf(p.w, "%s: %s (%s)\n", p.label, summary, time.Since(p.start).Round(100*time.Millisecond))
+}
+
+func lastLine(s string) string {
+	s = strings.TrimRight(s, "\n")
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		s = s[i+1:]
+	}
+	if len(s) > 200 {
+		s = s[len(s)-200:]
+	}
+	return s
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/shalomb/springfield/internal/llm"
+)
+
+// streamingMockLLM streams each response in two halves.
+type streamingMockLLM struct {
+	mockLLM
+}
+
+func (m *streamingMockLLM) ChatStream(ctx context.Context, messages []llm.Message, onEvent func(llm.StreamEvent)) (llm.Response, error) {
+	resp, err := m.Chat(ctx, messages)
+	if err != nil {
+		return resp, err
+	}
+	half := len(resp.Content) / 2
+	onEvent(llm.StreamEvent{Type: llm.StreamText, Text: resp.Content[:half]})
+	onEvent(llm.StreamEvent{Type: llm.StreamText, Text: resp.Content[half:]})
+	return resp, nil
+}
+
+func TestLineProgress(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewProgress(&buf)
+	if _, ok := p.(*lineProgress); !ok {
+		t.Fatalf("non-terminal writer should get line progress, got %T", p)
+	}
+
+	p.Start("[ralph #1]")
+	p.Event(llm.StreamEvent{Type: llm.StreamText, Text: "first li"})
+	p.Event(llm.StreamEvent{Type: llm.StreamText, Text: "ne\nsecond"})
+	p.Event(llm.StreamEvent{Type: llm.StreamThinking, Text: "hidden"})
+	p.Event(llm.StreamEvent{Type: llm.StreamTool, Text: "bash"})
+	p.Done("42 tokens")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{
+		"[ralph #1]: waiting for model",
+		"[ralph #1]: first line",
+		"[ralph #1]: tool bash",
+		"[ralph #1]: second",
+	}
+	for i, w := range want {
+		if i >= len(lines) || lines[i] != w {
+			t.Fatalf("line %d: got %q, want %q (all output: %q)", i, lines[i], w, buf.String())
+		}
+	}
+	if !strings.HasPrefix(lines[len(lines)-1], "[ralph #1]: 42 tokens (") {
+		t.Errorf("missing summary line: %q", lines[len(lines)-1])
+	}
+}
+
+func TestAgent_Run_StreamsProgress(t *testing.T) {
+	var buf bytes.Buffer
+	sLLM := &streamingMockLLM{mockLLM{responses: []string{"all done [[FINISH]]"}}}
+	a := New(AgentProfile{Name: "ralph", Role: "Build Agent"}, sLLM, &mockSandbox{})
+	a.Task = "task"
+	WithProgress(NewProgress(&buf))(a)
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "[ralph #1]: all done [[FINISH]]") {
+		t.Errorf("streamed text not rendered: %q", buf.String())
+	}
+}
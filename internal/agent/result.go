@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/shalomb/springfield/internal/decision"
+	"github.com/shalomb/springfield/internal/llm"
+)
+
+// Errors a run can end with, besides ErrStalled and ErrGateFailed. Match
+// them with errors.Is.
+var (
+	// ErrMaxIterations is returned when the agent doesn't finish within its
+	// iteration limit.
+	ErrMaxIterations = errors.New("max iterations reached")
+	// ErrBudgetExceeded is returned when the session uses more tokens than
+	// its budget.
+	ErrBudgetExceeded = errors.New("session budget exceeded")
+	// ErrActionBlocked is returned when the agent's actions keep being
+	// blocked or denied, or an approval can't be requested.
+	ErrActionBlocked = errors.New("action blocked")
+	// ErrQuotaExceeded is returned when the LLM provider's quota is
+	// exhausted. Retrying won't help until it is topped up.
+	ErrQuotaExceeded = errors.New("API quota exceeded")
+)
+
+// maxBlockedActions is how many blocked or denied actions in a row end the
+// run with ErrActionBlocked.
+const maxBlockedActions = 5
+
+// FinishReason says why a run ended.
+type FinishReason string
+
+const (
+	FinishCompleted      FinishReason = "completed"
+	FinishMaxIterations  FinishReason = "max_iterations"
+	FinishBudgetExceeded FinishReason = "budget_exceeded"
+	FinishStalled        FinishReason = "stalled"
+	FinishActionBlocked  FinishReason = "action_blocked"
+	FinishGateFailed     FinishReason = "gate_failed"
+	FinishQuotaExceeded  FinishReason = "quota_exceeded"
+	FinishCanceled       FinishReason = "canceled"
+	FinishError          FinishReason = "error"
+)
+
+// ReasonFor classifies the error a run ended with.
+func ReasonFor(err error) FinishReason {
+	switch {
+	case err == nil:
+		return FinishCompleted
+	case errors.Is(err, ErrMaxIterations):
+		return FinishMaxIterations
+	case errors.Is(err, ErrBudgetExceeded):
+		return FinishBudgetExceeded
+	case errors.Is(err, ErrStalled):
+		return FinishStalled
+	case errors.Is(err, ErrActionBlocked):
+		return FinishActionBlocked
+	case errors.Is(err, ErrGateFailed):
+		return FinishGateFailed
+	case errors.Is(err, ErrQuotaExceeded), llm.IsQuotaExceededError(err):
+		return FinishQuotaExceeded
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return FinishCanceled
+	default:
+		return FinishError
+	}
+}
+
+// RunResult describes how a run went.
+type RunResult struct {
+	Reason          FinishReason
+	Err             error // The error Run returned, nil on completion
+	Iterations      int   // LLM turns taken
+	TotalTokens     int
+	Cost            float64
+	ActionsExecuted int                // Actions run in the sandbox
+	ToolCalls       int                // Tool calls made, successful or not
+	Critiques       int                // Revisions the critic asked for
+	OutputWritten   string             // Path the output was persisted to, if any
+	Decision        *decision.Decision // The decision the agent finished with, if any
+}
+
+func (r RunResult) String() string {
+	s := fmt.Sprintf("%s after %d iterations: %d tokens, $%.4f, %d actions, %d tool calls",
+		r.Reason, r.Iterations, r.TotalTokens, r.Cost, r.ActionsExecuted, r.ToolCalls)
+	if r.Critiques > 0 {
+		s += fmt.Sprintf(", %d critiques", r.Critiques)
+	}
+	if r.OutputWritten != "" {
+		s += ", output written to " + r.OutputWritten
+	}
+	if r.Decision != nil {
+		s += ", decision " + r.Decision.Decision
+	}
+	return s
+}
+
+// Result reports how the last run went.
+func (a *Agent) Result() RunResult {
+	return a.result
+}
+
+// finishRun records the run's result once Run returns.
+func (a *Agent) finishRun(err error) {
+	a.result.Reason = ReasonFor(err)
+	a.result.Err = err
+	a.result.TotalTokens = a.TotalUsage
+	a.result.Cost = a.TotalCost
+	a.result.Decision = a.Decision
+	a.logData(fmt.Sprintf("Run finished: %s", a.result), "INFO", nil, 0, map[string]interface{}{
+		"reason":           string(a.result.Reason),
+		"iterations":       a.result.Iterations,
+		"actions_executed": a.result.ActionsExecuted,
+		"tool_calls":       a.result.ToolCalls,
+		"output_written":   a.result.OutputWritten,
+	})
+}
+
+// quotaError marks an LLM error as an exhausted quota while keeping its
+// message.
+type quotaError struct{ err error }
+
+func (e quotaError) Error() string        { return e.err.Error() }
+func (e quotaError) Unwrap() error        { return e.err }
+func (e quotaError) Is(target error) bool { return target == ErrQuotaExceeded }
@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/shalomb/springfield/internal/llm"
+)
+
+func TestAgent_Result_Completed(t *testing.T) {
+	mLLM := &mockLLM{responses: []string{
+		"<action>ls</action>",
+		`<tool name="nope">{}</tool>`,
+		"Done.\n[[FINISH]]",
+	}}
+	target := filepath.Join(t.TempDir(), "out.md")
+	a := New(AgentProfile{Name: "ralph", Role: "role", OutputTarget: target}, mLLM, &mockSandbox{results: okResults(1)})
+	a.Task = "list files"
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	r := a.Result()
+	if r.Reason != FinishCompleted || r.Err != nil || r.Iterations != 3 || r.TotalTokens != 60 ||
+		r.ActionsExecuted != 1 || r.ToolCalls != 1 || r.OutputWritten != target {
+		t.Errorf("unexpected result: %+v", r)
+	}
+}
+
+func TestAgent_Result_Errors(t *testing.T) {
+	quota := &llm.QuotaExceededError{Message: "insufficient_quota"}
+	cases := []struct {
+		name   string
+		setup  func(a *Agent, m *mockLLM)
+		target error
+		reason FinishReason
+	}{
+		{"max iterations", func(a *Agent, m *mockLLM) {
+			m.responses = []string{"Thinking...", "Still thinking."}
+			a.MaxIterations = 2
+		}, ErrMaxIterations, FinishMaxIterations},
+		{"budget", func(a *Agent, m *mockLLM) {
+			m.responses = []string{"Thinking..."}
+			a.Budget = 10
+		}, ErrBudgetExceeded, FinishBudgetExceeded},
+		{"blocked", func(a *Agent, m *mockLLM) {
+			for i := 0; i < maxBlockedActions; i++ {
+				m.responses = append(m.responses, fmt.Sprintf("<action>ls; echo %d</action>", i))
+			}
+		}, ErrActionBlocked, FinishActionBlocked},
+		{"quota", func(a *Agent, m *mockLLM) {
+			m.errors = []error{fmt.Errorf("pi failed: %w", quota)}
+		}, ErrQuotaExceeded, FinishQuotaExceeded},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mLLM := &mockLLM{}
+			a := New(AgentProfile{Name: "ralph", Role: "role"}, mLLM, &mockSandbox{})
+			a.Task = "work"
+			a.StallPolicy = StallPolicy{}
+			c.setup(a, mLLM)
+
+			err := a.Run(context.Background())
+			if !errors.Is(err, c.target) {
+				t.Fatalf("expected %v, got %v", c.target, err)
+			}
+			if r := a.Result(); r.Reason != c.reason || r.Err != err {
+				t.Errorf("unexpected result: %+v", r)
+			}
+		})
+	}
+}
+
+func TestAgent_Result_QuotaKeepsMessage(t *testing.T) {
+	quota := &llm.QuotaExceededError{Message: "insufficient_quota"}
+	a := New(AgentProfile{Name: "ralph", Role: "role"}, &mockLLM{errors: []error{quota}}, &mockSandbox{})
+	err := a.Run(context.Background())
+	if err == nil || err.Error() != quota.Error() || !llm.IsQuotaExceededError(err) {
+		t.Errorf("expected the quota error unchanged, got %v", err)
+	}
+}
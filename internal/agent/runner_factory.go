@@ -7,6 +7,7 @@ import (
 	"github.com/shalomb/springfield/internal/config"
 	"github.com/shalomb/springfield/internal/llm"
 	"github.com/shalomb/springfield/internal/sandbox"
+	"github.com/shalomb/springfield/pkg/redact"
 )
 
 // NewRunner creates a specialized runner based on the agent name.
@@ -14,67 +15,239 @@ func NewRunner(agentName string, task string, llmClient llm.LLMClient) (Runner,
 	return NewRunnerWithBudget(agentName, task, llmClient, nil, 0)
 }
 
+// Option customises an Agent created by the runner factory.
+type Option func(*Agent)
+
+// WithApproval sets the human approval gate. The mode can tighten but never
+// relax the profile's default, so configuration cannot let Lovejoy merge
+// unattended.
+func WithApproval(mode ApprovalMode, approver Approver) Option {
+	return func(a *Agent) {
+		if mode.strictness() > a.Approval.strictness() {
+			a.Approval = mode
+		}
+		a.Approver = approver
+	}
+}
+
+// WithRedactor sets the redactor applied to persisted output.
+func WithRedactor(r *redact.Redactor) Option {
+	return func(a *Agent) {
+		a.Redactor = r
+	}
+}
+
+// WithPricing sets the pricing table used for cost accounting and the
+// configured model, which is charged when a response doesn't name its model.
+func WithPricing(model string, pricing llm.PricingTable) Option {
+	return func(a *Agent) {
+		a.Model = model
+		a.Pricing = pricing
+	}
+}
+
+// WithUsageHook registers a callback invoked with every LLM response's usage.
+func WithUsageHook(hook UsageHook) Option {
+	return func(a *Agent) {
+		a.OnUsage = hook
+	}
+}
+
+// WithRetryPolicy sets how failed LLM calls are retried. A MaxRetries of 0
+// disables retries.
+func WithRetryPolicy(p llm.RetryPolicy) Option {
+	return func(a *Agent) {
+		a.RetryPolicy = p
+	}
+}
+
+// WithProgress renders streaming LLM output as it arrives.
+func WithProgress(p Progress) Option {
+	return func(a *Agent) {
+		a.Progress = p
+	}
+}
+
+// WithDecisions requires the agent to finish with one of the allowed
+// decisions, written to file (if set) for the orchestrator to record.
+func WithDecisions(allowed []string, file string) Option {
+	return func(a *Agent) {
+		a.AllowedDecisions = allowed
+		a.DecisionFile = file
+	}
+}
+
+// WithEpic ties the run to an epic and the worktree it runs in, so every
+// log entry carries the epic.
+func WithEpic(epicID, worktree string) Option {
+	return func(a *Agent) {
+		a.Epic = epicID
+		a.Worktree = worktree
+	}
+}
+
+// WithEscalation sets the model a stalled agent can escalate to.
+func WithEscalation(model string, client llm.LLMClient) Option {
+	return func(a *Agent) {
+		a.EscalationModel = model
+		a.EscalationLLM = client
+	}
+}
+
+// WithCritic sets the client that serves the critic's model. Without one,
+// or without a critic in the profile, the critic reviews with the agent's
+// own client.
+func WithCritic(client llm.LLMClient) Option {
+	return func(a *Agent) {
+		if a.Profile.Critic != nil && client != nil {
+			a.Profile.Critic.LLM = client
+		}
+	}
+}
+
+// WithJudge sets the client that serves the best-of-N judge's model.
+// Without one, the judge uses the agent's own client.
+func WithJudge(client llm.LLMClient) Option {
+	return func(a *Agent) {
+		if a.Profile.Sampling != nil && client != nil {
+			a.Profile.Sampling.Judge = client
+		}
+	}
+}
+
 // NewRunnerWithBudget creates a specialized runner with a specified budget and optional sandbox.
-func NewRunnerWithBudget(agentName string, task string, llmClient llm.LLMClient, sb sandbox.Sandbox, budget int) (Runner, error) {
+// The agent must be one of the built-in agents; see NewRunnerFromConfig.
+func NewRunnerWithBudget(agentName string, task string, llmClient llm.LLMClient, sb sandbox.Sandbox, budget int, opts ...Option) (Runner, error) {
+	agentCfg := config.BuiltinAgent(agentName)
+	agentCfg.Budget = budget
+	return NewRunnerFromConfig(agentName, task, llmClient, sb, agentCfg, opts...)
+}
+
+// NewRunnerFromConfig creates a runner for any agent whose profile is
+// defined in configuration, built-in or custom.
+func NewRunnerFromConfig(agentName string, task string, llmClient llm.LLMClient, sb sandbox.Sandbox, agentCfg config.AgentConfig, opts ...Option) (Runner, error) {
 	normalizedAgent := strings.ToLower(agentName)
 
-	profile, err := GetAgentProfile(normalizedAgent)
+	profile, err := ProfileFromConfig(normalizedAgent, agentCfg)
 	if err != nil {
 		return nil, err
 	}
 
-	// We'll transition to using the unified Agent as the primary Runner
-	// For now, we keep the specialized ones for compatibility if needed,
-	// but the goal is to migrate all to the Agent struct.
-
 	a := New(profile, llmClient, sb)
 	a.Task = task
-	a.Budget = budget
+	a.Budget = agentCfg.Budget
+	a.StallPolicy, err = ParseStallPolicy(agentCfg.StallThreshold, agentCfg.StallResponses)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stall policy for %s: %w", normalizedAgent, err)
+	}
+	a.PromptData.Config = agentCfg
+	for _, opt := range opts {
+		opt(a)
+	}
+	if a.Worktree != "" {
+		// Tools work on the epic's worktree, not wherever the process runs.
+		if a.Profile.Tools, err = NewTools(agentCfg.Tools, a.Worktree); err != nil {
+			return nil, fmt.Errorf("invalid tools for %s: %w", normalizedAgent, err)
+		}
+	}
+
+	// The prompt is rendered last so it sees the epic and worktree.
+	data := a.PromptData
+	if data.Epic == "" {
+		data.Epic = a.Epic
+	}
+	if data.Worktree == "" {
+		data.Worktree = a.Worktree
+	}
+	a.Profile.SystemPrompt, err = renderProfilePrompt(normalizedAgent, agentCfg.Prompt, data)
+	if err != nil {
+		return nil, err
+	}
 
 	return a, nil
 }
 
-// GetAgentProfile returns the profile for a given agent name.
+// GetAgentProfile returns the profile of a built-in agent.
 func GetAgentProfile(agentName string) (AgentProfile, error) {
-	roles := map[string]string{
-		"marge":   "Product Agent",
-		"lisa":    "Planning Agent",
-		"ralph":   "Build Agent",
-		"bart":    "Quality Agent",
-		"lovejoy": "Release Agent",
+	agentCfg := config.BuiltinAgent(agentName)
+	profile, err := ProfileFromConfig(agentName, agentCfg)
+	if err != nil {
+		return AgentProfile{}, err
 	}
+	profile.SystemPrompt, err = renderProfilePrompt(agentName, agentCfg.Prompt, config.PromptData{Config: agentCfg})
+	if err != nil {
+		return AgentProfile{}, err
+	}
+	return profile, nil
+}
 
-	role, ok := roles[agentName]
-	if !ok {
+// ProfileFromConfig builds an agent's profile, without its system prompt,
+// from the agent's configuration. An agent without a role is unknown.
+func ProfileFromConfig(agentName string, agentCfg config.AgentConfig) (AgentProfile, error) {
+	if agentCfg.Role == "" {
 		return AgentProfile{}, fmt.Errorf("unknown agent: %s", agentName)
 	}
-
-	promptPath := config.GetPromptPath(agentName)
-	prompt, err := config.LoadPrompt(promptPath)
+	approval, err := ParseApprovalMode(agentCfg.MinApproval)
 	if err != nil {
-		return AgentProfile{}, fmt.Errorf("failed to load prompt for %s: %w", agentName, err)
+		return AgentProfile{}, fmt.Errorf("invalid min_approval for %s: %w", agentName, err)
 	}
-
-	profile := AgentProfile{
-		Name:         agentName,
-		Role:         role,
-		SystemPrompt: prompt,
+	var providers []ContextProvider
+	for _, name := range agentCfg.ContextProviders {
+		provider, err := NewContextProvider(name)
+		if err != nil {
+			return AgentProfile{}, fmt.Errorf("invalid context_providers for %s: %w", agentName, err)
+		}
+		providers = append(providers, provider)
 	}
-
-	// Specialized profile settings
-	switch agentName {
-	case "lisa":
-		profile.ContextFiles = []string{"PLAN.md", "FEEDBACK.md"}
-		profile.OutputTarget = "PLAN.md"
-	case "ralph":
-		profile.ContextFiles = []string{"TODO.md", "Justfile"}
-		// Ralph handles his own persistence via git/filesystem actions
-	case "bart":
-		profile.ContextFiles = []string{"FEEDBACK.md"}
-		profile.OutputTarget = "FEEDBACK.md"
-	case "lovejoy":
-		profile.ContextFiles = []string{"CHANGELOG.md", "TODO.md", "FEEDBACK.md"}
+	tools, err := NewTools(agentCfg.Tools, ".")
+	if err != nil {
+		return AgentProfile{}, fmt.Errorf("invalid tools for %s: %w", agentName, err)
 	}
+	var critic *Critic
+	if agentCfg.CriticRubric != "" {
+		critic = &Critic{Model: agentCfg.CriticModel, Rubric: agentCfg.CriticRubric, MaxRounds: agentCfg.CriticRounds}
+	}
+	var sampling *Sampling
+	if agentCfg.Samples > 1 {
+		if agentCfg.OutputTarget == "" {
+			return AgentProfile{}, fmt.Errorf("invalid samples for %s: best-of-N needs an output_target", agentName)
+		}
+		sampling, err = NewSampling(agentCfg.Samples, agentCfg.SampleChecks, agentCfg.JudgeRubric, agentCfg.JudgeModel)
+		if err != nil {
+			return AgentProfile{}, fmt.Errorf("invalid sampling for %s: %w", agentName, err)
+		}
+	}
+	return AgentProfile{
+		Name:               agentName,
+		Role:               agentCfg.Role,
+		ContextFiles:       agentCfg.ContextFiles,
+		ContextBudget:      agentCfg.ContextBudget,
+		ContextProviders:   providers,
+		OutputTarget:       agentCfg.OutputTarget,
+		ToolsEnabled:       agentCfg.Tools,
+		Tools:              tools,
+		FinishMarker:       agentCfg.FinishMarker,
+		FinishGates:        agentCfg.FinishGates,
+		FinishGateAttempts: agentCfg.FinishGateAttempts,
+		Critic:             critic,
+		Sampling:           sampling,
+		MaxIterations:      agentCfg.MaxIterations,
+		Approval:           approval,
+	}, nil
+}
 
-	return profile, nil
+// renderProfilePrompt renders the prompt a profile names, or the agent's
+// prompt_<agent>.md.
+func renderProfilePrompt(agentName, prompt string, data config.PromptData) (string, error) {
+	if data.Agent == "" {
+		data.Agent = agentName
+	}
+	if prompt == "" {
+		prompt = "prompt_" + agentName + ".md"
+	}
+	rendered, err := config.RenderPromptFile(prompt, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to load prompt for %s: %w", agentName, err)
+	}
+	return rendered, nil
 }
@@ -4,6 +4,8 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/shalomb/springfield/internal/config"
 )
 
 func setupPromptFiles(t *testing.T, tmpDir string) {
@@ -94,3 +96,62 @@ func TestNewRunnerWithBudgetSetsBudget(t *testing.T) {
 		t.Errorf("Expected budget %d, got %d", budget, a.Budget)
 	}
 }
+
+// TestNewRunnerFromConfigCustomAgent verifies an agent defined only in
+// configuration gets its profile and prompt from there.
+func TestNewRunnerFromConfigCustomAgent(t *testing.T) {
+	tmpDir := t.TempDir()
+	origDir, _ := os.Getwd()
+	defer func() { _ = os.Chdir(origDir) }()
+	_ = os.Chdir(tmpDir)
+	promptDir := filepath.Join(tmpDir, ".springfield", "prompts")
+	_ = os.MkdirAll(promptDir, 0755)
+	_ = os.WriteFile(filepath.Join(promptDir, "security.md"), []byte("You are {{.Agent}}, reviewing with {{.Config.Model}}."), 0644)
+
+	cfg := config.AgentConfig{
+		Role:          "Security Reviewer",
+		Prompt:        "security.md",
+		Model:         "anthropic/claude-opus-4-1",
+		ContextFiles:  []string{"SECURITY.md"},
+		OutputTarget:  "SECURITY-REVIEW.md",
+		FinishMarker:  "[[DONE]]",
+		MaxIterations: 7,
+		MinApproval:   "always",
+		Budget:        500,
+		CriticRubric:  "No secrets in logs.",
+		CriticModel:   "openai/gpt-4o",
+	}
+	criticLLM := &mockLLM{}
+	runner, err := NewRunnerFromConfig("Security", "review", &mockLLM{}, nil, cfg,
+		WithApproval(ApprovalNever, nil), WithCritic(criticLLM))
+	if err != nil {
+		t.Fatalf("NewRunnerFromConfig() returned error: %v", err)
+	}
+
+	a := runner.(*Agent)
+	if a.Profile.Name != "security" || a.Profile.Role != "Security Reviewer" {
+		t.Errorf("unexpected profile: %+v", a.Profile)
+	}
+	if a.Profile.SystemPrompt != "You are security, reviewing with anthropic/claude-opus-4-1." {
+		t.Errorf("unexpected prompt: %q", a.Profile.SystemPrompt)
+	}
+	if a.Profile.OutputTarget != "SECURITY-REVIEW.md" || a.Profile.FinishMarker != "[[DONE]]" || len(a.Profile.ContextFiles) != 1 {
+		t.Errorf("profile fields not applied: %+v", a.Profile)
+	}
+	if c := a.Profile.Critic; c == nil || c.Rubric != "No secrets in logs." || c.Model != "openai/gpt-4o" || c.LLM != criticLLM {
+		t.Errorf("critic not applied: %+v", c)
+	}
+	if a.MaxIterations != 7 || a.Budget != 500 {
+		t.Errorf("MaxIterations = %d, Budget = %d; want 7, 500", a.MaxIterations, a.Budget)
+	}
+	if a.Approval != ApprovalAlways {
+		t.Errorf("config must not relax the profile's approval floor, got %q", a.Approval)
+	}
+
+	if _, err := ProfileFromConfig("planner", config.AgentConfig{Role: "Planner", Samples: 3}); err == nil {
+		t.Error("expected best-of-N without an output target to be rejected")
+	}
+	if _, err := NewRunnerFromConfig("nobody", "task", &mockLLM{}, nil, config.AgentConfig{}); err == nil {
+		t.Error("expected an agent without a role to be rejected")
+	}
+}
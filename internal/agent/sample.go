@@ -0,0 +1,303 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/shalomb/springfield/internal/decision"
+	"github.com/shalomb/springfield/internal/llm"
+)
+
+// Sampling has an agent with an output target generate N candidate outputs
+// concurrently and keep the best. Candidates are scored by how many Checks
+// match them; a judge picks among the top scorers when there is a Rubric,
+// otherwise the first of them wins.
+//
+// Candidates share the sandbox and the worktree, so they are read-only: tools
+// that write are withheld and only actions isReadOnlyAction accepts run. Their
+// final responses are their only output.
+type Sampling struct {
+	N          int
+	Checks     []*regexp.Regexp
+	Rubric     string
+	Judge      llm.LLMClient // nil judges with the agent's own client
+	JudgeModel string        // Model Judge serves, for pricing and logs
+}
+
+// NewSampling builds a sampling configuration, compiling the checks.
+func NewSampling(n int, checks []string, rubric, judgeModel string) (*Sampling, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("invalid samples %d", n)
+	}
+	s := &Sampling{N: n, Rubric: rubric, JudgeModel: judgeModel}
+	for _, check := range checks {
+		re, err := regexp.Compile(check)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sample check %q: %w", check, err)
+		}
+		s.Checks = append(s.Checks, re)
+	}
+	return s, nil
+}
+
+const judgePrompt = `You are judging candidate outputs that other agents wrote for the same task.
+Compare them against every point of the rubric and the task. Reply with
+<winner>N</winner>, where N is the number of the best candidate, followed by a
+short justification.`
+
+var winnerRegex = regexp.MustCompile(`(?i)<winner>\s*(\d+)\s*</winner>`)
+
+const readOnlyFeedback = "Action blocked: you are one of several candidates sharing this workspace, so you may only run read-only commands (ls, cat, grep, find, git log/diff/show/status, ...) without redirections. Put your work in your final response instead."
+
+// candidate is one sampled run.
+type candidate struct {
+	n     int // 1-based
+	agent *Agent
+	err   error
+	score int
+}
+
+// sampling reports whether the agent runs best-of-N.
+func (a *Agent) sampling() bool {
+	return a.Profile.Sampling != nil && a.Profile.Sampling.N > 1 && a.Profile.OutputTarget != ""
+}
+
+// runBestOfN runs the agent's task as N concurrent candidates, writes the
+// winner to the output target and the rest alongside it for audit. Each
+// candidate gets an equal share of the budget; the judge only runs while
+// some of it is left.
+func (a *Agent) runBestOfN(ctx context.Context) error {
+	s := a.Profile.Sampling
+	a.logData(fmt.Sprintf("Sampling %d candidates", s.N), "INFO", nil, 0, map[string]interface{}{"samples": s.N})
+
+	var usageMu, approvalMu sync.Mutex
+	candidates := make([]*candidate, s.N)
+	var wg sync.WaitGroup
+	for i := range candidates {
+		c := &candidate{n: i + 1, agent: a.sampleAgent(i+1, &usageMu, &approvalMu)}
+		candidates[i] = c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.err = c.agent.Run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	var done []*candidate
+	var firstErr error
+	for _, c := range candidates {
+		a.addUsage(c.agent)
+		if c.err != nil {
+			a.log(fmt.Sprintf("Candidate %d failed: %v", c.n, c.err), "WARNING", nil, 0)
+			if firstErr == nil {
+				firstErr = c.err
+			}
+			continue
+		}
+		done = append(done, c)
+	}
+	if len(done) == 0 {
+		return fmt.Errorf("all %d candidates failed: %w", s.N, firstErr)
+	}
+
+	winner := a.pickWinner(ctx, done)
+
+	var saved []string
+	for _, c := range done {
+		if c == winner {
+			continue
+		}
+		path := candidatePath(a.Profile.OutputTarget, c.n)
+		if err := os.WriteFile(path, []byte(a.Redactor.Redact(c.agent.output)), 0644); err != nil {
+			return fmt.Errorf("saving candidate %d: %w", c.n, err)
+		}
+		saved = append(saved, path)
+	}
+	a.logData(fmt.Sprintf("Candidate %d of %d won", winner.n, s.N), "INFO", nil, 0,
+		map[string]interface{}{"winner": winner.n, "candidates": saved})
+
+	if d := winner.agent.Decision; d != nil {
+		a.Decision = d
+		if a.DecisionFile != "" {
+			if err := decision.Write(a.DecisionFile, d); err != nil {
+				a.log(fmt.Sprintf("Error writing decision to %s: %v", a.DecisionFile, err), "ERROR", nil, 0)
+			}
+		}
+	}
+	if err := a.persistOutput(winner.agent.output); err != nil {
+		a.log(fmt.Sprintf("Error persisting output to %s: %v", a.Profile.OutputTarget, err), "ERROR", nil, 0)
+		return err
+	}
+	a.result.OutputWritten = a.Profile.OutputTarget
+	return nil
+}
+
+// sampleAgent copies the agent for candidate n. The copy is read-only, keeps
+// its output rather than writing it, and takes turns with the other
+// candidates at the usage hook and the approver.
+func (a *Agent) sampleAgent(n int, usageMu, approvalMu *sync.Mutex) *Agent {
+	c := *a
+	c.Profile.Sampling = nil
+	c.Profile.OutputTarget = ""
+	// A distinct task keeps the candidates apart, in the response cache too.
+	c.Task = fmt.Sprintf("%s\n\n(You are candidate %d of %d: take your own approach. The other candidates share your workspace, so only read: change nothing and put your work in your final response.)", a.Task, n, a.Profile.Sampling.N)
+	c.readOnly = true
+	c.Profile.Tools, c.Profile.ToolsEnabled = nil, nil
+	for _, t := range a.Profile.Tools {
+		if _, writes := t.(WritingTool); !writes {
+			c.Profile.Tools = append(c.Profile.Tools, t)
+			c.Profile.ToolsEnabled = append(c.Profile.ToolsEnabled, t.Name())
+		}
+	}
+	c.DecisionFile = ""
+	c.Progress = nil
+	c.TotalUsage, c.TotalCost = 0, 0
+	c.UsageByModel = make(map[string]ModelUsage)
+	if a.Budget > 0 {
+		c.Budget = a.Budget / a.Profile.Sampling.N
+	}
+	if hook := a.OnUsage; hook != nil {
+		c.OnUsage = func(model string, usage llm.TokenUsage, cost float64) {
+			usageMu.Lock()
+			defer usageMu.Unlock()
+			hook(model, usage, cost)
+		}
+	}
+	if a.Approver != nil {
+		c.Approver = lockedApprover{mu: approvalMu, Approver: a.Approver}
+	}
+	return &c
+}
+
+// addUsage adds a candidate's usage and activity to the agent's.
+func (a *Agent) addUsage(c *Agent) {
+	a.TotalUsage += c.TotalUsage
+	a.TotalCost += c.TotalCost
+	if a.UsageByModel == nil {
+		a.UsageByModel = make(map[string]ModelUsage)
+	}
+	for model, cu := range c.UsageByModel {
+		u := a.UsageByModel[model]
+		u.Calls += cu.Calls
+		u.TokenUsage.PromptTokens += cu.TokenUsage.PromptTokens
+		u.TokenUsage.CompletionTokens += cu.TokenUsage.CompletionTokens
+		u.TokenUsage.TotalTokens += cu.TokenUsage.TotalTokens
+		u.TokenUsage.CacheReadTokens += cu.TokenUsage.CacheReadTokens
+		u.TokenUsage.CacheWriteTokens += cu.TokenUsage.CacheWriteTokens
+		u.Cost += cu.Cost
+		a.UsageByModel[model] = u
+	}
+	r := c.Result()
+	a.result.Iterations += r.Iterations
+	a.result.ActionsExecuted += r.ActionsExecuted
+	a.result.ToolCalls += r.ToolCalls
+	a.result.Critiques += r.Critiques
+}
+
+// pickWinner scores the candidates against the checks and, if more than one
+// scores highest, has the judge choose between those. Without a judge, or
+// when it fails or the budget is spent, the first of them wins: the
+// candidates' work is done and paid for.
+func (a *Agent) pickWinner(ctx context.Context, done []*candidate) *candidate {
+	s := a.Profile.Sampling
+	best := -1
+	var top []*candidate
+	scores := make(map[string]interface{}, len(done))
+	for _, c := range done {
+		for _, check := range s.Checks {
+			if check.MatchString(c.agent.output) {
+				c.score++
+			}
+		}
+		scores[strconv.Itoa(c.n)] = c.score
+		switch {
+		case c.score > best:
+			best, top = c.score, []*candidate{c}
+		case c.score == best:
+			top = append(top, c)
+		}
+	}
+	if len(s.Checks) > 0 {
+		a.logData(fmt.Sprintf("Candidate scores: %d of %d checks at best", best, len(s.Checks)), "INFO", nil, 0,
+			map[string]interface{}{"scores": scores})
+	}
+	if len(top) == 1 || s.Rubric == "" {
+		return top[0]
+	}
+	if a.Budget > 0 && a.TotalUsage >= a.Budget {
+		a.log(fmt.Sprintf("Budget spent (%d of %d tokens); taking candidate %d without judging.", a.TotalUsage, a.Budget, top[0].n), "WARNING", nil, 0)
+		return top[0]
+	}
+	winner, err := a.judge(ctx, top)
+	if err != nil {
+		a.log(fmt.Sprintf("Judge failed: %v; taking candidate %d.", err, top[0].n), "WARNING", nil, 0)
+		return top[0]
+	}
+	return winner
+}
+
+// judge asks the judge model to pick the best of the candidates.
+func (a *Agent) judge(ctx context.Context, candidates []*candidate) (*candidate, error) {
+	s := a.Profile.Sampling
+	client, model := s.Judge, s.JudgeModel
+	if client == nil {
+		client, model = a.LLM, a.Model
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "RUBRIC:\n%s\n\nTASK:\n%s\n", s.Rubric, a.Task)
+	for _, c := range candidates {
+		fmt.Fprintf(&b, "\nCANDIDATE %d:\n%s\n", c.n, c.agent.output)
+	}
+	messages := []llm.Message{
+		{Role: "system", Content: judgePrompt},
+		{Role: "user", Content: b.String()},
+	}
+	resp, err := a.chatWithRetry(ctx, client, messages, fmt.Sprintf("[%s judge]", a.Profile.Name))
+	if err != nil {
+		return nil, fmt.Errorf("judge: %w", err)
+	}
+	if resp.Model == "" {
+		resp.Model = model
+	}
+	served, cost := a.recordUsage(resp)
+	a.logData(fmt.Sprintf("Judge response: %s", resp.Content), "DEBUG", resp.TokenUsage, cost,
+		map[string]interface{}{"model": served})
+
+	if m := winnerRegex.FindStringSubmatch(resp.Content); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		for _, c := range candidates {
+			if c.n == n {
+				return c, nil
+			}
+		}
+	}
+	a.log(fmt.Sprintf("Judge named no candidate; taking candidate %d.", candidates[0].n), "WARNING", nil, 0)
+	return candidates[0], nil
+}
+
+// candidatePath is where candidate n is saved next to the output target:
+// PLAN.md becomes PLAN.candidate-2.md.
+func candidatePath(target string, n int) string {
+	ext := filepath.Ext(target)
+	return fmt.Sprintf("%s.candidate-%d%s", strings.TrimSuffix(target, ext), n, ext)
+}
+
+// lockedApprover lets concurrent candidates share an approver, one request
+// at a time.
+type lockedApprover struct {
+	mu *sync.Mutex
+	Approver
+}
+
+func (l lockedApprover) Approve(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.Approver.Approve(ctx, req)
+}
@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shalomb/axon/pkg/types"
+	"github.com/shalomb/springfield/internal/llm"
+)
+
+// candidateLLM answers each candidate with its own output, safely from
+// concurrent runs.
+type candidateLLM struct {
+	mu      sync.Mutex
+	outputs map[int]string // By candidate number
+	calls   int
+}
+
+func (m *candidateLLM) Chat(ctx context.Context, messages []llm.Message) (llm.Response, error) {
+	m.mu.Lock()
+	m.calls++
+	m.mu.Unlock()
+	task := messages[len(messages)-1].Content
+	for n, out := range m.outputs {
+		if strings.Contains(task, fmt.Sprintf("candidate %d of", n)) {
+			return llm.Response{Content: out, TokenUsage: llm.TokenUsage{TotalTokens: 20}}, nil
+		}
+	}
+	return llm.Response{}, errors.New("candidateLLM: unknown candidate")
+}
+
+func TestAgent_Run_BestOfNScoresWithChecks(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "PLAN.md")
+	mLLM := &candidateLLM{outputs: map[int]string{
+		1: "Plan one.\n[[FINISH]]",
+		2: "## Tasks\n- [ ] Plan two.\n[[FINISH]]",
+		3: "Plan three.\n[[FINISH]]",
+	}}
+	sampling, err := NewSampling(3, []string{`(?m)^## Tasks`, `- \[ \]`}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := New(AgentProfile{Name: "lisa", Role: "role", OutputTarget: target, Sampling: sampling}, mLLM, &mockSandbox{})
+	a.Task = "plan"
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if got, _ := os.ReadFile(target); string(got) != "## Tasks\n- [ ] Plan two." {
+		t.Errorf("unexpected winner: %q", got)
+	}
+	for n, want := range map[int]string{1: "Plan one.", 3: "Plan three."} {
+		if got, _ := os.ReadFile(candidatePath(target, n)); string(got) != want {
+			t.Errorf("candidate %d: got %q, want %q", n, got, want)
+		}
+	}
+	if _, err := os.Stat(candidatePath(target, 2)); !os.IsNotExist(err) {
+		t.Error("the winner should not be saved as a candidate")
+	}
+	if r := a.Result(); a.TotalUsage != 60 || r.Iterations != 3 || r.OutputWritten != target || r.Reason != FinishCompleted {
+		t.Errorf("unexpected usage %d or result %+v", a.TotalUsage, r)
+	}
+}
+
+func TestAgent_Run_BestOfNJudgeBreaksTies(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "PLAN.md")
+	mLLM := &candidateLLM{outputs: map[int]string{1: "One.\n[[FINISH]]", 2: "Two.\n[[FINISH]]"}}
+	judge := &mockLLM{responses: []string{"<winner>2</winner> Two is clearer."}}
+	profile := AgentProfile{Name: "lisa", Role: "role", OutputTarget: target,
+		Sampling: &Sampling{N: 2, Rubric: "Clarity.", Judge: judge, JudgeModel: "judge-model"}}
+	a := New(profile, mLLM, &mockSandbox{})
+	a.Task = "plan"
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if got, _ := os.ReadFile(target); string(got) != "Two." {
+		t.Errorf("unexpected winner: %q", got)
+	}
+	prompt := judge.received[0][1].Content
+	if !strings.Contains(prompt, "RUBRIC:\nClarity.") || !strings.Contains(prompt, "CANDIDATE 1:\nOne.") || !strings.Contains(prompt, "CANDIDATE 2:\nTwo.") {
+		t.Errorf("unexpected judge prompt: %q", prompt)
+	}
+	if a.UsageByModel["judge-model"].Calls != 1 || a.TotalUsage != 60 {
+		t.Errorf("judge usage not counted: %d tokens, %+v", a.TotalUsage, a.UsageByModel)
+	}
+}
+
+func TestAgent_Run_BestOfNKeepsWorkWithoutAJudge(t *testing.T) {
+	for name, c := range map[string]struct {
+		budget     int
+		judgeCalls int
+	}{
+		"judge fails":  {budget: 0, judgeCalls: 1},
+		"budget spent": {budget: 40, judgeCalls: 0},
+	} {
+		target := filepath.Join(t.TempDir(), "PLAN.md")
+		mLLM := &candidateLLM{outputs: map[int]string{1: "One.\n[[FINISH]]", 2: "Two.\n[[FINISH]]"}}
+		judge := &mockLLM{}
+		profile := AgentProfile{Name: "lisa", Role: "role", OutputTarget: target,
+			Sampling: &Sampling{N: 2, Rubric: "Clarity.", Judge: judge}}
+		a := New(profile, mLLM, &mockSandbox{})
+		a.Task = "plan"
+		a.Budget = c.budget
+		a.RetryPolicy.MaxRetries = 0
+
+		if err := a.Run(context.Background()); err != nil {
+			t.Fatalf("%s: Run() unexpected error: %v", name, err)
+		}
+		if got, _ := os.ReadFile(target); string(got) != "One." {
+			t.Errorf("%s: expected the first candidate to win, got %q", name, got)
+		}
+		if judge.calls != c.judgeCalls {
+			t.Errorf("%s: judge called %d times, want %d", name, judge.calls, c.judgeCalls)
+		}
+	}
+}
+
+func TestAgent_Run_BestOfNAllFail(t *testing.T) {
+	mLLM := &candidateLLM{}
+	profile := AgentProfile{Name: "lisa", Role: "role", OutputTarget: filepath.Join(t.TempDir(), "PLAN.md"), Sampling: &Sampling{N: 2}}
+	a := New(profile, mLLM, &mockSandbox{})
+	a.RetryPolicy.MaxRetries = 0
+
+	err := a.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "all 2 candidates failed") {
+		t.Errorf("expected every candidate to fail, got %v", err)
+	}
+}
+
+func TestSampleAgent_ReadOnly(t *testing.T) {
+	root := t.TempDir()
+	tools, err := NewTools([]string{"search_code", "apply_patch"}, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb := &mockSandbox{results: []*types.Result{{Stdout: "plan notes"}}}
+	mLLM := &mockLLM{responses: []string{
+		"ACTION: echo plan > PLAN.md",
+		"ACTION: git -C . commit -am plan",
+		"ACTION: cat NOTES.md | grep plan",
+		"Plan.\n[[FINISH]]",
+	}}
+	profile := AgentProfile{Name: "lisa", Role: "role", OutputTarget: "PLAN.md", Sampling: &Sampling{N: 2},
+		ToolsEnabled: []string{"search_code", "apply_patch"}, Tools: tools}
+	a := New(profile, mLLM, sb)
+	c := a.sampleAgent(1, &sync.Mutex{}, &sync.Mutex{})
+
+	if len(c.Profile.Tools) != 1 || c.Profile.Tools[0].Name() != "search_code" || strings.Join(c.Profile.ToolsEnabled, ",") != "search_code" {
+		t.Errorf("writing tools should be withheld from candidates, got %v", c.Profile.ToolsEnabled)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if len(sb.commands) != 1 || sb.commands[0] != "cat NOTES.md | grep plan" {
+		t.Errorf("only the read-only action should run, got %v", sb.commands)
+	}
+	if got := mLLM.received[1]; got[len(got)-1].Content != readOnlyFeedback {
+		t.Errorf("unexpected feedback %q", got[len(got)-1].Content)
+	}
+	if len(a.Profile.Tools) != 2 || a.readOnly {
+		t.Error("sampling a candidate changed the agent")
+	}
+}
+
+func TestCandidatePath(t *testing.T) {
+	if got := candidatePath("docs/PLAN.md", 2); got != "docs/PLAN.candidate-2.md" {
+		t.Errorf("candidatePath() = %q", got)
+	}
+}
@@ -0,0 +1,194 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrStalled is returned when an agent stops making progress: it keeps
+// repeating itself or taking no action, and the stall policy says to give up.
+var ErrStalled = errors.New("agent stalled")
+
+// StallResponse is what the agent does when it detects a stall.
+type StallResponse string
+
+const (
+	// StallNudge tells the model it is going round in circles.
+	StallNudge StallResponse = "nudge"
+	// StallEscalate switches to the escalation model, with a nudge. Without
+	// one configured, or once escalated, it nudges.
+	StallEscalate StallResponse = "escalate"
+	// StallAbort ends the run with ErrStalled.
+	StallAbort StallResponse = "abort"
+)
+
+// StallPolicy decides when an agent is stalled and what to do about it. The
+// zero policy disables stall detection.
+type StallPolicy struct {
+	// Threshold is how many identical actions, identical responses or
+	// responses without an action in a row count as a stall.
+	Threshold int
+	// Responses are applied in turn to successive stalls; the last one
+	// repeats.
+	Responses []StallResponse
+}
+
+// DefaultStallPolicy nudges, then escalates, after three repeats. It never
+// aborts: that takes an explicit "abort" response.
+func DefaultStallPolicy() StallPolicy {
+	return StallPolicy{Threshold: 3, Responses: []StallResponse{StallNudge, StallEscalate}}
+}
+
+// ParseStallPolicy builds a policy from configuration. Setting neither the
+// threshold nor the responses disables stall detection; otherwise the unset
+// one takes its default.
+func ParseStallPolicy(threshold int, responses []string) (StallPolicy, error) {
+	if threshold < 0 {
+		return StallPolicy{}, fmt.Errorf("invalid stall threshold %d", threshold)
+	}
+	if threshold == 0 && len(responses) == 0 {
+		return StallPolicy{}, nil
+	}
+	p := DefaultStallPolicy()
+	if threshold > 0 {
+		p.Threshold = threshold
+	}
+	if len(responses) > 0 {
+		p.Responses = nil
+		for _, r := range responses {
+			switch resp := StallResponse(strings.ToLower(strings.TrimSpace(r))); resp {
+			case StallNudge, StallEscalate, StallAbort:
+				p.Responses = append(p.Responses, resp)
+			default:
+				return p, fmt.Errorf("invalid stall response %q (want nudge, escalate or abort)", r)
+			}
+		}
+	}
+	return p, nil
+}
+
+// stall describes what the agent is repeating. The action or tool call in
+// the response that trips the detector is skipped.
+type stall struct {
+	kind    string // action, output or no_action
+	count   int
+	detail  string
+	skipped bool // The response's action or tool call was not run
+}
+
+func (s stall) String() string {
+	switch s.kind {
+	case "action":
+		return fmt.Sprintf("same action %d times in a row: %s", s.count, s.detail)
+	case "output":
+		return fmt.Sprintf("same response %d times in a row", s.count)
+	default:
+		return fmt.Sprintf("%d responses in a row without an action", s.count)
+	}
+}
+
+// nudge is the corrective message sent to the model.
+func (s stall) nudge(finishMarker string) string {
+	switch s.kind {
+	case "action":
+		return fmt.Sprintf("You have run the same action %d times in a row and it is not making progress, "+
+			"so it was not run this time. Don't run it again: try a different approach, or end with %s if the task is done.", s.count, finishMarker)
+	case "output":
+		msg := fmt.Sprintf("You have given the same response %d times in a row. ", s.count)
+		if s.skipped {
+			msg += "Its action or tool call was not run this time. "
+		}
+		return msg + fmt.Sprintf("Take a different next step, or end with %s if the task is done.", finishMarker)
+	default:
+		return fmt.Sprintf("Your last %d responses had no action, tool call or finish marker, so nothing happened. "+
+			"Take an action with <action>...</action>, or end with %s if the task is done.", s.count, finishMarker)
+	}
+}
+
+// stallDetector watches the agent's turns for repetition.
+type stallDetector struct {
+	policy     StallPolicy
+	lastAction string
+	lastOutput string
+	sameAction int
+	sameOutput int
+	noAction   int
+	stalls     int
+}
+
+// observe records a turn's response and the action or tool call it took,
+// if any, and reports a stall once one reaches the threshold.
+func (d *stallDetector) observe(output, action string) (stall, bool) {
+	if d.policy.Threshold <= 0 {
+		return stall{}, false
+	}
+	output = strings.TrimSpace(output)
+	action = strings.Join(strings.Fields(action), " ")
+
+	if output == d.lastOutput {
+		d.sameOutput++
+	} else {
+		d.lastOutput, d.sameOutput = output, 1
+	}
+	switch {
+	case action == "":
+		d.noAction++
+		d.lastAction, d.sameAction = "", 0
+	case action == d.lastAction:
+		d.sameAction++
+		d.noAction = 0
+	default:
+		d.lastAction, d.sameAction = action, 1
+		d.noAction = 0
+	}
+
+	var s stall
+	switch {
+	case d.sameAction >= d.policy.Threshold:
+		s = stall{kind: "action", count: d.sameAction, detail: action, skipped: true}
+	case d.sameOutput >= d.policy.Threshold:
+		s = stall{kind: "output", count: d.sameOutput, skipped: action != ""}
+	case d.noAction >= d.policy.Threshold:
+		s = stall{kind: "no_action", count: d.noAction}
+	default:
+		return stall{}, false
+	}
+	// Start counting afresh, so the response gets a chance to work.
+	d.lastAction, d.lastOutput = "", ""
+	d.sameAction, d.sameOutput, d.noAction = 0, 0, 0
+	return s, true
+}
+
+// next returns the response to the latest stall.
+func (d *stallDetector) next() StallResponse {
+	if len(d.policy.Responses) == 0 {
+		return StallNudge
+	}
+	i := d.stalls
+	if i >= len(d.policy.Responses) {
+		i = len(d.policy.Responses) - 1
+	}
+	d.stalls++
+	return d.policy.Responses[i]
+}
+
+// handleStall applies the policy's response to a stall, returning the
+// message to send the model or ErrStalled.
+func (a *Agent) handleStall(d *stallDetector, s stall) (string, error) {
+	switch d.next() {
+	case StallAbort:
+		a.log(fmt.Sprintf("Stalled (%s); aborting.", s), "ERROR", nil, 0)
+		return "", fmt.Errorf("%w: %s", ErrStalled, s)
+	case StallEscalate:
+		if a.EscalationLLM != nil {
+			a.logData(fmt.Sprintf("Stalled (%s); escalating to %s.", s, a.EscalationModel), "WARNING", nil, 0,
+				map[string]interface{}{"model": a.EscalationModel})
+			a.LLM, a.Model = a.EscalationLLM, a.EscalationModel
+			a.EscalationLLM = nil
+			return s.nudge(a.finishMarker()), nil
+		}
+	}
+	a.log(fmt.Sprintf("Stalled (%s); nudging.", s), "WARNING", nil, 0)
+	return s.nudge(a.finishMarker()), nil
+}
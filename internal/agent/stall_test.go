@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/shalomb/axon/pkg/types"
+)
+
+func repeat(s string, n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = s
+	}
+	return out
+}
+
+func okResults(n int) []*types.Result {
+	out := make([]*types.Result, n)
+	for i := range out {
+		out[i] = &types.Result{ExitCode: 0}
+	}
+	return out
+}
+
+func TestAgent_Run_StallNudgesThenAborts(t *testing.T) {
+	mLLM := &mockLLM{responses: repeat("<action>go test ./...</action>", 10)}
+	sb := &mockSandbox{results: okResults(10)}
+	a := New(AgentProfile{Name: "ralph", Role: "role"}, mLLM, sb)
+	a.Task = "fix the build"
+	a.StallPolicy = StallPolicy{Threshold: 2, Responses: []StallResponse{StallNudge, StallAbort}}
+
+	err := a.Run(context.Background())
+	if !errors.Is(err, ErrStalled) {
+		t.Fatalf("expected ErrStalled, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "same action 2 times in a row: go test ./...") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// Turn 2 is nudged rather than run; turn 4 aborts.
+	if mLLM.calls != 4 || sb.calls != 2 {
+		t.Errorf("expected 4 LLM calls and 2 actions, got %d and %d", mLLM.calls, sb.calls)
+	}
+	nudged := mLLM.received[2]
+	if got := nudged[len(nudged)-1].Content; !strings.HasPrefix(got, "You have run the same action 2 times in a row") ||
+		!strings.Contains(got, "it was not run this time") {
+		t.Errorf("expected a nudge saying the action was skipped, got %q", got)
+	}
+}
+
+func TestAgent_Run_StallDetectionIsOptIn(t *testing.T) {
+	mLLM := &mockLLM{responses: append(repeat("<action>go test ./...</action>", 5), "Done.\n[[FINISH]]")}
+	sb := &mockSandbox{results: okResults(5)}
+	a := New(AgentProfile{Name: "ralph", Role: "role"}, mLLM, sb)
+	a.Task = "fix the build"
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if sb.calls != 5 {
+		t.Errorf("expected every action to run without a stall policy, got %d", sb.calls)
+	}
+}
+
+func TestAgent_Run_StallOnNoAction(t *testing.T) {
+	mLLM := &mockLLM{responses: []string{"Thinking...", "Still thinking.", "Hmm.", "Done.\n[[FINISH]]"}}
+	a := New(AgentProfile{Name: "lisa", Role: "role"}, mLLM, &mockSandbox{})
+	a.Task = "plan"
+	a.StallPolicy = DefaultStallPolicy()
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	nudged := mLLM.received[3]
+	if got := nudged[len(nudged)-1].Content; !strings.HasPrefix(got, "Your last 3 responses had no action") {
+		t.Errorf("expected a no-action nudge, got %q", got)
+	}
+}
+
+func TestAgent_Run_StallEscalates(t *testing.T) {
+	weak := &mockLLM{responses: repeat("I am not sure.", 3)}
+	strong := &mockLLM{responses: []string{"Fixed.\n[[FINISH]]"}}
+	a := New(AgentProfile{Name: "ralph", Role: "role"}, weak, &mockSandbox{})
+	a.Task = "fix it"
+	a.StallPolicy = StallPolicy{Threshold: 3, Responses: []StallResponse{StallEscalate}}
+	a.EscalationModel, a.EscalationLLM = "anthropic/claude-opus-4-1", strong
+
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if weak.calls != 3 || strong.calls != 1 {
+		t.Errorf("expected 3 calls before escalating and 1 after, got %d and %d", weak.calls, strong.calls)
+	}
+	if a.Model != "anthropic/claude-opus-4-1" {
+		t.Errorf("expected the model to switch, got %q", a.Model)
+	}
+}
+
+func TestParseStallPolicy(t *testing.T) {
+	p, err := ParseStallPolicy(0, nil)
+	if err != nil || p.Threshold != 0 {
+		t.Errorf("expected stall detection to be off, got %+v, %v", p, err)
+	}
+	p, err = ParseStallPolicy(4, nil)
+	if err != nil || p.Threshold != 4 || len(p.Responses) != 2 || p.Responses[1] != StallEscalate {
+		t.Errorf("expected the default responses, which don't abort, got %+v, %v", p, err)
+	}
+	p, err = ParseStallPolicy(5, []string{"Nudge", "abort"})
+	if err != nil || p.Threshold != 5 || p.Responses[1] != StallAbort {
+		t.Errorf("unexpected policy %+v, %v", p, err)
+	}
+	if _, err := ParseStallPolicy(3, []string{"panic"}); err == nil {
+		t.Error("expected an unknown response to be rejected")
+	}
+}
@@ -0,0 +1,323 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/shalomb/springfield/internal/codeindex"
+	"github.com/shalomb/springfield/internal/patch"
+)
+
+// Tool is a built-in capability an agent calls with
+// <tool name="...">{json arguments}</tool> instead of a shell action.
+type Tool interface {
+	Name() string
+	Description() string // What it does and its arguments, shown to the model
+	Call(ctx context.Context, args json.RawMessage) (string, error)
+}
+
+// DataTool is a Tool whose results carry structured data for the log, such
+// as the diff a patch applied.
+type DataTool interface {
+	Tool
+	CallWithData(ctx context.Context, args json.RawMessage) (string, map[string]interface{}, error)
+}
+
+// WritingTool is a Tool that changes files. Its calls go through the
+// approval gate, since they don't run in the sandbox.
+type WritingTool interface {
+	Tool
+	// Writes lists the files a call would change.
+	Writes(args json.RawMessage) ([]string, error)
+}
+
+// toolResultLimit caps how many matches a search tool returns.
+const toolResultLimit = 50
+
+var toolTagRegex = regexp.MustCompile(`(?s)<tool\s+name="([\w-]+)"\s*>(.*?)</tool>`)
+
+// NewTools returns the named tools working on dir. Tools backed by the code
+// index share one, built on first use.
+func NewTools(names []string, dir string) ([]Tool, error) {
+	index := &lazyIndex{dir: dir}
+	var tools []Tool
+	for _, name := range names {
+		switch name {
+		case "search_code":
+			tools = append(tools, &searchCodeTool{index: index})
+		case "find_symbol":
+			tools = append(tools, &findSymbolTool{index: index})
+		case "apply_patch":
+			tools = append(tools, &applyPatchTool{dir: dir})
+		default:
+			return nil, fmt.Errorf("unknown tool %q", name)
+		}
+	}
+	return tools, nil
+}
+
+// toolsPrompt tells the model which tools it has and how to call them.
+func toolsPrompt(tools []Tool) string {
+	var b strings.Builder
+	b.WriteString("\n\nTOOLS:\nBesides actions, you can call these tools, one per response, with <tool name=\"NAME\">{JSON arguments}</tool>. They are faster, cheaper and safer than doing the same with shell commands.\n")
+	for _, t := range tools {
+		fmt.Fprintf(&b, "- %s: %s\n", t.Name(), t.Description())
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// extractToolCall returns the tool called in a response, if any.
+func extractToolCall(resp string) (name string, args json.RawMessage, ok bool) {
+	match := toolTagRegex.FindStringSubmatch(resp)
+	if len(match) < 3 {
+		return "", nil, false
+	}
+	body := strings.TrimSpace(match[2])
+	if body == "" {
+		body = "{}"
+	}
+	return match[1], json.RawMessage(body), true
+}
+
+// callTool runs a tool call and formats its result, or its error, for the
+// model. It returns an error only when a write can't be put to the approver.
+func (a *Agent) callTool(ctx context.Context, name string, args json.RawMessage) (string, error) {
+	for _, t := range a.Profile.Tools {
+		if t.Name() != name {
+			continue
+		}
+		if wt, ok := t.(WritingTool); ok {
+			paths, err := wt.Writes(args)
+			if err != nil {
+				return fmt.Sprintf("TOOL ERROR (%s): %v", name, err), nil
+			}
+			approved, feedback, err := a.approveWrite(ctx, name, paths)
+			if err != nil {
+				return "", err
+			}
+			if !approved {
+				return fmt.Sprintf("TOOL ERROR (%s): %s", name, feedback), nil
+			}
+		}
+		a.log(fmt.Sprintf("Calling tool %s: %s", name, args), "INFO", nil, 0)
+		var out string
+		var data map[string]interface{}
+		var err error
+		if dt, ok := t.(DataTool); ok {
+			out, data, err = dt.CallWithData(ctx, args)
+		} else {
+			out, err = t.Call(ctx, args)
+		}
+		if err != nil {
+			a.log(fmt.Sprintf("Tool %s failed: %v", name, err), "WARNING", nil, 0)
+			return fmt.Sprintf("TOOL ERROR (%s): %v", name, err), nil
+		}
+		if data != nil {
+			a.logData(fmt.Sprintf("Tool %s: %s", name, out), "INFO", nil, 0, data)
+		} else {
+			a.log(fmt.Sprintf("Tool result: %s", out), "DEBUG", nil, 0)
+		}
+		return fmt.Sprintf("TOOL RESULT (%s):\n%s", name, out), nil
+	}
+	return fmt.Sprintf("TOOL ERROR (%s): no such tool; available tools: %s", name, strings.Join(a.Profile.ToolsEnabled, ", ")), nil
+}
+
+// lazyIndex opens the code index on first use and brings it up to date
+// before every query, so it sees the agent's own edits.
+type lazyIndex struct {
+	dir   string
+	once  sync.Once
+	index *codeindex.Index
+	err   error
+}
+
+func (l *lazyIndex) get() (*codeindex.Index, error) {
+	l.once.Do(func() {
+		l.index, l.err = codeindex.Open(l.dir)
+	})
+	if l.err != nil {
+		return nil, l.err
+	}
+	if _, err := l.index.Update(); err != nil {
+		return nil, err
+	}
+	return l.index, nil
+}
+
+type searchCodeTool struct{ index *lazyIndex }
+
+func (t *searchCodeTool) Name() string { return "search_code" }
+
+func (t *searchCodeTool) Description() string {
+	return `find lines containing text, ignoring case. Arguments: {"query": "text", "glob": "optional file filter, e.g. *.go or internal/*/*.go"}`
+}
+
+func (t *searchCodeTool) Call(ctx context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		Query string `json:"query"`
+		Glob  string `json:"glob"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	idx, err := t.index.get()
+	if err != nil {
+		return "", err
+	}
+	matches, err := idx.Search(in.Query, in.Glob, toolResultLimit+1)
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "No matches.", nil
+	}
+	lines := make([]string, 0, len(matches))
+	for i, m := range matches {
+		if i == toolResultLimit {
+			lines = append(lines, fmt.Sprintf("(more than %d matches; narrow the query or glob)", toolResultLimit))
+			break
+		}
+		lines = append(lines, m.String())
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+type findSymbolTool struct{ index *lazyIndex }
+
+func (t *findSymbolTool) Name() string { return "find_symbol" }
+
+func (t *findSymbolTool) Description() string {
+	return `find Go declarations (packages, types, funcs, methods, consts, vars) by name. Arguments: {"name": "Symbol, Type.Method or pkg.Func"}`
+}
+
+func (t *findSymbolTool) Call(ctx context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	if strings.TrimSpace(in.Name) == "" {
+		return "", fmt.Errorf("name is required")
+	}
+	idx, err := t.index.get()
+	if err != nil {
+		return "", err
+	}
+	symbols := idx.FindSymbol(in.Name, toolResultLimit)
+	if len(symbols) == 0 {
+		return "No symbols found.", nil
+	}
+	lines := make([]string, len(symbols))
+	for i, s := range symbols {
+		lines[i] = s.String()
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+type applyPatchTool struct{ dir string }
+
+func (t *applyPatchTool) Name() string { return "apply_patch" }
+
+func (t *applyPatchTool) Description() string {
+	return `edit files safely instead of rewriting them with shell commands. Either {"patch": "unified diff with --- a/path and +++ b/path headers; context lines must match the file exactly"} or {"path": "file", "search": "exact text occurring once", "replace": "new text"} (an empty search creates the file). Nothing is written unless every hunk applies.`
+}
+
+func (t *applyPatchTool) Call(ctx context.Context, args json.RawMessage) (string, error) {
+	out, _, err := t.CallWithData(ctx, args)
+	return out, err
+}
+
+type applyPatchArgs struct {
+	Patch   string  `json:"patch"`
+	Path    string  `json:"path"`
+	Search  *string `json:"search"`
+	Replace string  `json:"replace"`
+}
+
+// Writes implements WritingTool.
+func (t *applyPatchTool) Writes(args json.RawMessage) ([]string, error) {
+	var in applyPatchArgs
+	if err := json.Unmarshal(args, &in); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if in.Patch == "" {
+		return []string{in.Path}, nil
+	}
+	patches, err := patch.Parse(in.Patch)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(patches))
+	for i, p := range patches {
+		paths[i] = p.Path()
+	}
+	return paths, nil
+}
+
+func (t *applyPatchTool) CallWithData(ctx context.Context, args json.RawMessage) (string, map[string]interface{}, error) {
+	var in applyPatchArgs
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	var changes []patch.Change
+	switch {
+	case in.Patch != "" && in.Path == "":
+		var err error
+		if changes, err = patch.ApplyDiff(t.dir, in.Patch); err != nil {
+			return "", nil, err
+		}
+	case in.Patch == "" && in.Path != "" && in.Search != nil:
+		change, err := patch.Replace(t.dir, in.Path, *in.Search, in.Replace)
+		if err != nil {
+			return "", nil, err
+		}
+		changes = []patch.Change{change}
+	default:
+		return "", nil, fmt.Errorf(`give either "patch", or "path" with "search" and "replace"`)
+	}
+
+	var summary, diffs []string
+	var files []map[string]interface{}
+	for _, c := range changes {
+		summary = append(summary, fmt.Sprintf("%s %s (+%d -%d)", c.Op, c.Path, c.Added, c.Removed))
+		diffs = append(diffs, c.Diff)
+		files = append(files, map[string]interface{}{"path": c.Path, "op": c.Op, "added": c.Added, "removed": c.Removed})
+	}
+	data := map[string]interface{}{"tool": t.Name(), "files": files, "diff": strings.Join(diffs, "")}
+	return "Applied: " + strings.Join(summary, ", "), data, nil
+}
+
+// CodeIndexContext is a context provider that outlines the repository's Go
+// packages and their exported declarations from the code index.
+type CodeIndexContext struct {
+	MaxBytes int // Defaults to DefaultMaxDiffBytes
+}
+
+// Name implements ContextProvider.
+func (c *CodeIndexContext) Name() string { return "codeindex" }
+
+// Context implements ContextProvider.
+func (c *CodeIndexContext) Context(ctx context.Context, dir string) (string, error) {
+	idx, err := codeindex.Open(dir)
+	if err != nil {
+		return "", err
+	}
+	outline := idx.Outline()
+	if outline == "" {
+		return "", fmt.Errorf("no Go packages found")
+	}
+	maxBytes := c.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxDiffBytes
+	}
+	if len(outline) > maxBytes {
+		outline = strings.TrimRight(string(cutText([]byte(outline), maxBytes)), "\n") + "\n[... outline truncated]"
+	}
+	return "CODE OUTLINE (exported declarations by package; use find_symbol for locations):\n" + strings.TrimRight(outline, "\n"), nil
+}
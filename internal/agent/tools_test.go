@@ -0,0 +1,152 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shalomb/springfield/internal/config"
+)
+
+func TestAgent_Run_CallsTools(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"pkg/limit.go": "package pkg\n\ntype Limiter struct{}\n"})
+	tools, err := NewTools([]string{"find_symbol", "search_code"}, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mLLM := &mockLLM{responses: []string{
+		`<tool name="find_symbol">{"name": "Limiter"}</tool>`,
+		`<tool name="search_code">{"query": "struct{}", "glob": "*.go"}</tool>`,
+		`<tool name="run_tests">{}</tool>`,
+		"Found it.\n[[FINISH]]",
+	}}
+	sb := &mockSandbox{}
+	a := New(AgentProfile{Name: "ralph", Role: "role", ToolsEnabled: []string{"find_symbol", "search_code"}, Tools: tools}, mLLM, sb)
+	a.Task = "find the limiter"
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+
+	if !strings.Contains(mLLM.received[0][0].Content, "- find_symbol: find Go declarations") {
+		t.Errorf("system prompt doesn't describe the tools: %q", mLLM.received[0][0].Content)
+	}
+	results := []string{
+		"TOOL RESULT (find_symbol):\npkg/limit.go:3: type pkg.Limiter",
+		"TOOL RESULT (search_code):\npkg/limit.go:3: type Limiter struct{}",
+		"TOOL ERROR (run_tests): no such tool; available tools: find_symbol, search_code",
+	}
+	for i, want := range results {
+		msgs := mLLM.received[i+1]
+		if got := msgs[len(msgs)-1].Content; got != want {
+			t.Errorf("call %d: got %q, want %q", i+1, got, want)
+		}
+	}
+	if sb.calls != 0 {
+		t.Errorf("tool calls should not reach the sandbox, got %v", sb.commands)
+	}
+}
+
+func TestNewTools_Unknown(t *testing.T) {
+	if _, err := NewTools([]string{"search_code", "grep"}, "."); err == nil {
+		t.Error("expected an unknown tool to be rejected")
+	}
+}
+
+func TestApplyPatchTool(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+	tools, err := NewTools([]string{"apply_patch"}, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tool := tools[0].(DataTool)
+
+	out, data, err := tool.CallWithData(context.Background(), []byte(`{"path": "main.go", "search": "func main() {}", "replace": "func main() {\n\trun()\n}"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "Applied: modify main.go (+3 -1)" {
+		t.Errorf("unexpected result %q", out)
+	}
+	if diff, _ := data["diff"].(string); !strings.Contains(diff, "-func main() {}\n+func main() {\n+\trun()\n+}") {
+		t.Errorf("unexpected logged diff: %q", diff)
+	}
+
+	_, err = tools[0].Call(context.Background(), []byte(`{"patch": "--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-package mian\n+package app\n"}`))
+	if err == nil || !strings.Contains(err.Error(), `expected "package mian", found "package main"`) {
+		t.Errorf("expected a context mismatch, got %v", err)
+	}
+	if _, err := tools[0].Call(context.Background(), []byte(`{"path": "main.go"}`)); err == nil {
+		t.Error("expected missing search/replace to be rejected")
+	}
+}
+
+func TestAgent_ApplyPatchNeedsApproval(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"Justfile": "test:\n\tgo test ./...\n"})
+	tools, err := NewTools([]string{"apply_patch"}, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := []byte(`{"path": "Justfile", "search": "go test ./...", "replace": "true"}`)
+	for _, c := range []struct {
+		mode     ApprovalMode
+		approver *mockApprover
+		applied  bool
+	}{
+		{ApprovalRisky, nil, false},
+		{ApprovalAlways, &mockApprover{decision: ApprovalDecision{Approved: false}}, false},
+		{ApprovalRisky, &mockApprover{decision: ApprovalDecision{Approved: true}}, true},
+	} {
+		a := New(AgentProfile{Name: "ralph", Role: "role", Tools: tools}, &mockLLM{}, &mockSandbox{})
+		a.Approval = c.mode
+		if c.approver != nil {
+			a.Approver = c.approver
+		}
+		out, err := a.callTool(context.Background(), "apply_patch", args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if applied := strings.HasPrefix(out, "TOOL RESULT"); applied != c.applied {
+			t.Errorf("%s: unexpected result %q", c.mode, out)
+		}
+		if c.approver != nil && (len(c.approver.requests) != 1 || c.approver.requests[0].Action != "apply_patch Justfile") {
+			t.Errorf("%s: unexpected approval requests %+v", c.mode, c.approver.requests)
+		}
+		if !c.applied {
+			if got := readTestFile(t, root, "Justfile"); got != "test:\n\tgo test ./...\n" {
+				t.Errorf("%s: a denied patch changed the file: %q", c.mode, got)
+			}
+		}
+	}
+}
+
+func TestNewRunnerFromConfig_ToolsUseWorktree(t *testing.T) {
+	worktree := t.TempDir()
+	writeFiles(t, worktree, map[string]string{"main.go": "package main\n"})
+	cfg := config.AgentConfig{Role: "Build Agent", Prompt: "prompt_ralph.md", Tools: []string{"apply_patch"}}
+	runner, err := NewRunnerFromConfig("ralph", "build", &mockLLM{}, nil, cfg, WithEpic("td-1", worktree))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := runner.(*Agent)
+	if _, err := a.callTool(context.Background(), "apply_patch", []byte(`{"path": "main.go", "search": "main", "replace": "app"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, worktree, "main.go"); got != "package app\n" {
+		t.Errorf("expected the patch to apply in the worktree, got %q", got)
+	}
+}
+
+func readTestFile(t *testing.T, root, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(root, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,523 @@
+// Package codeindex indexes a repository so agents can look up symbols and
+// search code without shelling out to grep: Go declarations are parsed with
+// go/parser, and every text file gets a trigram index for substring search.
+package codeindex
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxFileSize skips generated blobs and other files too big to be useful.
+const maxFileSize = 1 << 20
+
+// cacheVersion invalidates caches written by an incompatible index.
+const cacheVersion = 1
+
+// CacheFile is where an index is cached, relative to its repository's git
+// directory, so it never shows up as a change in the worktree. Outside a
+// repository it is relative to the index's root.
+var CacheFile = filepath.Join("springfield", "codeindex.gob")
+
+// Symbol is a top-level Go declaration.
+type Symbol struct {
+	Name     string
+	Kind     string // package, type, func, method, const or var
+	Package  string
+	Receiver string // Receiver type of a method
+	File     string
+	Line     int
+}
+
+func (s Symbol) String() string {
+	name := s.Name
+	if s.Receiver != "" {
+		name = s.Receiver + "." + s.Name
+	}
+	return fmt.Sprintf("%s:%d: %s %s.%s", s.File, s.Line, s.Kind, s.Package, name)
+}
+
+// Match is a line found by Search.
+type Match struct {
+	File string
+	Line int
+	Text string
+}
+
+func (m Match) String() string {
+	return fmt.Sprintf("%s:%d: %s", m.File, m.Line, m.Text)
+}
+
+// UpdateStats reports what an Update did.
+type UpdateStats struct {
+	Indexed, Reused, Removed int
+}
+
+type fileEntry struct {
+	ModTime  int64
+	Size     int64
+	Symbols  []Symbol
+	Trigrams []uint32 // Sorted trigrams of the lower-cased content
+}
+
+type cache struct {
+	Version int
+	Files   map[string]*fileEntry
+}
+
+// Index is a code index of the files under Root.
+type Index struct {
+	Root  string
+	store string // Cache file; empty for the default, see cachePath
+	mu    sync.RWMutex
+	files map[string]*fileEntry
+}
+
+// Open loads the index cached for root, brings it up to date and saves it
+// back. A missing or stale cache just means a full rebuild.
+func Open(root string) (*Index, error) {
+	idx := &Index{Root: root, store: cachePath(root), files: make(map[string]*fileEntry)}
+	idx.load()
+	if _, err := idx.Update(); err != nil {
+		return nil, err
+	}
+	if err := idx.Save(); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// cachePath puts the cache in root's git directory, which is private to the
+// worktree, or in root/.springfield outside a repository.
+func cachePath(root string) string {
+	cmd := exec.Command("git", "rev-parse", "--absolute-git-dir")
+	cmd.Dir = root
+	if out, err := cmd.Output(); err == nil {
+		return filepath.Join(strings.TrimSpace(string(out)), CacheFile)
+	}
+	return filepath.Join(root, ".springfield", CacheFile)
+}
+
+func (idx *Index) cacheFile() string {
+	if idx.store != "" {
+		return idx.store
+	}
+	return cachePath(idx.Root)
+}
+
+func (idx *Index) load() {
+	f, err := os.Open(idx.cacheFile())
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	var c cache
+	if err := gob.NewDecoder(f).Decode(&c); err != nil || c.Version != cacheVersion {
+		return
+	}
+	idx.files = c.Files
+}
+
+// Save writes the index to its cache file.
+func (idx *Index) Save() error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(cache{Version: cacheVersion, Files: idx.files}); err != nil {
+		return err
+	}
+	path := idx.cacheFile()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Update re-indexes the files that changed since the last update, by size
+// and modification time, and drops the ones that are gone.
+func (idx *Index) Update() (UpdateStats, error) {
+	var stats UpdateStats
+	realRoot, err := filepath.EvalSymlinks(idx.Root)
+	if err != nil {
+		return stats, err
+	}
+	files := ListFiles(idx.Root)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	present := make(map[string]bool, len(files))
+	for _, name := range files {
+		info, err := stat(realRoot, idx.Root, name)
+		if err != nil || info.Size() > maxFileSize {
+			continue
+		}
+		present[name] = true
+		if e, ok := idx.files[name]; ok && e.ModTime == info.ModTime().UnixNano() && e.Size == info.Size() {
+			stats.Reused++
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(idx.Root, name))
+		if err != nil || bytes.IndexByte(content, 0) >= 0 {
+			delete(present, name)
+			continue
+		}
+		idx.files[name] = indexFile(name, content, info)
+		stats.Indexed++
+	}
+	for name := range idx.files {
+		if !present[name] {
+			delete(idx.files, name)
+			stats.Removed++
+		}
+	}
+	return stats, nil
+}
+
+func indexFile(name string, content []byte, info fs.FileInfo) *fileEntry {
+	e := &fileEntry{ModTime: info.ModTime().UnixNano(), Size: info.Size(), Trigrams: trigrams(content)}
+	if strings.HasSuffix(name, ".go") {
+		e.Symbols = goSymbols(name, content)
+	}
+	return e
+}
+
+// goSymbols lists a Go file's top-level declarations. A file that doesn't
+// parse yields what could be recovered.
+func goSymbols(name string, content []byte) []Symbol {
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, name, content, parser.SkipObjectResolution)
+	if f == nil || f.Name == nil {
+		return nil
+	}
+	pkg := f.Name.Name
+	line := func(p token.Pos) int { return fset.Position(p).Line }
+	symbols := []Symbol{{Name: pkg, Kind: "package", Package: pkg, File: name, Line: line(f.Package)}}
+
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			s := Symbol{Name: d.Name.Name, Kind: "func", Package: pkg, File: name, Line: line(d.Pos())}
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				s.Kind = "method"
+				s.Receiver = receiverName(d.Recv.List[0].Type)
+			}
+			symbols = append(symbols, s)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch sp := spec.(type) {
+				case *ast.TypeSpec:
+					symbols = append(symbols, Symbol{Name: sp.Name.Name, Kind: "type", Package: pkg, File: name, Line: line(sp.Pos())})
+				case *ast.ValueSpec:
+					kind := "var"
+					if d.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, n := range sp.Names {
+						if n.Name != "_" {
+							symbols = append(symbols, Symbol{Name: n.Name, Kind: kind, Package: pkg, File: name, Line: line(n.Pos())})
+						}
+					}
+				}
+			}
+		}
+	}
+	return symbols
+}
+
+func receiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// trigrams returns the sorted, distinct trigrams of content, lower-cased.
+func trigrams(content []byte) []uint32 {
+	content = bytes.ToLower(content)
+	set := make(map[uint32]struct{})
+	for i := 0; i+3 <= len(content); i++ {
+		set[uint32(content[i])<<16|uint32(content[i+1])<<8|uint32(content[i+2])] = struct{}{}
+	}
+	out := make([]uint32, 0, len(set))
+	for t := range set {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+func hasTrigram(sorted []uint32, t uint32) bool {
+	i := sort.Search(len(sorted), func(i int) bool { return sorted[i] >= t })
+	return i < len(sorted) && sorted[i] == t
+}
+
+// FindSymbol looks up Go declarations by name, best matches first: exact,
+// then case-insensitive, then prefix, then substring. "Type.Method" finds a
+// method on a type.
+func (idx *Index) FindSymbol(query string, limit int) []Symbol {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil
+	}
+	lower := strings.ToLower(query)
+	rank := func(s Symbol) int {
+		name := s.Name
+		if strings.Contains(query, ".") {
+			name = s.Receiver + "." + s.Name
+			if s.Receiver == "" {
+				name = s.Package + "." + s.Name
+			}
+		}
+		switch n := strings.ToLower(name); {
+		case name == query:
+			return 0
+		case n == lower:
+			return 1
+		case strings.HasPrefix(n, lower):
+			return 2
+		case strings.Contains(n, lower):
+			return 3
+		}
+		return -1
+	}
+
+	type ranked struct {
+		Symbol
+		rank int
+	}
+	var found []ranked
+	idx.mu.RLock()
+	for _, e := range idx.files {
+		for _, s := range e.Symbols {
+			if r := rank(s); r >= 0 {
+				found = append(found, ranked{s, r})
+			}
+		}
+	}
+	idx.mu.RUnlock()
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].rank != found[j].rank {
+			return found[i].rank < found[j].rank
+		}
+		if found[i].File != found[j].File {
+			return found[i].File < found[j].File
+		}
+		return found[i].Line < found[j].Line
+	})
+	var symbols []Symbol
+	for i, f := range found {
+		if limit > 0 && i >= limit {
+			break
+		}
+		symbols = append(symbols, f.Symbol)
+	}
+	return symbols
+}
+
+// Search finds lines containing query, ignoring case. Files whose trigrams
+// can't contain it are never read. glob, if set, limits the files searched.
+func (idx *Index) Search(query, glob string, limit int) ([]Match, error) {
+	if query == "" {
+		return nil, errors.New("empty query")
+	}
+	if glob != "" {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", glob, err)
+		}
+	}
+	lower := strings.ToLower(query)
+	want := trigrams([]byte(lower))
+
+	idx.mu.RLock()
+	var candidates []string
+	for name, e := range idx.files {
+		if glob != "" && !matchGlob(glob, name) {
+			continue
+		}
+		ok := true
+		for _, t := range want {
+			if !hasTrigram(e.Trigrams, t) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			candidates = append(candidates, name)
+		}
+	}
+	idx.mu.RUnlock()
+	sort.Strings(candidates)
+
+	var matches []Match
+	for _, name := range candidates {
+		// The file may have been swapped for a symlink since it was indexed.
+		content, err := ReadFile(idx.Root, name)
+		if err != nil {
+			continue
+		}
+		for i, line := range strings.Split(string(content), "\n") {
+			if strings.Contains(strings.ToLower(line), lower) {
+				matches = append(matches, Match{File: name, Line: i + 1, Text: strings.TrimSpace(line)})
+				if limit > 0 && len(matches) >= limit {
+					return matches, nil
+				}
+			}
+		}
+	}
+	return matches, nil
+}
+
+// matchGlob matches a glob against a path, or against its base name when
+// the glob has no slash, so "*.go" finds Go files anywhere.
+func matchGlob(glob, name string) bool {
+	if !strings.Contains(glob, "/") {
+		name = path.Base(name)
+	}
+	ok, _ := path.Match(glob, name)
+	return ok
+}
+
+// Outline lists each package's exported declarations, for an overview of
+// the repository.
+func (idx *Index) Outline() string {
+	byPkg := make(map[string][]Symbol)
+	idx.mu.RLock()
+	for name, e := range idx.files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		for _, s := range e.Symbols {
+			if s.Kind != "package" && ast.IsExported(s.Name) && (s.Receiver == "" || ast.IsExported(s.Receiver)) {
+				dir := path.Dir(name)
+				byPkg[dir] = append(byPkg[dir], s)
+			}
+		}
+	}
+	idx.mu.RUnlock()
+
+	dirs := make([]string, 0, len(byPkg))
+	for dir := range byPkg {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	var b strings.Builder
+	for _, dir := range dirs {
+		symbols := byPkg[dir]
+		sort.Slice(symbols, func(i, j int) bool {
+			if symbols[i].Receiver != symbols[j].Receiver {
+				return symbols[i].Receiver < symbols[j].Receiver
+			}
+			return symbols[i].Name < symbols[j].Name
+		})
+		names := make([]string, len(symbols))
+		for i, s := range symbols {
+			names[i] = s.Name
+			if s.Receiver != "" {
+				names[i] = s.Receiver + "." + s.Name
+			}
+		}
+		fmt.Fprintf(&b, "%s (package %s): %s\n", dir, symbols[0].Package, strings.Join(names, ", "))
+	}
+	return b.String()
+}
+
+// Stat returns the info of the file name under root, if it is a regular
+// file that is really inside root: it isn't a symlink, and no directory on
+// the way to it leads out of root. It keeps what agents read from the
+// worktree inside the worktree.
+func Stat(root, name string) (fs.FileInfo, error) {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+	return stat(realRoot, root, name)
+}
+
+// ReadFile reads the file name under root, if Stat allows it.
+func ReadFile(root, name string) ([]byte, error) {
+	if _, err := Stat(root, name); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+}
+
+func stat(realRoot, root, name string) (fs.FileInfo, error) {
+	full := filepath.Join(root, filepath.FromSlash(name))
+	info, err := os.Lstat(full)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, errors.New("not a regular file")
+	}
+	real, err := filepath.EvalSymlinks(full)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(realRoot, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, errors.New("outside the root")
+	}
+	return info, nil
+}
+
+// ListFiles lists the files under root that git doesn't ignore, tracked or
+// not, as slash-separated paths. Outside a git repository it walks root,
+// skipping dot-directories.
+func ListFiles(root string) []string {
+	cmd := exec.Command("git", "ls-files", "-z", "--cached", "--others", "--exclude-standard")
+	cmd.Dir = root
+	if out, err := cmd.Output(); err == nil {
+		var files []string
+		for _, p := range strings.Split(string(out), "\x00") {
+			if p != "" {
+				files = append(files, p)
+			}
+		}
+		return files
+	}
+
+	var files []string
+	_ = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if p != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if rel, err := filepath.Rel(root, p); err == nil {
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return files
+}
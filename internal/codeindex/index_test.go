@@ -0,0 +1,192 @@
+package codeindex
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, root, name, content string) {
+	t.Helper()
+	path := filepath.Join(root, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const limiterSrc = `package llm
+
+type RateLimiter struct{}
+
+func (r *RateLimiter) Acquire() error { return nil }
+
+func NewLimiter() *RateLimiter { return &RateLimiter{} }
+
+const pollLimiter = 1
+`
+
+func TestIndex_FindSymbol(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "internal/llm/ratelimit.go", limiterSrc)
+	idx, err := Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := idx.FindSymbol("RateLimiter", 0)
+	if len(got) == 0 || got[0].Kind != "type" || got[0].Line != 3 || got[0].File != "internal/llm/ratelimit.go" {
+		t.Fatalf("unexpected symbols: %v", got)
+	}
+	if got := idx.FindSymbol("RateLimiter.Acquire", 0); len(got) != 1 || got[0].Kind != "method" {
+		t.Errorf("unexpected method lookup: %v", got)
+	}
+	if got := idx.FindSymbol("llm.NewLimiter", 0); len(got) != 1 || got[0].Kind != "func" {
+		t.Errorf("unexpected package-qualified lookup: %v", got)
+	}
+	if got := idx.FindSymbol("polllimiter", 0); len(got) != 1 || got[0].Kind != "const" {
+		t.Errorf("unexpected case-insensitive lookup: %v", got)
+	}
+	if got := idx.FindSymbol("limiter", 2); len(got) != 2 {
+		t.Errorf("expected the limit to apply, got %v", got)
+	}
+}
+
+func TestIndex_Search(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "internal/llm/ratelimit.go", limiterSrc)
+	writeFile(t, root, "docs/limits.md", "# Rate limits\nConfigure a RateLimiter per provider.\n")
+	idx, err := Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := idx.Search("ratelimiter", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 4 || matches[0].File != "docs/limits.md" || matches[0].Line != 2 {
+		t.Errorf("unexpected matches: %v", matches)
+	}
+	matches, _ = idx.Search("RateLimiter", "*.go", 1)
+	if len(matches) != 1 || matches[0].String() != "internal/llm/ratelimit.go:3: type RateLimiter struct{}" {
+		t.Errorf("unexpected filtered matches: %v", matches)
+	}
+	if matches, _ := idx.Search("no such text", "", 0); len(matches) != 0 {
+		t.Errorf("expected no matches, got %v", matches)
+	}
+}
+
+func TestIndex_IncrementalUpdate(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "a.go", "package a\n\nfunc Old() {}\n")
+	writeFile(t, root, "b.go", "package a\n\nfunc B() {}\n")
+	if _, err := Open(root); err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh Open reuses the cache, and only re-reads what changed.
+	writeFile(t, root, "a.go", "package a\n\nfunc New() {}\n")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(root, "a.go"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "b.go")); err != nil {
+		t.Fatal(err)
+	}
+	idx := &Index{Root: root, files: make(map[string]*fileEntry)}
+	idx.load()
+	stats, err := idx.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Indexed != 1 || stats.Removed != 1 {
+		t.Errorf("unexpected update: %+v", stats)
+	}
+	if got := idx.FindSymbol("Old", 0); len(got) != 0 {
+		t.Errorf("stale symbol still indexed: %v", got)
+	}
+	if got := idx.FindSymbol("New", 0); len(got) != 1 {
+		t.Errorf("new symbol not indexed: %v", got)
+	}
+}
+
+func TestIndex_Outline(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "internal/llm/ratelimit.go", limiterSrc)
+	idx, err := Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "internal/llm (package llm): NewLimiter, RateLimiter, RateLimiter.Acquire"
+	if got := strings.TrimSpace(idx.Outline()); got != want {
+		t.Errorf("Outline() = %q, want %q", got, want)
+	}
+}
+
+func TestIndex_SymlinksOutOfRoot(t *testing.T) {
+	outside := t.TempDir()
+	writeFile(t, outside, "secret.go", "package secret\n\nconst Password = \"hunter2\"\n")
+	root := t.TempDir()
+	writeFile(t, root, "a.go", "package a\n\nconst Greeting = \"hunter2\"\n")
+	for name, target := range map[string]string{
+		"leak.go": filepath.Join(outside, "secret.go"),
+		"dir":     outside,
+	} {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skip("symlinks not supported:", err)
+		}
+	}
+
+	idx, err := Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := idx.FindSymbol("Password", 0); len(got) != 0 {
+		t.Errorf("indexed a file outside the root: %v", got)
+	}
+	matches, _ := idx.Search("hunter2", "", 0)
+	if len(matches) != 1 || matches[0].File != "a.go" {
+		t.Errorf("expected only a.go to match, got %v", matches)
+	}
+	if _, err := ReadFile(root, "dir/secret.go"); err == nil {
+		t.Error("expected ReadFile to refuse a path through a symlinked directory")
+	}
+
+	// A file swapped for a symlink after indexing isn't read either.
+	if err := os.Remove(filepath.Join(root, "a.go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.go"), filepath.Join(root, "a.go")); err != nil {
+		t.Fatal(err)
+	}
+	if matches, _ := idx.Search("hunter2", "", 0); len(matches) != 0 {
+		t.Errorf("read through a symlink at search time: %v", matches)
+	}
+}
+
+func TestOpen_CacheStaysOutOfTheWorktree(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := t.TempDir()
+	writeFile(t, root, "a.go", "package a\n")
+	if out, err := exec.Command("git", "-C", root, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	if _, err := Open(root); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".git", CacheFile)); err != nil {
+		t.Errorf("expected the cache in the git directory: %v", err)
+	}
+	out, err := exec.Command("git", "-C", root, "status", "--porcelain", "--untracked-files=all").Output()
+	if err != nil || strings.TrimSpace(string(out)) != "?? a.go" {
+		t.Errorf("expected only a.go to be untracked, got %q (%v)", out, err)
+	}
+}
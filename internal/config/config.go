@@ -1,6 +1,7 @@
 package config
 
 import (
+	_ "embed"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -21,41 +22,65 @@ func LoadPrompt(path string) (string, error) {
 // GetPromptPath returns the path to a prompt markdown file for the given agent.
 // The function looks for files in .github/agents/prompt_{agent}.md relative to the project root.
 func GetPromptPath(agent string) string {
-	// Find the project root by traversing up from the current directory.
-	// Assume we're running from within the project directory.
-	cwd, err := os.Getwd()
-	if err != nil {
-		// If we can't get the current directory, use a default relative path.
-		return filepath.Join(".github", "agents", "prompt_"+agent+".md")
-	}
-
-	// Traverse up to find .git directory (project root indicator).
-	for {
-		if _, err := os.Stat(filepath.Join(cwd, ".git")); err == nil {
-			return filepath.Join(cwd, ".github", "agents", "prompt_"+agent+".md")
-		}
-
-		parent := filepath.Dir(cwd)
-		if parent == cwd {
-			// Reached filesystem root without finding .git
-			break
-		}
-		cwd = parent
-	}
-
-	// Fallback to relative path from current directory.
-	return filepath.Join(".github", "agents", "prompt_"+agent+".md")
+	return filepath.Join(projectRoot(), ".github", "agents", "prompt_"+agent+".md")
 }
 
 // Config holds the Springfield configuration.
 type Config struct {
-	Agent   AgentConfig            `toml:"agent"`
-	Agents  map[string]AgentConfig `toml:"agents"`
-	Sandbox SandboxConfig          `toml:"sandbox"`
+	Agent     AgentConfig            `toml:"agent"`
+	Agents    map[string]AgentConfig `toml:"agents"`
+	Sandbox   SandboxConfig          `toml:"sandbox"`
+	Redaction RedactionConfig        `toml:"redaction"`
+	Spend     SpendConfig            `toml:"spend"`
+	Cache     CacheConfig            `toml:"cache"`
+	// RateLimits caps calls per provider across every agent sharing the
+	// limiter state, keyed by provider, e.g. [rate_limits.anthropic].
+	RateLimits map[string]RateLimitConfig `toml:"rate_limits"`
+	// Pricing overrides the built-in per-model prices, keyed by
+	// "provider/model", e.g. [pricing."anthropic/claude-haiku-4-5"].
+	Pricing map[string]PriceConfig `toml:"pricing"`
 }
 
 // AgentConfig holds agent-specific settings.
 type AgentConfig struct {
+	// Profile: what the agent is and does. The five built-in agents are
+	// defined in the embedded agents.toml.
+	Role   string `toml:"role"`
+	Prompt string `toml:"prompt"` // Prompt file name; defaults to prompt_<agent>.md
+	// ContextFiles are paths, directories, globs (with **) or "@diff" for
+	// the files changed on the branch, loaded into the context within
+	// ContextBudget bytes.
+	ContextFiles  []string `toml:"context_files"`
+	ContextBudget int      `toml:"context_budget"`
+	// ContextProviders generate context for the run, e.g. "git" for a
+	// summary of the branch and its diff.
+	ContextProviders []string `toml:"context_providers"`
+	OutputTarget     string   `toml:"output_target"` // File the final response is written to
+	Tools            []string `toml:"tools"`
+	FinishMarker     string   `toml:"finish_marker"`
+	// FinishGates are commands run in the sandbox when the agent finishes;
+	// a failure is fed back and the run goes on, for up to
+	// FinishGateAttempts failing finishes.
+	FinishGates        []string `toml:"finish_gates"`
+	FinishGateAttempts int      `toml:"finish_gate_attempts"`
+	// CriticRubric, if set, has CriticModel (the agent's own model if
+	// empty) review the final output against it, asking for up to
+	// CriticRounds revisions.
+	CriticRubric string `toml:"critic_rubric"`
+	CriticModel  string `toml:"critic_model"`
+	CriticRounds int    `toml:"critic_rounds"`
+	// Samples > 1 runs an agent with an OutputTarget best-of-N: candidates
+	// are scored by how many SampleChecks (regexps) match them, and
+	// JudgeModel (the agent's own model if empty) picks among the top
+	// scorers against JudgeRubric.
+	Samples      int      `toml:"samples"`
+	SampleChecks []string `toml:"sample_checks"`
+	JudgeRubric  string   `toml:"judge_rubric"`
+	JudgeModel   string   `toml:"judge_model"`
+	// MinApproval is an approval floor that Approval can tighten but never
+	// relax. A built-in agent's floor can't be lowered by configuration.
+	MinApproval string `toml:"min_approval"`
+
 	// Model specification can be:
 	// - "claude-opus-4-1" (uses default provider)
 	// - "anthropic/claude-opus-4-1" (explicit provider)
@@ -64,8 +89,58 @@ type AgentConfig struct {
 	Model         string `toml:"model"`          // Default model or primary model
 	PrimaryModel  string `toml:"primary_model"`  // Override for primary model (can include provider)
 	FallbackModel string `toml:"fallback_model"` // Fallback model (can include provider)
+	// Models is an ordered provider chain tried in turn; it supersedes
+	// PrimaryModel and FallbackModel. A model that fails CircuitThreshold
+	// times in a row is skipped for CircuitCooldown (a Go duration).
+	Models           []string `toml:"models"`
+	CircuitThreshold int      `toml:"circuit_threshold"`
+	CircuitCooldown  string   `toml:"circuit_cooldown"`
+
 	MaxIterations int    `toml:"max_iterations"`
 	Budget        int    `toml:"budget"`
+	Approval      string `toml:"approval"` // Human approval gate: never, risky or always
+	PiMode        string `toml:"pi_mode"`  // pi output mode: "text" or "json" (reports token usage)
+
+	// Stall handling: StallThreshold repeats of the same action, the same
+	// response or no action count as a stall, answered in turn by
+	// StallResponses ("nudge", "escalate" to EscalationModel, "abort").
+	StallThreshold  int      `toml:"stall_threshold"`
+	StallResponses  []string `toml:"stall_responses"`
+	EscalationModel string   `toml:"escalation_model"`
+
+	// LLM retries: MaxRetries attempts after the first (0 disables them,
+	// unset keeps the default), with exponential backoff between
+	// RetryBaseDelay and RetryMaxDelay (Go durations).
+	MaxRetries     *int   `toml:"max_retries"`
+	RetryBaseDelay string `toml:"retry_base_delay"`
+	RetryMaxDelay  string `toml:"retry_max_delay"`
+
+	// Network egress for sandboxed actions: "none", "allowlist" or "open".
+	// The first two run actions in containers started with no network, or on
+	// an internal network that only reaches a filtering proxy. NetworkAllow
+	// lists "host", "host:port" or "*.domain" entries.
+	Network      string   `toml:"network"`
+	NetworkAllow []string `toml:"network_allow"`
+}
+
+// ModelChain returns the models to try in order: Models if set, otherwise the
+// primary (or default) model followed by the fallback.
+func (a AgentConfig) ModelChain() []string {
+	if len(a.Models) > 0 {
+		return a.Models
+	}
+	primary := a.PrimaryModel
+	if primary == "" {
+		primary = a.Model
+	}
+	var chain []string
+	if primary != "" {
+		chain = append(chain, primary)
+	}
+	if a.FallbackModel != "" && a.FallbackModel != primary {
+		chain = append(chain, a.FallbackModel)
+	}
+	return chain
 }
 
 // SandboxConfig holds sandbox/Axon-specific settings.
@@ -74,6 +149,45 @@ type SandboxConfig struct {
 	ImageBuilder string `toml:"image_builder"`
 }
 
+// PriceConfig holds a model's prices in USD per million tokens.
+type PriceConfig struct {
+	Input      float64 `toml:"input"`
+	Output     float64 `toml:"output"`
+	CacheRead  float64 `toml:"cache_read"`
+	CacheWrite float64 `toml:"cache_write"`
+}
+
+// RedactionConfig controls secret redaction in LLM messages, logs and
+// persisted agent output.
+type RedactionConfig struct {
+	Enabled  bool     `toml:"enabled"`
+	Patterns []string `toml:"patterns"` // Extra regular expressions; a capture group limits what is replaced
+}
+
+// SpendConfig controls the cross-run spend ledger and its caps in USD.
+// A zero cap is disabled.
+type SpendConfig struct {
+	Ledger    string  `toml:"ledger"` // Defaults to .springfield/spend.jsonl
+	DailyCap  float64 `toml:"daily_cap"`
+	WeeklyCap float64 `toml:"weekly_cap"`
+	EpicCap   float64 `toml:"epic_cap"`
+}
+
+// CacheConfig controls the on-disk LLM response cache.
+type CacheConfig struct {
+	Enabled bool   `toml:"enabled"`
+	Dir     string `toml:"dir"`
+	TTL     string `toml:"ttl"`    // Go duration; empty keeps entries until evicted
+	MaxMB   int    `toml:"max_mb"` // Size limit; 0 is unlimited
+}
+
+// RateLimitConfig limits one provider. A zero limit is disabled.
+type RateLimitConfig struct {
+	RPM         int `toml:"rpm"`           // Requests per minute
+	TPM         int `toml:"tpm"`           // Tokens per minute
+	MaxInFlight int `toml:"max_in_flight"` // Concurrent calls
+}
+
 // LoadConfig loads the configuration from a .springfield.toml or config.toml file in the given directory.
 func LoadConfig(dir string) (*Config, error) {
 	cfg := &Config{
@@ -86,6 +200,12 @@ func LoadConfig(dir string) (*Config, error) {
 			Image:        "docker.io/library/debian:trixie-slim",
 			ImageBuilder: "podman",
 		},
+		Redaction: RedactionConfig{
+			Enabled: true,
+		},
+		Cache: CacheConfig{
+			Dir: filepath.Join(".springfield", "cache"),
+		},
 	}
 
 	// Try .springfield.toml first, then fall back to config.toml
@@ -103,16 +223,109 @@ func LoadConfig(dir string) (*Config, error) {
 	}
 
 	if path == "" {
+		cfg.addBuiltinAgents()
 		return cfg, nil // No config file, use defaults
 	}
 
 	if _, err := toml.DecodeFile(path, cfg); err != nil {
 		return nil, fmt.Errorf("failed to decode config file %s: %w", path, err)
 	}
+	cfg.addBuiltinAgents()
 
 	return cfg, nil
 }
 
+//go:embed agents.toml
+var builtinAgentsTOML string
+
+// BuiltinAgents returns the profiles of the agents shipped with springfield.
+func BuiltinAgents() map[string]AgentConfig {
+	var builtin struct {
+		Agents map[string]AgentConfig `toml:"agents"`
+	}
+	if _, err := toml.Decode(builtinAgentsTOML, &builtin); err != nil {
+		panic(fmt.Sprintf("invalid built-in agents.toml: %v", err))
+	}
+	return builtin.Agents
+}
+
+// BuiltinAgent returns a built-in agent's profile, or a zero AgentConfig for
+// an agent springfield doesn't ship.
+func BuiltinAgent(name string) AgentConfig {
+	return BuiltinAgents()[strings.ToLower(name)]
+}
+
+// addBuiltinAgents fills the profile fields that configured agents leave
+// empty from the built-in profiles, and adds the built-in agents that aren't
+// configured at all.
+func (c *Config) addBuiltinAgents() {
+	if c.Agents == nil {
+		c.Agents = make(map[string]AgentConfig)
+	}
+	for name, builtin := range BuiltinAgents() {
+		agentCfg, ok := c.Agents[name]
+		if !ok {
+			c.Agents[name] = builtin
+			continue
+		}
+		if agentCfg.Role == "" {
+			agentCfg.Role = builtin.Role
+		}
+		if agentCfg.Prompt == "" {
+			agentCfg.Prompt = builtin.Prompt
+		}
+		if agentCfg.ContextFiles == nil {
+			agentCfg.ContextFiles = builtin.ContextFiles
+		}
+		if agentCfg.ContextBudget == 0 {
+			agentCfg.ContextBudget = builtin.ContextBudget
+		}
+		if agentCfg.ContextProviders == nil {
+			agentCfg.ContextProviders = builtin.ContextProviders
+		}
+		if agentCfg.OutputTarget == "" {
+			agentCfg.OutputTarget = builtin.OutputTarget
+		}
+		if agentCfg.Tools == nil {
+			agentCfg.Tools = builtin.Tools
+		}
+		if agentCfg.FinishMarker == "" {
+			agentCfg.FinishMarker = builtin.FinishMarker
+		}
+		if agentCfg.FinishGates == nil {
+			agentCfg.FinishGates = builtin.FinishGates
+		}
+		if agentCfg.FinishGateAttempts == 0 {
+			agentCfg.FinishGateAttempts = builtin.FinishGateAttempts
+		}
+		if agentCfg.CriticRubric == "" {
+			agentCfg.CriticRubric = builtin.CriticRubric
+		}
+		if agentCfg.CriticModel == "" {
+			agentCfg.CriticModel = builtin.CriticModel
+		}
+		if agentCfg.CriticRounds == 0 {
+			agentCfg.CriticRounds = builtin.CriticRounds
+		}
+		if agentCfg.Samples == 0 {
+			agentCfg.Samples = builtin.Samples
+		}
+		if agentCfg.SampleChecks == nil {
+			agentCfg.SampleChecks = builtin.SampleChecks
+		}
+		if agentCfg.JudgeRubric == "" {
+			agentCfg.JudgeRubric = builtin.JudgeRubric
+		}
+		if agentCfg.JudgeModel == "" {
+			agentCfg.JudgeModel = builtin.JudgeModel
+		}
+		if builtin.MinApproval != "" {
+			agentCfg.MinApproval = builtin.MinApproval
+		}
+		c.Agents[name] = agentCfg
+	}
+}
+
 // GetAgentConfig returns the configuration for a specific agent.
 // Falls back to the default Agent config if no agent-specific config exists.
 func (c *Config) GetAgentConfig(agentName string) AgentConfig {
@@ -129,8 +342,17 @@ func (c *Config) GetAgentConfig(agentName string) AgentConfig {
 
 // mergeWithDefaults fills in any missing values from the default agent config.
 func (c *Config) mergeWithDefaults(agentConfig AgentConfig) AgentConfig {
-	if agentConfig.Model == "" && agentConfig.PrimaryModel == "" {
+	// An agent that names its own model doesn't inherit the default chain.
+	if agentConfig.Model == "" && agentConfig.PrimaryModel == "" && agentConfig.Models == nil {
 		agentConfig.Model = c.Agent.Model
+		agentConfig.PrimaryModel = c.Agent.PrimaryModel
+		agentConfig.Models = c.Agent.Models
+	}
+	if agentConfig.CircuitThreshold == 0 {
+		agentConfig.CircuitThreshold = c.Agent.CircuitThreshold
+	}
+	if agentConfig.CircuitCooldown == "" {
+		agentConfig.CircuitCooldown = c.Agent.CircuitCooldown
 	}
 	if agentConfig.FallbackModel == "" {
 		agentConfig.FallbackModel = c.Agent.FallbackModel
@@ -141,5 +363,41 @@ func (c *Config) mergeWithDefaults(agentConfig AgentConfig) AgentConfig {
 	if agentConfig.Budget == 0 {
 		agentConfig.Budget = c.Agent.Budget
 	}
+	if agentConfig.ContextBudget == 0 {
+		agentConfig.ContextBudget = c.Agent.ContextBudget
+	}
+	if agentConfig.FinishGateAttempts == 0 {
+		agentConfig.FinishGateAttempts = c.Agent.FinishGateAttempts
+	}
+	if agentConfig.StallThreshold == 0 {
+		agentConfig.StallThreshold = c.Agent.StallThreshold
+	}
+	if agentConfig.StallResponses == nil {
+		agentConfig.StallResponses = c.Agent.StallResponses
+	}
+	if agentConfig.EscalationModel == "" {
+		agentConfig.EscalationModel = c.Agent.EscalationModel
+	}
+	if agentConfig.Approval == "" {
+		agentConfig.Approval = c.Agent.Approval
+	}
+	if agentConfig.MaxRetries == nil {
+		agentConfig.MaxRetries = c.Agent.MaxRetries
+	}
+	if agentConfig.RetryBaseDelay == "" {
+		agentConfig.RetryBaseDelay = c.Agent.RetryBaseDelay
+	}
+	if agentConfig.RetryMaxDelay == "" {
+		agentConfig.RetryMaxDelay = c.Agent.RetryMaxDelay
+	}
+	if agentConfig.PiMode == "" {
+		agentConfig.PiMode = c.Agent.PiMode
+	}
+	if agentConfig.Network == "" {
+		agentConfig.Network = c.Agent.Network
+	}
+	if agentConfig.NetworkAllow == nil {
+		agentConfig.NetworkAllow = c.Agent.NetworkAllow
+	}
 	return agentConfig
 }
@@ -92,3 +92,193 @@ fallback_model = "gemini-2.0-flash"
 		t.Errorf("Expected Ralph fallback_model to be gemini-2.0-flash, got %s", ralphCfg.FallbackModel)
 	}
 }
+
+func TestGetAgentConfig_NetworkInheritance(t *testing.T) {
+	tomlContent := `
+[agent]
+network = "allowlist"
+network_allow = ["proxy.golang.org:443"]
+
+[agents.lisa]
+network = "none"
+
+[agents.ralph]
+network_allow = ["proxy.golang.org:443", "github.com:443"]
+`
+	err := os.WriteFile(".springfield.toml", []byte(tomlContent), 0644)
+	if err != nil {
+		t.Fatalf("failed to create temp config: %v", err)
+	}
+	defer os.Remove(".springfield.toml")
+
+	cfg, err := LoadConfig(".")
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if lisa := cfg.GetAgentConfig("lisa"); lisa.Network != "none" {
+		t.Errorf("lisa network = %q, want none", lisa.Network)
+	}
+	ralph := cfg.GetAgentConfig("ralph")
+	if ralph.Network != "allowlist" || len(ralph.NetworkAllow) != 2 {
+		t.Errorf("ralph network = %q %v, want allowlist with 2 entries", ralph.Network, ralph.NetworkAllow)
+	}
+	if bart := cfg.GetAgentConfig("bart"); len(bart.NetworkAllow) != 1 {
+		t.Errorf("bart should inherit the default allowlist, got %v", bart.NetworkAllow)
+	}
+}
+
+func TestGetAgentConfig_MaxRetries(t *testing.T) {
+	tomlContent := `
+[agent]
+max_retries = 3
+
+[agents.lisa]
+max_retries = 0
+`
+	err := os.WriteFile(".springfield.toml", []byte(tomlContent), 0644)
+	if err != nil {
+		t.Fatalf("failed to create temp config: %v", err)
+	}
+	defer os.Remove(".springfield.toml")
+
+	cfg, err := LoadConfig(".")
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if lisa := cfg.GetAgentConfig("lisa"); lisa.MaxRetries == nil || *lisa.MaxRetries != 0 {
+		t.Errorf("lisa max_retries = %v, want an explicit 0", lisa.MaxRetries)
+	}
+	if ralph := cfg.GetAgentConfig("ralph"); ralph.MaxRetries == nil || *ralph.MaxRetries != 3 {
+		t.Errorf("ralph max_retries = %v, want 3 inherited", ralph.MaxRetries)
+	}
+}
+
+func TestGetAgentConfig_ModelChain(t *testing.T) {
+	tomlContent := `
+[agent]
+models = ["anthropic/claude-sonnet-4-5", "openai/gpt-4o", "google/gemini-2.5-flash"]
+circuit_threshold = 2
+
+[agents.marge]
+max_iterations = 5
+
+[agents.lisa]
+primary_model = "anthropic/claude-opus-4-5"
+fallback_model = "anthropic/claude-haiku-4-5"
+`
+	err := os.WriteFile(".springfield.toml", []byte(tomlContent), 0644)
+	if err != nil {
+		t.Fatalf("failed to create temp config: %v", err)
+	}
+	defer os.Remove(".springfield.toml")
+
+	cfg, err := LoadConfig(".")
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	marge := cfg.GetAgentConfig("marge")
+	if chain := marge.ModelChain(); len(chain) != 3 || chain[1] != "openai/gpt-4o" {
+		t.Errorf("marge should inherit the default chain, got %v", chain)
+	}
+	if marge.CircuitThreshold != 2 {
+		t.Errorf("marge circuit_threshold = %d, want 2", marge.CircuitThreshold)
+	}
+
+	lisa := cfg.GetAgentConfig("lisa")
+	chain := lisa.ModelChain()
+	if len(chain) != 2 || chain[0] != "anthropic/claude-opus-4-5" || chain[1] != "anthropic/claude-haiku-4-5" {
+		t.Errorf("lisa chain = %v, want primary then fallback", chain)
+	}
+}
+
+func TestLoadConfig_Pricing(t *testing.T) {
+	tomlContent := `
+[pricing."anthropic/claude-haiku-4-5"]
+input = 1.0
+output = 5.0
+cache_read = 0.1
+cache_write = 1.25
+`
+	err := os.WriteFile(".springfield.toml", []byte(tomlContent), 0644)
+	if err != nil {
+		t.Fatalf("failed to create temp config: %v", err)
+	}
+	defer os.Remove(".springfield.toml")
+
+	cfg, err := LoadConfig(".")
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	price, ok := cfg.Pricing["anthropic/claude-haiku-4-5"]
+	if !ok {
+		t.Fatalf("pricing entry not loaded: %+v", cfg.Pricing)
+	}
+	if price.Input != 1.0 || price.Output != 5.0 || price.CacheRead != 0.1 || price.CacheWrite != 1.25 {
+		t.Errorf("unexpected price: %+v", price)
+	}
+}
+
+func TestLoadConfig_AgentProfiles(t *testing.T) {
+	tomlContent := `
+[agents.lisa]
+context_files = ["PLAN.md"]
+
+[agents.lovejoy]
+min_approval = "never"
+
+[agents.docs]
+role = "Documentation Agent"
+prompt = "prompt_docs.md"
+context_files = ["README.md", "CONTRIBUTING.md"]
+output_target = "docs/CHANGES.md"
+finish_marker = "[[DONE]]"
+max_iterations = 5
+`
+	err := os.WriteFile(".springfield.toml", []byte(tomlContent), 0644)
+	if err != nil {
+		t.Fatalf("failed to create temp config: %v", err)
+	}
+	defer os.Remove(".springfield.toml")
+
+	cfg, err := LoadConfig(".")
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	lisa := cfg.GetAgentConfig("lisa")
+	if lisa.Role != "Planning Agent" || lisa.OutputTarget != "PLAN.md" || len(lisa.ContextFiles) != 1 {
+		t.Errorf("lisa should keep her built-in profile with overridden context files, got %+v", lisa)
+	}
+	if bart := cfg.GetAgentConfig("bart"); bart.Role != "Quality Agent" || bart.OutputTarget != "FEEDBACK.md" {
+		t.Errorf("unconfigured bart should get the built-in profile, got %+v", bart)
+	}
+	if lovejoy := cfg.GetAgentConfig("lovejoy"); lovejoy.MinApproval != "risky" {
+		t.Errorf("lovejoy's approval floor must not be lowered by config, got %q", lovejoy.MinApproval)
+	}
+
+	docs := cfg.GetAgentConfig("docs")
+	if docs.Role != "Documentation Agent" || docs.Prompt != "prompt_docs.md" || docs.FinishMarker != "[[DONE]]" || docs.MaxIterations != 5 {
+		t.Errorf("custom agent profile not loaded: %+v", docs)
+	}
+	if unknown := cfg.GetAgentConfig("nobody"); unknown.Role != "" {
+		t.Errorf("an unconfigured agent should have no role, got %q", unknown.Role)
+	}
+}
+
+func TestBuiltinAgents(t *testing.T) {
+	for _, name := range []string{"marge", "lisa", "ralph", "bart", "lovejoy"} {
+		if BuiltinAgent(name).Role == "" {
+			t.Errorf("built-in agent %s has no role", name)
+		}
+		if _, _, err := FindPrompt("prompt_"+name+".md", nil); err != nil {
+			t.Errorf("built-in agent %s has no built-in prompt: %v", name, err)
+		}
+	}
+	if BuiltinAgent("LISA").Role != "Planning Agent" {
+		t.Error("built-in lookup should be case-insensitive")
+	}
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultPrompts are the built-in prompts, used when a repository doesn't
+// carry its own. They mirror .github/agents/prompt_*.md in this repository.
+//
+//go:embed prompts/*.md
+var defaultPrompts embed.FS
+
+// maxIncludeDepth stops include cycles between prompt fragments.
+const maxIncludeDepth = 10
+
+// PromptData holds the variables a prompt template can use, e.g.
+// {{.Epic}} or {{.Config.Model}}.
+type PromptData struct {
+	Agent    string
+	Epic     string
+	Worktree string
+	Date     string // YYYY-MM-DD; defaults to today
+	Config   AgentConfig
+}
+
+// PromptDirs returns the directories searched for prompts, highest
+// precedence first: project overrides in .springfield/prompts, then the
+// repository's .github/agents. The embedded defaults come last.
+func PromptDirs() []string {
+	root := projectRoot()
+	return []string{
+		filepath.Join(root, ".springfield", "prompts"),
+		filepath.Join(root, ".github", "agents"),
+	}
+}
+
+// FindPrompt returns the raw content of a prompt file and where it came from,
+// searching dirs and then the embedded defaults.
+func FindPrompt(name string, dirs []string) (string, string, error) {
+	if filepath.Ext(name) == "" {
+		name += ".md"
+	}
+	if name != filepath.Base(name) {
+		return "", "", fmt.Errorf("invalid prompt name %q", name)
+	}
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+		content, err := os.ReadFile(path)
+		if err == nil {
+			return string(content), path, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", "", fmt.Errorf("failed to read prompt file %s: %w", path, err)
+		}
+	}
+	content, err := defaultPrompts.ReadFile("prompts/" + name)
+	if err != nil {
+		return "", "", fmt.Errorf("prompt %s not found in %s or the built-in defaults", name, strings.Join(dirs, ", "))
+	}
+	return string(content), "built-in", nil
+}
+
+// RenderPrompt renders an agent's prompt_<agent>.md through text/template.
+// Prompts can use PromptData's fields and {{include "fragment.md"}} to pull
+// in a shared fragment, itself looked up and rendered the same way. A prompt
+// that doesn't parse as a template is used as plain text.
+func RenderPrompt(agent string, data PromptData) (string, error) {
+	if data.Agent == "" {
+		data.Agent = agent
+	}
+	return RenderPromptFile("prompt_"+agent+".md", data)
+}
+
+// RenderPromptFile renders the named prompt file, for agents whose profile
+// names their own prompt.
+func RenderPromptFile(name string, data PromptData) (string, error) {
+	if data.Date == "" {
+		data.Date = time.Now().Format("2006-01-02")
+	}
+	return renderPrompt(name, data, PromptDirs(), 0)
+}
+
+func renderPrompt(name string, data PromptData, dirs []string, depth int) (string, error) {
+	if depth > maxIncludeDepth {
+		return "", fmt.Errorf("prompt includes nested more than %d deep at %s", maxIncludeDepth, name)
+	}
+	content, source, err := FindPrompt(name, dirs)
+	if err != nil {
+		return "", err
+	}
+
+	funcs := template.FuncMap{
+		"include": func(fragment string) (string, error) {
+			out, err := renderPrompt(fragment, data, dirs, depth+1)
+			return strings.TrimRight(out, "\n"), err
+		},
+	}
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(content)
+	if err != nil {
+		// Not written as a template, e.g. a prompt quoting a GitHub Actions
+		// ${{ }} expression: use it as it is.
+		return content, nil
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt %s (%s): %w", name, source, err)
+	}
+	return b.String(), nil
+}
+
+// projectRoot walks up from the working directory to the nearest directory
+// containing .git, falling back to the working directory itself.
+func projectRoot() string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "."
+	}
+	for dir := cwd; ; {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return cwd
+		}
+		dir = parent
+	}
+}
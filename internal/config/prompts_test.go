@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -63,3 +64,161 @@ func TestAllPromptsExist(t *testing.T) {
 		})
 	}
 }
+
+// chdirProject makes a temporary project root the working directory.
+func chdirProject(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	orig, _ := os.Getwd()
+	t.Cleanup(func() { _ = os.Chdir(orig) })
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func writePrompt(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRenderPrompt_LookupOrder verifies project overrides win over the
+// repository's prompts, which win over the built-in defaults.
+func TestRenderPrompt_LookupOrder(t *testing.T) {
+	root := chdirProject(t)
+
+	// Nothing in the project: the embedded default is used.
+	got, err := RenderPrompt("lovejoy", PromptData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "Reverend Lovejoy") {
+		t.Errorf("expected the built-in lovejoy prompt, got %q", got)
+	}
+
+	writePrompt(t, filepath.Join(root, ".github", "agents"), "prompt_lovejoy.md", "repo prompt")
+	if got, _ := RenderPrompt("lovejoy", PromptData{}); got != "repo prompt" {
+		t.Errorf("expected the repository prompt, got %q", got)
+	}
+
+	writePrompt(t, filepath.Join(root, ".springfield", "prompts"), "prompt_lovejoy.md", "project prompt")
+	if got, _ := RenderPrompt("lovejoy", PromptData{}); got != "project prompt" {
+		t.Errorf("expected the project override, got %q", got)
+	}
+}
+
+// TestRenderPrompt_VariablesAndIncludes verifies template variables and
+// fragment includes, with fragments resolved through the same lookup.
+func TestRenderPrompt_VariablesAndIncludes(t *testing.T) {
+	root := chdirProject(t)
+	repo := filepath.Join(root, ".github", "agents")
+	writePrompt(t, repo, "prompt_ralph.md", "{{.Agent}} on {{.Epic}} in {{.Worktree}} using {{.Config.Model}} ({{.Date}})\n{{include \"_rules.md\"}}")
+	writePrompt(t, repo, "_rules.md", "Rules for {{.Agent}}.\n")
+
+	got, err := RenderPrompt("ralph", PromptData{
+		Epic:     "td-1",
+		Worktree: "worktrees/epic-td-1",
+		Date:     "2026-03-02",
+		Config:   AgentConfig{Model: "anthropic/claude-haiku-4-5"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ralph on td-1 in worktrees/epic-td-1 using anthropic/claude-haiku-4-5 (2026-03-02)\nRules for ralph."
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// The built-in fragment is found when the project has none.
+	writePrompt(t, repo, "prompt_bart.md", `{{include "_reasoning.md"}}`)
+	if got, err := RenderPrompt("bart", PromptData{}); err != nil || !strings.Contains(got, "<thought>") {
+		t.Errorf("expected the built-in fragment, got %q, %v", got, err)
+	}
+}
+
+// TestRenderPrompt_PlainText verifies prompts that aren't templates load as
+// they are.
+func TestRenderPrompt_PlainText(t *testing.T) {
+	root := chdirProject(t)
+	repo := filepath.Join(root, ".github", "agents")
+
+	cases := map[string]string{
+		"ralph": "Pass the token as ${{ secrets.TOKEN }} in the workflow.",
+		"bart":  "Go templates open with {{ and close with }}.",
+		"lisa":  "Example: {{.Name}",
+	}
+	for agent, content := range cases {
+		writePrompt(t, repo, "prompt_"+agent+".md", content)
+		if got, err := RenderPrompt(agent, PromptData{}); err != nil || got != content {
+			t.Errorf("%s: got %q, %v; want the prompt as written", agent, got, err)
+		}
+	}
+
+	// A fragment that isn't a template is included as written.
+	writePrompt(t, repo, "prompt_marge.md", `{{include "_ci.md"}}`)
+	writePrompt(t, repo, "_ci.md", "if: ${{ github.ref == 'refs/heads/main' }}\n")
+	if got, err := RenderPrompt("marge", PromptData{}); err != nil || got != "if: ${{ github.ref == 'refs/heads/main' }}" {
+		t.Errorf("got %q, %v", got, err)
+	}
+}
+
+// TestRenderPrompt_Errors verifies bad templates fail with the prompt's source.
+func TestRenderPrompt_Errors(t *testing.T) {
+	root := chdirProject(t)
+	repo := filepath.Join(root, ".github", "agents")
+
+	writePrompt(t, repo, "prompt_ralph.md", `{{include "_loop.md"}}`)
+	writePrompt(t, repo, "_loop.md", `{{include "_loop.md"}}`)
+	if _, err := RenderPrompt("ralph", PromptData{}); err == nil || !strings.Contains(err.Error(), "nested") {
+		t.Errorf("expected an include cycle error, got %v", err)
+	}
+
+	writePrompt(t, repo, "prompt_bart.md", `{{include "../secrets.md"}}`)
+	if _, err := RenderPrompt("bart", PromptData{}); err == nil {
+		t.Error("expected includes outside the prompt directories to be refused")
+	}
+
+	writePrompt(t, repo, "prompt_lisa.md", `{{.Unknown}}`)
+	if _, err := RenderPrompt("lisa", PromptData{}); err == nil || !strings.Contains(err.Error(), "prompt_lisa.md") {
+		t.Errorf("expected an error naming the prompt, got %v", err)
+	}
+
+	if _, err := RenderPrompt("nobody", PromptData{}); err == nil {
+		t.Error("expected a missing prompt to fail")
+	}
+}
+
+// TestEmbeddedPromptsMatchRepo keeps the built-in defaults in step with the
+// prompts in .github/agents.
+func TestEmbeddedPromptsMatchRepo(t *testing.T) {
+	entries, err := defaultPrompts.ReadDir("prompts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		embedded, _ := defaultPrompts.ReadFile("prompts/" + e.Name())
+		repo, err := os.ReadFile(filepath.Join("..", "..", ".github", "agents", e.Name()))
+		if err != nil {
+			t.Errorf("built-in prompt %s has no counterpart in .github/agents: %v", e.Name(), err)
+			continue
+		}
+		if string(embedded) != string(repo) {
+			t.Errorf("internal/config/prompts/%s is out of date with .github/agents/%s", e.Name(), e.Name())
+		}
+	}
+
+	repoPrompts, _ := filepath.Glob(filepath.Join("..", "..", ".github", "agents", "prompt_*.md"))
+	for _, path := range repoPrompts {
+		if _, err := defaultPrompts.ReadFile("prompts/" + filepath.Base(path)); err != nil {
+			t.Errorf("%s has no built-in default in internal/config/prompts", path)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Package decision defines the typed result an agent hands back to the
+// orchestrator when it finishes, in place of the agent running td itself.
+package decision
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Decision is an agent's final verdict on an epic.
+type Decision struct {
+	Decision  string   `json:"decision"`
+	Summary   string   `json:"summary,omitempty"`
+	Artefacts []string `json:"artefacts,omitempty"` // Files, commits or branches the agent produced
+}
+
+// ErrMissing is returned when a response carries no <decision> block.
+var ErrMissing = errors.New("no <decision> block found")
+
+var blockRegex = regexp.MustCompile(`(?s)<decision>\s*(.*?)\s*</decision>`)
+
+// Parse reads the last <decision>{json}</decision> block in an agent
+// response. A block holding a bare word is taken as the decision alone.
+func Parse(resp string) (*Decision, error) {
+	matches := blockRegex.FindAllStringSubmatch(resp, -1)
+	if len(matches) == 0 {
+		return nil, ErrMissing
+	}
+	body := strings.TrimSpace(matches[len(matches)-1][1])
+	body = strings.TrimSuffix(strings.TrimPrefix(body, "```json"), "```")
+	body = strings.TrimSpace(body)
+
+	var d Decision
+	if strings.HasPrefix(body, "{") {
+		if err := json.Unmarshal([]byte(body), &d); err != nil {
+			return nil, fmt.Errorf("invalid <decision> JSON: %w", err)
+		}
+	} else {
+		d.Decision = body
+	}
+	d.Decision = strings.TrimSpace(d.Decision)
+	if d.Decision == "" {
+		return nil, errors.New(`<decision> block has no "decision" field`)
+	}
+	return &d, nil
+}
+
+// Validate checks the decision is one of the allowed signals. An empty
+// allowed list accepts anything.
+func (d *Decision) Validate(allowed []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, a := range allowed {
+		if d.Decision == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("decision %q is not allowed here; expected one of: %s", d.Decision, strings.Join(allowed, ", "))
+}
+
+// Strip removes <decision> blocks from a response, e.g. before it is
+// persisted as a document.
+func Strip(resp string) string {
+	return blockRegex.ReplaceAllString(resp, "")
+}
+
+// Write saves a decision as JSON for the orchestrator to pick up.
+func Write(path string, d *Decision) error {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Read loads a decision written by Write. A missing file returns nil, nil:
+// the agent finished without deciding.
+func Read(path string) (*Decision, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var d Decision
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("failed to parse decision file %s: %w", path, err)
+	}
+	return &d, nil
+}
@@ -0,0 +1,68 @@
+package decision
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	resp := `<thought>All green.</thought>
+<decision>{"decision": "bart_ok", "summary": "tests pass", "artefacts": ["FEEDBACK.md"]}</decision>
+[[FINISH]]`
+	d, err := Parse(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Decision != "bart_ok" || d.Summary != "tests pass" || len(d.Artefacts) != 1 {
+		t.Errorf("unexpected decision: %+v", d)
+	}
+
+	// A bare word and a fenced block are accepted; the last block wins.
+	d, err = Parse("<decision>ralph_done</decision> <decision>\n```json\n{\"decision\": \"bart_ok\"}\n```\n</decision>")
+	if err != nil || d.Decision != "bart_ok" {
+		t.Errorf("expected bart_ok, got %+v, %v", d, err)
+	}
+
+	if _, err := Parse("done [[FINISH]]"); !errors.Is(err, ErrMissing) {
+		t.Errorf("expected ErrMissing, got %v", err)
+	}
+	if _, err := Parse(`<decision>{"decision": </decision>`); err == nil {
+		t.Error("expected invalid JSON to fail")
+	}
+	if _, err := Parse(`<decision>{"summary": "x"}</decision>`); err == nil {
+		t.Error("expected a missing decision field to fail")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	d := &Decision{Decision: "bart_ok"}
+	if err := d.Validate([]string{"ralph_done"}); err == nil || !strings.Contains(err.Error(), "ralph_done") {
+		t.Errorf("expected a refusal naming the allowed decisions, got %v", err)
+	}
+	if err := d.Validate([]string{"bart_ok", "bart_fail_implementation"}); err != nil {
+		t.Error(err)
+	}
+	if err := d.Validate(nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decision.json")
+	if d, err := Read(path); d != nil || err != nil {
+		t.Errorf("missing file should be nil, nil; got %+v, %v", d, err)
+	}
+	want := &Decision{Decision: "ralph_done", Summary: "done", Artefacts: []string{"abc123"}}
+	if err := Write(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Decision != want.Decision || got.Summary != want.Summary || got.Artefacts[0] != "abc123" {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,186 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CachingLLM stores successful responses on disk keyed by a hash of the model
+// and the normalised conversation, so re-running an agent on unchanged input
+// doesn't pay for identical prompts again. Hits are returned with Cached set
+// and zero token usage.
+type CachingLLM struct {
+	Client   LLMClient
+	Model    string        // Configured model (or chain) the key is scoped to
+	Dir      string        // Cache directory
+	TTL      time.Duration // Entries older than this are ignored; 0 keeps them forever
+	MaxBytes int64         // Oldest entries are evicted above this size; 0 is unlimited
+
+	now func() time.Time
+}
+
+type cacheEntry struct {
+	Created    time.Time  `json:"created"`
+	Model      string     `json:"model"`
+	Content    string     `json:"content"`
+	TokenUsage TokenUsage `json:"token_usage"` // What the original call cost
+}
+
+func (c *CachingLLM) Chat(ctx context.Context, messages []Message) (Response, error) {
+	return c.ChatStream(ctx, messages, nil)
+}
+
+func (c *CachingLLM) ChatStream(ctx context.Context, messages []Message, onEvent func(StreamEvent)) (Response, error) {
+	logger := GetLogger("CachingLLM")
+	key := c.Key(messages)
+
+	if entry, ok := c.load(key); ok {
+		logger.Debugf("Cache hit %s (saved %d tokens)", key[:12], entry.TokenUsage.TotalTokens)
+		if onEvent != nil {
+			onEvent(StreamEvent{Type: StreamText, Text: entry.Content})
+		}
+		return Response{Content: entry.Content, Model: entry.Model, Cached: true}, nil
+	}
+
+	resp, err := ChatWithStream(ctx, c.Client, messages, onEvent)
+	if err != nil {
+		return resp, err
+	}
+	if err := c.store(key, resp); err != nil {
+		logger.WithError(err).Warnf("Failed to write cache entry")
+	}
+	return resp, nil
+}
+
+// Key returns the cache key for a conversation.
+func (c *CachingLLM) Key(messages []Message) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "model=%s\x00", c.Model)
+	for _, msg := range messages {
+		fmt.Fprintf(h, "%s\x00%s\x00", msg.Role, normaliseForCache(msg.Content))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// normaliseForCache ignores differences that don't change a prompt's
+// meaning: line endings and trailing whitespace.
+func normaliseForCache(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func (c *CachingLLM) path(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
+
+func (c *CachingLLM) load(key string) (cacheEntry, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		_ = os.Remove(c.path(key))
+		return cacheEntry{}, false
+	}
+	if c.TTL > 0 && c.clock().Sub(entry.Created) > c.TTL {
+		_ = os.Remove(c.path(key))
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *CachingLLM) store(key string, resp Response) error {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(cacheEntry{
+		Created:    c.clock(),
+		Model:      resp.Model,
+		Content:    resp.Content,
+		TokenUsage: resp.TokenUsage,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Write atomically so a concurrent reader never sees half an entry.
+	tmp, err := os.CreateTemp(c.Dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return c.evict()
+}
+
+// evict removes the oldest entries until the cache fits in MaxBytes.
+func (c *CachingLLM) evict() error {
+	if c.MaxBytes <= 0 {
+		return nil
+	}
+	files, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return err
+	}
+
+	type cached struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var entries []cached
+	var total int64
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, cached{filepath.Join(c.Dir, f.Name()), info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+	for _, e := range entries {
+		if total <= c.MaxBytes {
+			break
+		}
+		if err := os.Remove(e.path); err == nil {
+			total -= e.size
+		}
+	}
+	return nil
+}
+
+func (c *CachingLLM) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,109 @@
+package llm
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+// countingLLM answers every call with fixed content and usage.
+type countingLLM struct {
+	calls int
+}
+
+func (c *countingLLM) Chat(ctx context.Context, messages []Message) (Response, error) {
+	c.calls++
+	return Response{
+		Content:    "answer",
+		Model:      "anthropic/claude-haiku-4-5",
+		TokenUsage: TokenUsage{PromptTokens: 100, CompletionTokens: 10, TotalTokens: 110},
+	}, nil
+}
+
+func TestCachingLLM_HitIsFree(t *testing.T) {
+	inner := &countingLLM{}
+	c := &CachingLLM{Client: inner, Model: "anthropic/claude-haiku-4-5", Dir: t.TempDir()}
+	messages := []Message{{Role: "system", Content: "You are Lisa."}, {Role: "user", Content: "Plan it"}}
+
+	first, err := c.Chat(context.Background(), messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Cached || first.TokenUsage.TotalTokens != 110 {
+		t.Errorf("first call should be a paid miss: %+v", first)
+	}
+
+	// Whitespace and line-ending differences still hit.
+	again := []Message{{Role: "system", Content: "You are Lisa.  \r\n"}, {Role: "user", Content: "Plan it"}}
+	second, err := c.Chat(context.Background(), again)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.Cached || second.TokenUsage != (TokenUsage{}) || second.Content != "answer" || second.Model != "anthropic/claude-haiku-4-5" {
+		t.Errorf("second call should be a free hit: %+v", second)
+	}
+	if inner.calls != 1 {
+		t.Errorf("inner client called %d times, want 1", inner.calls)
+	}
+}
+
+func TestCachingLLM_KeyScope(t *testing.T) {
+	messages := []Message{{Role: "user", Content: "hi"}}
+	a := &CachingLLM{Model: "m1"}
+	b := &CachingLLM{Model: "m2"}
+	if a.Key(messages) == b.Key(messages) {
+		t.Error("different models must not share cache entries")
+	}
+	if a.Key(messages) == a.Key([]Message{{Role: "system", Content: "hi"}}) {
+		t.Error("roles must be part of the key")
+	}
+}
+
+func TestCachingLLM_TTL(t *testing.T) {
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	inner := &countingLLM{}
+	c := &CachingLLM{Client: inner, Dir: t.TempDir(), TTL: time.Hour, now: func() time.Time { return now }}
+	messages := []Message{{Role: "user", Content: "hi"}}
+
+	c.Chat(context.Background(), messages)
+	now = now.Add(30 * time.Minute)
+	c.Chat(context.Background(), messages)
+	if inner.calls != 1 {
+		t.Fatalf("entry should still be fresh, inner calls = %d", inner.calls)
+	}
+	now = now.Add(time.Hour)
+	resp, _ := c.Chat(context.Background(), messages)
+	if resp.Cached || inner.calls != 2 {
+		t.Errorf("expired entry should be refetched, inner calls = %d", inner.calls)
+	}
+}
+
+func TestCachingLLM_EvictsOldest(t *testing.T) {
+	dir := t.TempDir()
+	inner := &countingLLM{}
+	c := &CachingLLM{Client: inner, Dir: dir}
+
+	first := []Message{{Role: "user", Content: "first"}}
+	c.Chat(context.Background(), first)
+	info, err := os.Stat(c.path(c.Key(first)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Age the first entry so it is the eviction candidate.
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(c.path(c.Key(first)), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	c.MaxBytes = info.Size() + info.Size()/2 // room for one entry
+	second := []Message{{Role: "user", Content: "second"}}
+	c.Chat(context.Background(), second)
+
+	if _, err := os.Stat(c.path(c.Key(first))); !os.IsNotExist(err) {
+		t.Error("oldest entry should have been evicted")
+	}
+	if _, err := os.Stat(c.path(c.Key(second))); err != nil {
+		t.Errorf("newest entry should be kept: %v", err)
+	}
+}
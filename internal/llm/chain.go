@@ -0,0 +1,152 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ChainLink is one model in a provider chain.
+type ChainLink struct {
+	Model  string // "provider/model", reported as the serving model
+	Client LLMClient
+}
+
+// CircuitOpenError is returned when every model in a chain is cooling down.
+// RetryAfter is the time until the first circuit closes again.
+type CircuitOpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("all models in the provider chain are unavailable; next retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// ChainLLM tries each model in order until one answers. A circuit breaker per
+// model skips it for Cooldown after FailureThreshold consecutive failures, so
+// a dead provider isn't called on every turn. Once the cooldown ends the
+// model gets a single trial call; another failure reopens the circuit.
+type ChainLLM struct {
+	Links            []ChainLink
+	FailureThreshold int           // Defaults to 3
+	Cooldown         time.Duration // Defaults to 5 minutes
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+	now      func() time.Time
+}
+
+type breaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+func (c *ChainLLM) Chat(ctx context.Context, messages []Message) (Response, error) {
+	return c.ChatStream(ctx, messages, nil)
+}
+
+func (c *ChainLLM) ChatStream(ctx context.Context, messages []Message, onEvent func(StreamEvent)) (Response, error) {
+	logger := GetLogger("ChainLLM")
+	if len(c.Links) == 0 {
+		return Response{}, errors.New("provider chain has no models")
+	}
+
+	var lastErr error
+	var nextClose time.Time
+	for i, link := range c.Links {
+		if until, open := c.isOpen(link.Model); open {
+			logger.Debugf("Skipping %s: circuit open until %s", link.Model, until.Format(time.RFC3339))
+			if nextClose.IsZero() || until.Before(nextClose) {
+				nextClose = until
+			}
+			continue
+		}
+
+		resp, err := ChatWithStream(ctx, link.Client, messages, onEvent)
+		if err == nil {
+			c.recordSuccess(link.Model)
+			if resp.Model == "" {
+				resp.Model = link.Model
+			}
+			if i > 0 {
+				logger.Infof("Served by %s (chain position %d)", resp.Model, i+1)
+			}
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return Response{}, err
+		}
+
+		lastErr = err
+		if c.recordFailure(link.Model) {
+			logger.WithError(err).Warnf("Circuit opened for %s after %d consecutive failures", link.Model, c.threshold())
+		} else {
+			logger.WithError(err).Warnf("%s failed, trying next model", link.Model)
+		}
+	}
+
+	if lastErr != nil {
+		return Response{}, lastErr
+	}
+	return Response{}, &CircuitOpenError{RetryAfter: nextClose.Sub(c.clock())}
+}
+
+// isOpen reports whether calls to model are currently being skipped.
+func (c *ChainLLM) isOpen(model string) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.breakers[model]
+	if !ok || b.failures < c.threshold() {
+		return time.Time{}, false
+	}
+	return b.openUntil, c.clock().Before(b.openUntil)
+}
+
+func (c *ChainLLM) recordSuccess(model string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.breakers, model)
+}
+
+// recordFailure counts a failure and reports whether it (re)opened the circuit.
+func (c *ChainLLM) recordFailure(model string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.breakers == nil {
+		c.breakers = make(map[string]*breaker)
+	}
+	b, ok := c.breakers[model]
+	if !ok {
+		b = &breaker{}
+		c.breakers[model] = b
+	}
+	b.failures++
+	if b.failures < c.threshold() {
+		return false
+	}
+	b.openUntil = c.clock().Add(c.cooldown())
+	return true
+}
+
+func (c *ChainLLM) threshold() int {
+	if c.FailureThreshold > 0 {
+		return c.FailureThreshold
+	}
+	return 3
+}
+
+func (c *ChainLLM) cooldown() time.Duration {
+	if c.Cooldown > 0 {
+		return c.Cooldown
+	}
+	return 5 * time.Minute
+}
+
+func (c *ChainLLM) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
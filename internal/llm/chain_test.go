@@ -0,0 +1,102 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChainLLM_FallsThroughInOrder(t *testing.T) {
+	a := &mockSimpleLLM{err: errors.New("a down")}
+	b := &mockSimpleLLM{err: errors.New("b down")}
+	c := &mockSimpleLLM{response: "from c"}
+	chain := &ChainLLM{Links: []ChainLink{{"p/a", a}, {"p/b", b}, {"p/c", c}}}
+
+	resp, err := chain.Chat(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if resp.Content != "from c" || resp.Model != "p/c" {
+		t.Errorf("got %q from %q, want a response from p/c", resp.Content, resp.Model)
+	}
+	if a.calls != 1 || b.calls != 1 || c.calls != 1 {
+		t.Errorf("calls a=%d b=%d c=%d, want 1 each", a.calls, b.calls, c.calls)
+	}
+}
+
+func TestChainLLM_ReturnsLastError(t *testing.T) {
+	chain := &ChainLLM{Links: []ChainLink{
+		{"p/a", &mockSimpleLLM{err: errors.New("a down")}},
+		{"p/b", &mockSimpleLLM{err: &QuotaExceededError{Message: "quota"}}},
+	}}
+	_, err := chain.Chat(context.Background(), nil)
+	if !IsQuotaExceededError(err) {
+		t.Errorf("expected the last model's error, got %v", err)
+	}
+}
+
+func TestChainLLM_CircuitBreaker(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	primary := &mockSimpleLLM{err: errors.New("503 unavailable")}
+	backup := &mockSimpleLLM{response: "backup"}
+	chain := &ChainLLM{
+		Links:            []ChainLink{{"p/primary", primary}, {"p/backup", backup}},
+		FailureThreshold: 2,
+		Cooldown:         time.Minute,
+		now:              func() time.Time { return now },
+	}
+
+	for i := 0; i < 4; i++ {
+		if _, err := chain.Chat(context.Background(), nil); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	if primary.calls != 2 {
+		t.Errorf("primary called %d times, want 2 before the circuit opened", primary.calls)
+	}
+
+	// After the cooldown the primary gets one trial call; it fails again and
+	// the circuit reopens straight away.
+	now = now.Add(61 * time.Second)
+	chain.Chat(context.Background(), nil)
+	chain.Chat(context.Background(), nil)
+	if primary.calls != 3 {
+		t.Errorf("primary called %d times, want a single trial after cooldown", primary.calls)
+	}
+
+	// A recovered primary closes the circuit.
+	now = now.Add(61 * time.Second)
+	primary.err = nil
+	primary.response = "primary"
+	resp, _ := chain.Chat(context.Background(), nil)
+	if resp.Content != "primary" || resp.Model != "p/primary" {
+		t.Errorf("expected the recovered primary to serve, got %+v", resp)
+	}
+}
+
+func TestChainLLM_AllCircuitsOpen(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	only := &mockSimpleLLM{err: errors.New("down")}
+	chain := &ChainLLM{
+		Links:            []ChainLink{{"p/only", only}},
+		FailureThreshold: 1,
+		Cooldown:         time.Minute,
+		now:              func() time.Time { return now },
+	}
+	chain.Chat(context.Background(), nil)
+
+	now = now.Add(20 * time.Second)
+	_, err := chain.Chat(context.Background(), nil)
+	var circuitErr *CircuitOpenError
+	if !errors.As(err, &circuitErr) {
+		t.Fatalf("expected CircuitOpenError, got %v", err)
+	}
+	class, retryAfter := ClassifyError(err)
+	if class != ErrorTransient || retryAfter != 40*time.Second {
+		t.Errorf("ClassifyError = %s, %v; want transient after 40s", class, retryAfter)
+	}
+	if only.calls != 1 {
+		t.Errorf("open circuit should not be called, got %d calls", only.calls)
+	}
+}
@@ -0,0 +1,23 @@
+package llm
+
+import "strings"
+
+// NewClient returns the client for a configured model name. "ollama/<model>"
+// talks to a local Ollama server; everything else goes through the pi CLI in
+// the given output mode.
+func NewClient(model, piMode string) LLMClient {
+	if strings.HasPrefix(model, OllamaPrefix) {
+		return &OllamaLLM{Model: strings.TrimPrefix(model, OllamaPrefix)}
+	}
+	return &PiLLM{Model: model, Mode: piMode}
+}
+
+// Provider returns the provider of a "provider/model" name, or "" for a bare
+// model name.
+func Provider(model string) string {
+	provider, _, found := strings.Cut(model, "/")
+	if !found {
+		return ""
+	}
+	return provider
+}
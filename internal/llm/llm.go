@@ -7,12 +7,16 @@ type TokenUsage struct {
 	PromptTokens     int
 	CompletionTokens int
 	TotalTokens      int
+	CacheReadTokens  int
+	CacheWriteTokens int
 }
 
 // Response represents a full response from an LLM.
 type Response struct {
 	Content    string
 	TokenUsage TokenUsage
+	Model      string // The model that actually served the request, if known
+	Cached     bool   // Served from the response cache at no cost
 }
 
 // LLMClient defines the interface for interacting with a Large Language Model.
@@ -0,0 +1,177 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// OllamaPrefix selects the Ollama provider in model names ("ollama/llama3.2").
+const OllamaPrefix = "ollama/"
+
+// OllamaLLM implements LLMClient against a local Ollama server's /api/chat
+// endpoint, for prompt iteration without spending API quota.
+type OllamaLLM struct {
+	Model      string // Ollama model name, without the "ollama/" prefix
+	Host       string // Defaults to $OLLAMA_HOST, then http://localhost:11434
+	HTTPClient *http.Client
+}
+
+type ollamaMessage struct {
+	Role     string `json:"role"`
+	Content  string `json:"content"`
+	Thinking string `json:"thinking,omitempty"`
+}
+
+type ollamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+}
+
+type ollamaChatResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+func (o *OllamaLLM) Chat(ctx context.Context, messages []Message) (Response, error) {
+	body, err := o.post(ctx, messages, false)
+	if err != nil {
+		return Response{}, err
+	}
+	defer body.Close()
+
+	var chat ollamaChatResponse
+	if err := json.NewDecoder(body).Decode(&chat); err != nil {
+		return Response{}, fmt.Errorf("failed to decode ollama response: %w", err)
+	}
+	if chat.Error != "" {
+		return Response{}, fmt.Errorf("ollama error: %s", chat.Error)
+	}
+
+	resp := Response{Content: chat.Message.Content, Model: OllamaPrefix + o.Model}
+	resp.TokenUsage = ollamaUsage(chat)
+	GetLogger("OllamaLLM.Chat").Debugf("LLM call completed. Response: %d chars, %d tokens",
+		len(resp.Content), resp.TokenUsage.TotalTokens)
+	return resp, nil
+}
+
+// ChatStream reads Ollama's newline-delimited stream, reporting content and
+// thinking deltas as they arrive. Usage comes from the final chunk; a stream
+// that ends without one was cut short and is an error.
+func (o *OllamaLLM) ChatStream(ctx context.Context, messages []Message, onEvent func(StreamEvent)) (Response, error) {
+	body, err := o.post(ctx, messages, true)
+	if err != nil {
+		return Response{}, err
+	}
+	defer body.Close()
+
+	resp := Response{Model: OllamaPrefix + o.Model}
+	var content strings.Builder
+	done := false
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var chunk ollamaChatResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return Response{}, fmt.Errorf("failed to decode ollama stream: %w", err)
+		}
+		if chunk.Error != "" {
+			return Response{}, fmt.Errorf("ollama error: %s", chunk.Error)
+		}
+		if chunk.Message.Thinking != "" && onEvent != nil {
+			onEvent(StreamEvent{Type: StreamThinking, Text: chunk.Message.Thinking})
+		}
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			if onEvent != nil {
+				onEvent(StreamEvent{Type: StreamText, Text: chunk.Message.Content})
+			}
+		}
+		if chunk.Done {
+			resp.TokenUsage = ollamaUsage(chunk)
+			done = true
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Response{}, fmt.Errorf("failed to read ollama stream: %w", err)
+	}
+	if !done {
+		return Response{}, fmt.Errorf("ollama stream ended before the response was complete (%d chars received)", content.Len())
+	}
+	resp.Content = content.String()
+	return resp, nil
+}
+
+// post sends a chat request and returns the response body, or an *APIError
+// for non-2xx statuses.
+func (o *OllamaLLM) post(ctx context.Context, messages []Message, stream bool) (io.ReadCloser, error) {
+	req := ollamaChatRequest{Model: o.Model, Stream: stream}
+	for _, msg := range messages {
+		req.Messages = append(req.Messages, ollamaMessage{Role: msg.Role, Content: msg.Content})
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	url := o.host() + "/api/chat"
+	GetLogger("OllamaLLM").Debugf("POST %s (model %s, %d messages, stream=%v)", url, o.Model, len(messages), stream)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	client := o.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("ollama request failed: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		return nil, NewAPIError("ollama", resp, string(body))
+	}
+	return resp.Body, nil
+}
+
+func (o *OllamaLLM) host() string {
+	host := o.Host
+	if host == "" {
+		host = os.Getenv("OLLAMA_HOST")
+	}
+	if host == "" {
+		host = "localhost:11434"
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return strings.TrimRight(host, "/")
+}
+
+func ollamaUsage(chat ollamaChatResponse) TokenUsage {
+	return TokenUsage{
+		PromptTokens:     chat.PromptEvalCount,
+		CompletionTokens: chat.EvalCount,
+		TotalTokens:      chat.PromptEvalCount + chat.EvalCount,
+	}
+}
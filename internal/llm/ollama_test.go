@@ -0,0 +1,144 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ollamaServer stands in for a local Ollama, checking the request and
+// answering either in one object or as a stream of chunks.
+func ollamaServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" || r.Method != http.MethodPost {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var req ollamaChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("bad request body: %v", err)
+		}
+		if req.Model == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":"model \"missing\" not found, try pulling it first"}`)
+			return
+		}
+		if req.Model == "crashing" {
+			// The server dies mid-answer: no final chunk.
+			fmt.Fprintln(w, `{"model":"crashing","message":{"role":"assistant","content":"hi "},"done":false}`)
+			return
+		}
+		if len(req.Messages) != 2 || req.Messages[0].Role != "system" || req.Messages[1].Content != "hello" {
+			t.Errorf("messages not passed through: %+v", req.Messages)
+		}
+
+		if !req.Stream {
+			fmt.Fprint(w, `{"model":"llama3.2","message":{"role":"assistant","content":"hi there"},"done":true,"prompt_eval_count":26,"eval_count":4}`)
+			return
+		}
+		for _, chunk := range []string{
+			`{"model":"llama3.2","message":{"role":"assistant","content":"","thinking":"greet"},"done":false}`,
+			`{"model":"llama3.2","message":{"role":"assistant","content":"hi "},"done":false}`,
+			`{"model":"llama3.2","message":{"role":"assistant","content":"there"},"done":false}`,
+			`{"model":"llama3.2","message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":26,"eval_count":4}`,
+		} {
+			fmt.Fprintln(w, chunk)
+		}
+	}))
+}
+
+var ollamaMessages = []Message{
+	{Role: "system", Content: "you are a bot"},
+	{Role: "user", Content: "hello"},
+}
+
+func TestOllamaLLM_Chat(t *testing.T) {
+	srv := ollamaServer(t)
+	defer srv.Close()
+
+	o := &OllamaLLM{Model: "llama3.2", Host: srv.URL}
+	resp, err := o.Chat(context.Background(), ollamaMessages)
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if resp.Content != "hi there" || resp.Model != "ollama/llama3.2" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	want := TokenUsage{PromptTokens: 26, CompletionTokens: 4, TotalTokens: 30}
+	if resp.TokenUsage != want {
+		t.Errorf("usage = %+v, want %+v", resp.TokenUsage, want)
+	}
+}
+
+func TestOllamaLLM_ChatStream(t *testing.T) {
+	srv := ollamaServer(t)
+	defer srv.Close()
+
+	o := &OllamaLLM{Model: "llama3.2", Host: srv.URL}
+	var text strings.Builder
+	var thinking int
+	resp, err := o.ChatStream(context.Background(), ollamaMessages, func(ev StreamEvent) {
+		switch ev.Type {
+		case StreamText:
+			text.WriteString(ev.Text)
+		case StreamThinking:
+			thinking++
+		}
+	})
+	if err != nil {
+		t.Fatalf("ChatStream() error: %v", err)
+	}
+	if text.String() != "hi there" || resp.Content != "hi there" || thinking != 1 {
+		t.Errorf("streamed %q (thinking %d), response %q", text.String(), thinking, resp.Content)
+	}
+	if resp.TokenUsage.TotalTokens != 30 {
+		t.Errorf("usage = %+v", resp.TokenUsage)
+	}
+}
+
+func TestOllamaLLM_Errors(t *testing.T) {
+	srv := ollamaServer(t)
+	defer srv.Close()
+
+	_, err := (&OllamaLLM{Model: "missing", Host: srv.URL}).Chat(context.Background(), ollamaMessages)
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected model not found error, got %v", err)
+	}
+	if class, _ := ClassifyError(err); class != ErrorNotFound || class.Retriable() {
+		t.Errorf("a missing model shouldn't be retried, got %s", class)
+	}
+
+	resp, err := (&OllamaLLM{Model: "crashing", Host: srv.URL}).ChatStream(context.Background(), ollamaMessages, nil)
+	if err == nil || !strings.Contains(err.Error(), "ended before the response was complete") {
+		t.Errorf("expected a cut-short stream to fail, got %+v, %v", resp, err)
+	}
+
+	srv.Close()
+	_, err = (&OllamaLLM{Model: "llama3.2", Host: srv.URL}).Chat(context.Background(), ollamaMessages)
+	if class, _ := ClassifyError(err); class != ErrorTransient {
+		t.Errorf("unreachable server should be transient, got %s (%v)", class, err)
+	}
+}
+
+func TestOllamaLLM_Host(t *testing.T) {
+	t.Setenv("OLLAMA_HOST", "0.0.0.0:11435")
+	if got := (&OllamaLLM{}).host(); got != "http://0.0.0.0:11435" {
+		t.Errorf("host() = %q", got)
+	}
+	if got := (&OllamaLLM{Host: "https://gpu-box:11434/"}).host(); got != "https://gpu-box:11434" {
+		t.Errorf("host() = %q", got)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	if o, ok := NewClient("ollama/qwen2.5-coder", PiModeJSON).(*OllamaLLM); !ok || o.Model != "qwen2.5-coder" {
+		t.Errorf("ollama/ prefix should select OllamaLLM, got %#v", NewClient("ollama/qwen2.5-coder", PiModeJSON))
+	}
+	if p, ok := NewClient("anthropic/claude-haiku-4-5", PiModeJSON).(*PiLLM); !ok || p.Mode != PiModeJSON {
+		t.Errorf("other models should use pi, got %#v", NewClient("anthropic/claude-haiku-4-5", PiModeJSON))
+	}
+}
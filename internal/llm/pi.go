@@ -1,9 +1,11 @@
 package llm
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -11,7 +13,8 @@ import (
 	"strings"
 )
 
-// QuotaExceededError represents an API quota/rate limit error
+// QuotaExceededError represents an exhausted API quota. Retrying won't help
+// until it is topped up.
 type QuotaExceededError struct {
 	Message  string
 	Original error
@@ -21,20 +24,77 @@ func (e *QuotaExceededError) Error() string {
 	return fmt.Sprintf("API quota exceeded: %s", e.Message)
 }
 
-// IsQuotaExceededError checks if an error is a QuotaExceededError
+// IsQuotaExceededError checks if an error is, or wraps, a QuotaExceededError
 func IsQuotaExceededError(err error) bool {
-	_, ok := err.(*QuotaExceededError)
-	return ok
+	var quotaErr *QuotaExceededError
+	return errors.As(err, &quotaErr)
 }
 
 // PiLLM implements LLMClient by calling the 'pi' CLI.
 type PiLLM struct {
-	Model    string
-	executor func(ctx context.Context, name string, arg ...string) ([]byte, error)
+	Model string
+	// Mode selects pi's output format: PiModeText (default) or PiModeJSON,
+	// which also reports token usage. ChatStream always uses JSON.
+	Mode           string
+	executor       func(ctx context.Context, name string, arg ...string) ([]byte, error)
+	streamExecutor func(ctx context.Context, onLine func([]byte), name string, arg ...string) ([]byte, error)
 }
 
 func (p *PiLLM) Chat(ctx context.Context, messages []Message) (Response, error) {
 	logger := GetLogger("PiLLM.Chat")
+	jsonMode := p.Mode == PiModeJSON
+	args := p.buildArgs(messages, jsonMode)
+
+	execFn := p.executor
+	if execFn == nil {
+		// Default executor tries 'pi' CLI first, then falls back to npm exec.
+		// This ensures Springfield works even if pi isn't in PATH.
+		execFn = p.executorWithFallback
+	}
+
+	logger.Debugf("Executing pi CLI...")
+	out, err := execFn(ctx, "pi", args...)
+	if err != nil {
+		logger.WithError(err).Errorf("pi CLI execution failed")
+		return Response{}, err
+	}
+	return p.parseOutput(out, jsonMode)
+}
+
+// ChatStream runs pi in JSON mode and reports text, thinking and tool call
+// deltas as they arrive. pi prints nothing in text mode until it is done, so
+// with someone listening it uses JSON mode whatever Mode says; without, it
+// is just Chat.
+func (p *PiLLM) ChatStream(ctx context.Context, messages []Message, onEvent func(StreamEvent)) (Response, error) {
+	if onEvent == nil {
+		return p.Chat(ctx, messages)
+	}
+
+	logger := GetLogger("PiLLM.ChatStream")
+	args := p.buildArgs(messages, true)
+
+	streamFn := p.streamExecutor
+	if streamFn == nil {
+		streamFn = streamWithFallback
+	}
+
+	logger.Debugf("Executing pi CLI (streaming)...")
+	out, err := streamFn(ctx, func(line []byte) {
+		if ev, ok := parsePiStreamEvent(line); ok {
+			onEvent(ev)
+		}
+	}, "pi", args...)
+	if err != nil {
+		logger.WithError(err).Errorf("pi CLI execution failed")
+		return Response{}, err
+	}
+	return p.parseOutput(out, true)
+}
+
+// buildArgs turns the conversation into pi CLI arguments, asking for JSON
+// events if jsonMode is set.
+func (p *PiLLM) buildArgs(messages []Message, jsonMode bool) []string {
+	logger := GetLogger("PiLLM.buildArgs")
 
 	// Log call details
 	logger.Debugf("Starting LLM call with %d messages", len(messages))
@@ -43,6 +103,9 @@ func (p *PiLLM) Chat(ctx context.Context, messages []Message) (Response, error)
 	}
 
 	args := []string{"-p"}
+	if jsonMode {
+		args = append(args, "--mode", "json")
+	}
 
 	// Pass the model if configured
 	// The pi CLI does recognize "provider/model" format
@@ -67,24 +130,29 @@ func (p *PiLLM) Chat(ctx context.Context, messages []Message) (Response, error)
 	if systemPrompt != "" {
 		args = append(args, "--system-prompt", systemPrompt)
 	}
-	args = append(args, otherMessages...)
+	return append(args, otherMessages...)
+}
 
-	execFn := p.executor
-	if execFn == nil {
-		// Default executor tries 'pi' CLI first, then falls back to npm exec.
-		// This ensures Springfield works even if pi isn't in PATH.
-		execFn = p.executorWithFallback
-	}
+// parseOutput builds a Response from pi's stdout, in JSON or text mode.
+func (p *PiLLM) parseOutput(out []byte, jsonMode bool) (Response, error) {
+	logger := GetLogger("PiLLM.parseOutput")
 
-	logger.Debugf("Executing pi CLI...")
-	out, err := execFn(ctx, "pi", args...)
-	if err != nil {
-		logger.WithError(err).Errorf("pi CLI execution failed")
-		return Response{}, err
+	if jsonMode {
+		response, err := parsePiEvents(out)
+		if err != nil {
+			logger.WithError(err).Errorf("failed to parse pi event stream")
+			return Response{}, err
+		}
+		if response.Model == "" {
+			response.Model = p.Model
+		}
+		logger.Debugf("LLM call completed. Response: %d chars, %d tokens (model %s)",
+			len(response.Content), response.TokenUsage.TotalTokens, response.Model)
+		return response, nil
 	}
 
-	// For now, pi CLI doesn't return token usage, so we'll leave it at zero.
-	response := Response{Content: string(out)}
+	// In text mode pi doesn't report token usage, so it stays at zero.
+	response := Response{Content: string(out), Model: p.Model}
 	logger.Debugf("LLM call completed. Response: %d chars", len(response.Content))
 	return response, nil
 }
@@ -147,7 +215,7 @@ func (p *PiLLM) executorWithFallback(ctx context.Context, name string, arg ...st
 		logger.Debugf("npm exec stdout: %s", stdoutStr)
 
 		// Check for quota/rate limit errors (these are terminal conditions)
-		if isQuotaExceeded(stderrStr) {
+		if isHardQuota(stderrStr) {
 			errMsg := formatExecutionError("npm exec", npmErr, stderrStr, stdoutStr)
 			logger.WithError(npmErr).Errorf("QUOTA EXCEEDED: %s", errMsg)
 			return nil, &QuotaExceededError{
@@ -168,6 +236,64 @@ func (p *PiLLM) executorWithFallback(ctx context.Context, name string, arg ...st
 	return nil, err
 }
 
+// streamWithFallback runs the command like executorWithFallback but hands
+// each stdout line to onLine as soon as it is read. The full stdout is
+// returned once the command exits.
+func streamWithFallback(ctx context.Context, onLine func([]byte), name string, arg ...string) ([]byte, error) {
+	logger := GetLogger("streamWithFallback")
+
+	out, err := runStreaming(ctx, onLine, name, arg...)
+	if err == nil || !isCommandNotFound(err) {
+		return out, err
+	}
+
+	logger.Debugf("%s not found in PATH, falling back to npm exec", name)
+	npmArgs := append([]string{"exec", "@mariozechner/pi-coding-agent", "--"}, arg...)
+	out, err = runStreaming(ctx, func(line []byte) {
+		if !strings.HasPrefix(strings.TrimSpace(string(line)), "npm warn") {
+			onLine(line)
+		}
+	}, "npm", npmArgs...)
+	if err != nil {
+		return nil, err
+	}
+	return filterNpmOutput(out), nil
+}
+
+// runStreaming executes a command, passing stdout to onLine line by line.
+func runStreaming(ctx context.Context, onLine func([]byte), name string, arg ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, arg...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		out.Write(scanner.Bytes())
+		out.WriteByte('\n')
+		onLine(scanner.Bytes())
+	}
+	// Drain anything the scanner gave up on so the process can exit.
+	_, _ = io.Copy(io.Discard, stdout)
+
+	if err := cmd.Wait(); err != nil {
+		errMsg := formatExecutionError(name, err, stderr.String(), out.String())
+		if isHardQuota(stderr.String()) {
+			return nil, &QuotaExceededError{Message: errMsg, Original: err}
+		}
+		return nil, fmt.Errorf("%s failed: %s", name, errMsg)
+	}
+	return out.Bytes(), nil
+}
+
 // formatExecutionError creates a detailed error message from command execution failure
 func formatExecutionError(cmdName string, err error, stderr, stdout string) string {
 	var details string
@@ -225,6 +351,17 @@ func extractAnthropicErrorMessage(stderr string) string {
 	return ""
 }
 
+// isHardQuota reports whether pi failed because a quota is exhausted, as
+// opposed to a rate limit or bad credentials, which isQuotaExceeded also
+// matches but which are retried or reported as what they are.
+func isHardQuota(stderr string) bool {
+	if !isQuotaExceeded(stderr) {
+		return false
+	}
+	class := classifyMessage(stderr)
+	return class != ErrorRateLimit && class != ErrorAuth
+}
+
 // isQuotaExceeded checks if the error is due to API quota/rate limiting
 func isQuotaExceeded(stderr string) bool {
 	// Check for common quota/rate limit error patterns
@@ -0,0 +1,168 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Pi output modes. In text mode pi prints only the final answer; in JSON mode
+// it emits a JSONL event stream whose message_end events carry token usage
+// (see ADR-011).
+const (
+	PiModeText = "text"
+	PiModeJSON = "json"
+)
+
+// ParsePiMode validates a configured pi output mode. Empty means text.
+func ParsePiMode(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", PiModeText:
+		return PiModeText, nil
+	case PiModeJSON:
+		return PiModeJSON, nil
+	}
+	return "", fmt.Errorf("invalid pi mode %q (want text or json)", s)
+}
+
+// piEvent is the subset of a pi JSON-mode event we consume.
+type piEvent struct {
+	Type                  string     `json:"type"`
+	Message               *piMessage `json:"message"`
+	ToolName              string     `json:"toolName"`
+	AssistantMessageEvent *struct {
+		Type     string `json:"type"`
+		Delta    string `json:"delta"`
+		ToolCall *struct {
+			Name string `json:"name"`
+		} `json:"toolCall"`
+	} `json:"assistantMessageEvent"`
+}
+
+type piMessage struct {
+	Role    string `json:"role"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	Provider     string   `json:"provider"`
+	Model        string   `json:"model"`
+	Usage        *piUsage `json:"usage"`
+	StopReason   string   `json:"stopReason"`
+	ErrorMessage string   `json:"errorMessage"`
+}
+
+type piUsage struct {
+	Input       int `json:"input"`
+	Output      int `json:"output"`
+	CacheRead   int `json:"cacheRead"`
+	CacheWrite  int `json:"cacheWrite"`
+	TotalTokens int `json:"totalTokens"`
+}
+
+// parsePiStreamEvent maps one line of pi's event stream to a progress event.
+// Lines that carry no progress (session, turn and message boundaries) are
+// skipped.
+func parsePiStreamEvent(line []byte) (StreamEvent, bool) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || line[0] != '{' {
+		return StreamEvent{}, false
+	}
+	var ev piEvent
+	if err := json.Unmarshal(line, &ev); err != nil {
+		return StreamEvent{}, false
+	}
+
+	switch ev.Type {
+	case "message_update":
+		ame := ev.AssistantMessageEvent
+		if ame == nil {
+			return StreamEvent{}, false
+		}
+		switch ame.Type {
+		case "text_delta":
+			return StreamEvent{Type: StreamText, Text: ame.Delta}, ame.Delta != ""
+		case "thinking_delta":
+			return StreamEvent{Type: StreamThinking, Text: ame.Delta}, ame.Delta != ""
+		case "toolcall_end":
+			if ame.ToolCall != nil {
+				return StreamEvent{Type: StreamTool, Text: ame.ToolCall.Name}, true
+			}
+		}
+	case "tool_execution_start":
+		return StreamEvent{Type: StreamTool, Text: ev.ToolName}, ev.ToolName != ""
+	}
+	return StreamEvent{}, false
+}
+
+// parsePiEvents reconstructs a Response from pi's JSON event stream. The
+// content is the text of the last assistant message and usage is summed over
+// every assistant message, since pi may take several turns to answer. Lines
+// that are not JSON events (e.g. npm notices) are ignored.
+func parsePiEvents(out []byte) (Response, error) {
+	var resp Response
+	var found bool
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var ev piEvent
+		if err := json.Unmarshal(line, &ev); err != nil {
+			continue
+		}
+		if ev.Type != "message_end" || ev.Message == nil || ev.Message.Role != "assistant" {
+			continue
+		}
+		msg := ev.Message
+
+		if msg.StopReason == "error" || msg.StopReason == "aborted" {
+			errMsg := msg.ErrorMessage
+			if errMsg == "" {
+				errMsg = "pi stopped with reason " + msg.StopReason
+			}
+			if isHardQuota(errMsg) {
+				return Response{}, &QuotaExceededError{Message: errMsg, Original: fmt.Errorf("%s", errMsg)}
+			}
+			return Response{}, fmt.Errorf("pi error: %s", errMsg)
+		}
+
+		found = true
+		var text strings.Builder
+		for _, c := range msg.Content {
+			if c.Type == "text" {
+				text.WriteString(c.Text)
+			}
+		}
+		resp.Content = text.String()
+		if msg.Model != "" {
+			resp.Model = msg.Model
+			if msg.Provider != "" {
+				resp.Model = msg.Provider + "/" + msg.Model
+			}
+		}
+		if u := msg.Usage; u != nil {
+			total := u.TotalTokens
+			if total == 0 {
+				total = u.Input + u.Output + u.CacheRead + u.CacheWrite
+			}
+			resp.TokenUsage.PromptTokens += u.Input
+			resp.TokenUsage.CompletionTokens += u.Output
+			resp.TokenUsage.CacheReadTokens += u.CacheRead
+			resp.TokenUsage.CacheWriteTokens += u.CacheWrite
+			resp.TokenUsage.TotalTokens += total
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Response{}, fmt.Errorf("failed to read pi event stream: %w", err)
+	}
+	if !found {
+		return Response{}, fmt.Errorf("pi event stream contained no assistant message")
+	}
+	return resp, nil
+}
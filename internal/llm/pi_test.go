@@ -3,6 +3,7 @@ package llm
 import (
 	"context"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -144,3 +145,92 @@ func TestIsQuotaExceededError(t *testing.T) {
 		t.Error("IsQuotaExceededError incorrectly detected generic error as quota error")
 	}
 }
+
+const piJSONStream = `npm warn exec The following package was not found and will be installed
+{"type":"session","id":"s1"}
+{"type":"agent_start"}
+{"type":"message_end","message":{"role":"user","content":[{"type":"text","text":"hello"}]}}
+{"type":"message_update","assistantMessageEvent":{"type":"toolcall_start"}}
+{"type":"message_end","message":{"role":"assistant","content":[{"type":"toolCall","name":"read"}],"provider":"anthropic","model":"claude-sonnet-4-5","usage":{"input":100,"output":20,"cacheRead":1000,"cacheWrite":50,"totalTokens":1170},"stopReason":"toolUse"}}
+{"type":"message_end","message":{"role":"toolResult","content":[{"type":"text","text":"file contents"}]}}
+{"type":"message_end","message":{"role":"assistant","content":[{"type":"thinking","thinking":"hmm"},{"type":"text","text":"Done. "},{"type":"text","text":"[[FINISH]]"}],"provider":"anthropic","model":"claude-sonnet-4-5","usage":{"input":200,"output":30,"cacheRead":1100,"cacheWrite":0,"totalTokens":1330},"stopReason":"stop"}}
+{"type":"turn_end"}
+`
+
+func TestPiLLM_Chat_JSONMode(t *testing.T) {
+	var gotArgs []string
+	mockExec := func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		gotArgs = args
+		return []byte(piJSONStream), nil
+	}
+
+	p := &PiLLM{Model: "claude-sonnet-4-5", Mode: PiModeJSON, executor: mockExec}
+	resp, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hello"}})
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+
+	if !strings.Contains(strings.Join(gotArgs, " "), "--mode json") {
+		t.Errorf("expected --mode json in args, got %v", gotArgs)
+	}
+	if resp.Content != "Done. [[FINISH]]" {
+		t.Errorf("content = %q, want text of the last assistant message", resp.Content)
+	}
+	if resp.Model != "anthropic/claude-sonnet-4-5" {
+		t.Errorf("model = %q", resp.Model)
+	}
+	want := TokenUsage{PromptTokens: 300, CompletionTokens: 50, TotalTokens: 2500, CacheReadTokens: 2100, CacheWriteTokens: 50}
+	if resp.TokenUsage != want {
+		t.Errorf("usage = %+v, want %+v", resp.TokenUsage, want)
+	}
+}
+
+func TestPiLLM_Chat_JSONModeErrors(t *testing.T) {
+	testCases := []struct {
+		name      string
+		stream    string
+		wantQuota bool
+		wantClass ErrorClass
+	}{
+		{
+			name:      "no assistant message",
+			stream:    `{"type":"session"}` + "\n" + `{"type":"agent_end"}`,
+			wantClass: ErrorUnknown,
+		},
+		{
+			name:      "provider rate limit",
+			stream:    `{"type":"message_end","message":{"role":"assistant","content":[],"stopReason":"error","errorMessage":"429 rate limit exceeded"}}`,
+			wantClass: ErrorRateLimit,
+		},
+		{
+			name:      "provider quota",
+			stream:    `{"type":"message_end","message":{"role":"assistant","content":[],"stopReason":"error","errorMessage":"429: You have exhausted your capacity on this model"}}`,
+			wantQuota: true,
+			wantClass: ErrorQuota,
+		},
+		{
+			name:      "aborted",
+			stream:    `{"type":"message_end","message":{"role":"assistant","content":[],"stopReason":"aborted"}}`,
+			wantClass: ErrorUnknown,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockExec := func(ctx context.Context, name string, args ...string) ([]byte, error) {
+				return []byte(tc.stream), nil
+			}
+			p := &PiLLM{Mode: PiModeJSON, executor: mockExec}
+			_, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}})
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if IsQuotaExceededError(err) != tc.wantQuota {
+				t.Errorf("IsQuotaExceededError(%v) = %v, want %v", err, !tc.wantQuota, tc.wantQuota)
+			}
+			if class, _ := ClassifyError(err); class != tc.wantClass {
+				t.Errorf("ClassifyError(%v) = %s, want %s", err, class, tc.wantClass)
+			}
+		})
+	}
+}
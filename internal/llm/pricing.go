@@ -0,0 +1,104 @@
+package llm
+
+import (
+	"sort"
+	"strings"
+)
+
+// ModelPrice holds a model's prices in USD per million tokens.
+type ModelPrice struct {
+	Input      float64
+	Output     float64
+	CacheRead  float64
+	CacheWrite float64
+}
+
+// Cost returns the USD cost of the given usage at this price.
+func (p ModelPrice) Cost(usage TokenUsage) float64 {
+	const perToken = 1.0 / 1000000.0
+	return (float64(usage.PromptTokens)*p.Input +
+		float64(usage.CompletionTokens)*p.Output +
+		float64(usage.CacheReadTokens)*p.CacheRead +
+		float64(usage.CacheWriteTokens)*p.CacheWrite) * perToken
+}
+
+// UnknownModelPrice is charged for models missing from the pricing table so that
+// spend is over- rather than silently under-reported.
+var UnknownModelPrice = ModelPrice{Input: 3.00, Output: 15.00, CacheRead: 0.30, CacheWrite: 3.75}
+
+// PricingTable maps "provider/model" names to prices.
+type PricingTable map[string]ModelPrice
+
+// DefaultPricing returns the built-in list prices for the models Springfield
+// is commonly configured with.
+func DefaultPricing() PricingTable {
+	return PricingTable{
+		"anthropic/claude-haiku-4-5":  {Input: 1.00, Output: 5.00, CacheRead: 0.10, CacheWrite: 1.25},
+		"anthropic/claude-sonnet-4-5": {Input: 3.00, Output: 15.00, CacheRead: 0.30, CacheWrite: 3.75},
+		"anthropic/claude-opus-4-5":   {Input: 5.00, Output: 25.00, CacheRead: 0.50, CacheWrite: 6.25},
+		"anthropic/claude-opus-4-1":   {Input: 15.00, Output: 75.00, CacheRead: 1.50, CacheWrite: 18.75},
+		"openai/gpt-4o":               {Input: 2.50, Output: 10.00, CacheRead: 1.25},
+		"openai/gpt-4o-mini":          {Input: 0.15, Output: 0.60, CacheRead: 0.075},
+		"google/gemini-2.0-flash":     {Input: 0.10, Output: 0.40, CacheRead: 0.025},
+		"google/gemini-2.5-flash":     {Input: 0.30, Output: 2.50, CacheRead: 0.075},
+		"google/gemini-2.5-pro":       {Input: 1.25, Output: 10.00, CacheRead: 0.31},
+	}
+}
+
+// WithOverrides returns a copy of the table with the given entries added or
+// replaced.
+func (t PricingTable) WithOverrides(overrides PricingTable) PricingTable {
+	merged := make(PricingTable, len(t)+len(overrides))
+	for k, v := range t {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
+
+// Lookup finds the price for a model. An exact "provider/model" match wins;
+// local Ollama models are free; otherwise the bare model name is matched
+// regardless of provider, since the same model is often reachable through
+// several providers.
+func (t PricingTable) Lookup(model string) (ModelPrice, bool) {
+	if p, ok := t[model]; ok {
+		return p, true
+	}
+	if strings.HasPrefix(model, OllamaPrefix) {
+		return ModelPrice{}, true // local models cost nothing
+	}
+	name := bareModelName(model)
+	if name == "" {
+		return ModelPrice{}, false
+	}
+	keys := make([]string, 0, len(t))
+	for key := range t {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // deterministic when several providers list the model
+	for _, key := range keys {
+		if bareModelName(key) == name {
+			return t[key], true
+		}
+	}
+	return ModelPrice{}, false
+}
+
+// Cost returns the USD cost of usage for the model, using UnknownModelPrice when
+// the model is unknown.
+func (t PricingTable) Cost(model string, usage TokenUsage) float64 {
+	price, ok := t.Lookup(model)
+	if !ok {
+		price = UnknownModelPrice
+	}
+	return price.Cost(usage)
+}
+
+func bareModelName(model string) string {
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		return model[i+1:]
+	}
+	return model
+}
@@ -0,0 +1,60 @@
+package llm
+
+import (
+	"math"
+	"testing"
+)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-12
+}
+
+func TestModelPrice_Cost(t *testing.T) {
+	price := ModelPrice{Input: 3, Output: 15, CacheRead: 0.3, CacheWrite: 3.75}
+	usage := TokenUsage{PromptTokens: 1000, CompletionTokens: 500, CacheReadTokens: 2000, CacheWriteTokens: 400}
+
+	want := (1000*3 + 500*15 + 2000*0.3 + 400*3.75) / 1000000.0
+	if got := price.Cost(usage); !almostEqual(got, want) {
+		t.Errorf("Cost() = %v, want %v", got, want)
+	}
+}
+
+func TestPricingTable_Lookup(t *testing.T) {
+	table := DefaultPricing().WithOverrides(PricingTable{
+		"google-gemini-cli/gemini-2.0-flash": {Input: 0, Output: 0},
+	})
+
+	tests := []struct {
+		model     string
+		wantInput float64
+		wantOK    bool
+	}{
+		{"anthropic/claude-haiku-4-5", 1.00, true},
+		{"claude-sonnet-4-5", 3.00, true},               // bare name
+		{"github-copilot/claude-opus-4-1", 15.00, true}, // other provider, same model
+		{"google-gemini-cli/gemini-2.0-flash", 0, true}, // override wins exactly
+		{"ollama/llama3.2", 0, true},                    // local models are free
+		{"acme/unreleased-model", 0, false},
+	}
+	for _, tt := range tests {
+		price, ok := table.Lookup(tt.model)
+		if ok != tt.wantOK || price.Input != tt.wantInput {
+			t.Errorf("Lookup(%q) = %+v, %v; want input %v, %v", tt.model, price, ok, tt.wantInput, tt.wantOK)
+		}
+	}
+}
+
+func TestPricingTable_CostUnknownModel(t *testing.T) {
+	usage := TokenUsage{PromptTokens: 1000000}
+	if got := DefaultPricing().Cost("acme/unreleased-model", usage); !almostEqual(got, UnknownModelPrice.Input) {
+		t.Errorf("Cost() for unknown model = %v, want %v", got, UnknownModelPrice.Input)
+	}
+}
+
+func TestPricingTable_WithOverridesDoesNotMutate(t *testing.T) {
+	base := DefaultPricing()
+	_ = base.WithOverrides(PricingTable{"anthropic/claude-haiku-4-5": {Input: 99}})
+	if base["anthropic/claude-haiku-4-5"].Input == 99 {
+		t.Error("WithOverrides modified the receiver")
+	}
+}
@@ -0,0 +1,365 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RateLimit caps how hard a provider is driven. Zero disables a limit.
+type RateLimit struct {
+	RequestsPerMinute int
+	TokensPerMinute   int
+	MaxInFlight       int
+}
+
+// RateLimiter enforces a RateLimit across goroutines and, when StateDir is
+// set, across springfield processes: the sliding-window state lives in
+// <StateDir>/<Name>.json guarded by an exclusive lock file, so agents spawned
+// in parallel by the orchestrator share one budget per provider.
+type RateLimiter struct {
+	Name     string // Provider the limit applies to
+	Limit    RateLimit
+	StateDir string // Empty keeps state in memory, for this process only
+
+	mu    sync.Mutex
+	state limiterState
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+type limiterState struct {
+	Requests []time.Time    `json:"requests"`
+	Tokens   []tokenRecord  `json:"tokens"`
+	InFlight []inFlightCall `json:"in_flight"`
+}
+
+// tokenRecord is tokens spent, or reserved by the in-flight call ID until it
+// reports what it used.
+type tokenRecord struct {
+	At     time.Time `json:"at"`
+	Tokens int       `json:"tokens"`
+	ID     string    `json:"id,omitempty"`
+}
+
+type inFlightCall struct {
+	ID    string    `json:"id"`
+	PID   int       `json:"pid"`
+	Since time.Time `json:"since"`
+}
+
+const (
+	rateWindow = time.Minute
+	// staleInFlight drops in-flight slots held by callers that died without
+	// releasing them.
+	staleInFlight = 15 * time.Minute
+	// staleLock breaks a lock file left behind by a crashed process.
+	staleLock   = 10 * time.Second
+	pollLimiter = 200 * time.Millisecond
+)
+
+// Acquire blocks until a call estimated at the given number of tokens fits
+// within the limits, then reserves a slot and the estimated tokens. The
+// returned release function must be called with the call's actual token
+// usage, which replaces the estimate. Usage of 0, as from pi's text mode or a
+// failed call, isn't known, so the estimate stands.
+func (r *RateLimiter) Acquire(ctx context.Context, estimatedTokens int) (func(tokens int), error) {
+	id := fmt.Sprintf("%d-%d", os.Getpid(), r.clock().UnixNano())
+	for {
+		wait, err := r.tryAcquire(id, estimatedTokens)
+		if err != nil {
+			return nil, err
+		}
+		if wait == 0 {
+			return func(tokens int) {
+				if tokens <= 0 {
+					tokens = estimatedTokens
+				}
+				r.release(id, tokens)
+			}, nil
+		}
+		GetLogger("RateLimiter").Debugf("%s rate limit reached, waiting %s", r.Name, wait.Round(time.Millisecond))
+		if err := r.wait(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// tryAcquire reserves a slot and returns 0, or returns how long to wait
+// before trying again.
+func (r *RateLimiter) tryAcquire(id string, estimatedTokens int) (time.Duration, error) {
+	var wait time.Duration
+	err := r.update(func(s *limiterState, now time.Time) bool {
+		wait = r.blockedFor(s, now, estimatedTokens)
+		if wait > 0 {
+			return false
+		}
+		s.Requests = append(s.Requests, now)
+		s.InFlight = append(s.InFlight, inFlightCall{ID: id, PID: os.Getpid(), Since: now})
+		if estimatedTokens > 0 {
+			s.Tokens = append(s.Tokens, tokenRecord{At: now, Tokens: estimatedTokens, ID: id})
+		}
+		return true
+	})
+	return wait, err
+}
+
+func (r *RateLimiter) release(id string, tokens int) {
+	err := r.update(func(s *limiterState, now time.Time) bool {
+		for i, call := range s.InFlight {
+			if call.ID == id {
+				s.InFlight = append(s.InFlight[:i], s.InFlight[i+1:]...)
+				break
+			}
+		}
+		for i, t := range s.Tokens {
+			if t.ID == id {
+				s.Tokens = append(s.Tokens[:i], s.Tokens[i+1:]...)
+				break
+			}
+		}
+		if tokens > 0 {
+			s.Tokens = append(s.Tokens, tokenRecord{At: now, Tokens: tokens})
+		}
+		return true
+	})
+	if err != nil {
+		GetLogger("RateLimiter").WithError(err).Warnf("Failed to release %s rate limit slot", r.Name)
+	}
+}
+
+// blockedFor returns how long until a new call would fit, or 0 if it fits now.
+func (r *RateLimiter) blockedFor(s *limiterState, now time.Time, estimatedTokens int) time.Duration {
+	var wait time.Duration
+	if rpm := r.Limit.RequestsPerMinute; rpm > 0 && len(s.Requests) >= rpm {
+		wait = maxDuration(wait, s.Requests[len(s.Requests)-rpm].Add(rateWindow).Sub(now))
+	}
+	if tpm := r.Limit.TokensPerMinute; tpm > 0 && len(s.Tokens) > 0 {
+		used := 0
+		for _, t := range s.Tokens {
+			used += t.Tokens
+		}
+		// Wait for enough of the window to expire; a single call larger than
+		// the whole budget runs once the window is empty.
+		for _, t := range s.Tokens {
+			if used+estimatedTokens <= tpm {
+				break
+			}
+			used -= t.Tokens
+			wait = maxDuration(wait, t.At.Add(rateWindow).Sub(now))
+		}
+	}
+	if max := r.Limit.MaxInFlight; max > 0 && len(s.InFlight) >= max {
+		wait = maxDuration(wait, pollLimiter)
+	}
+	return wait
+}
+
+// update applies fn to the current state under the in-process mutex and, if
+// shared, the cross-process lock. The state is saved when fn returns true.
+func (r *RateLimiter) update(fn func(s *limiterState, now time.Time) bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.StateDir == "" {
+		now := r.clock()
+		r.state.prune(now)
+		fn(&r.state, now)
+		return nil
+	}
+
+	unlock, err := r.lockFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var s limiterState
+	data, err := os.ReadFile(r.statePath())
+	if err == nil {
+		if err := json.Unmarshal(data, &s); err != nil {
+			s = limiterState{} // corrupt state only loses history
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	now := r.clock()
+	s.prune(now)
+	if !fn(&s, now) {
+		return nil
+	}
+	data, err = json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := r.statePath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.statePath())
+}
+
+// lockFile takes the cross-process lock, breaking it if its holder
+// appears to have died. The lock file holds a token naming its holder, so
+// neither unlocking nor breaking a stale lock removes one another process
+// has since taken.
+func (r *RateLimiter) lockFile() (func(), error) {
+	if err := os.MkdirAll(r.StateDir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(r.StateDir, r.fileName()+".lock")
+	token := fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano())
+	deadline := time.Now().Add(2 * staleLock)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, err = f.WriteString(token)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			return func() { removeLock(path, token) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if info, statErr := os.Stat(path); statErr == nil && time.Since(info.ModTime()) > staleLock {
+			if holder, readErr := os.ReadFile(path); readErr == nil {
+				removeLock(path, string(holder))
+			}
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for rate limit lock %s", path)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// removeLock removes the lock file if it still holds token.
+func removeLock(path, token string) {
+	if holder, err := os.ReadFile(path); err == nil && string(holder) == token {
+		os.Remove(path)
+	}
+}
+
+func (r *RateLimiter) statePath() string {
+	return filepath.Join(r.StateDir, r.fileName()+".json")
+}
+
+func (r *RateLimiter) fileName() string {
+	name := strings.Map(func(c rune) rune {
+		if c == '/' || c == '\\' || c == ':' {
+			return '_'
+		}
+		return c
+	}, r.Name)
+	if name == "" {
+		name = "default"
+	}
+	return name
+}
+
+// prune drops records that no longer count against the limits.
+func (s *limiterState) prune(now time.Time) {
+	cutoff := now.Add(-rateWindow)
+	i := 0
+	for i < len(s.Requests) && !s.Requests[i].After(cutoff) {
+		i++
+	}
+	s.Requests = s.Requests[i:]
+
+	j := 0
+	for j < len(s.Tokens) && !s.Tokens[j].At.After(cutoff) {
+		j++
+	}
+	s.Tokens = s.Tokens[j:]
+
+	live := s.InFlight[:0]
+	for _, call := range s.InFlight {
+		if now.Sub(call.Since) < staleInFlight && processAlive(call.PID) {
+			live = append(live, call)
+		}
+	}
+	s.InFlight = live
+}
+
+func processAlive(pid int) bool {
+	if pid == os.Getpid() {
+		return true
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+func (r *RateLimiter) wait(ctx context.Context, d time.Duration) error {
+	if r.sleep != nil {
+		return r.sleep(ctx, d)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (r *RateLimiter) clock() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if b > a {
+		return b
+	}
+	return a
+}
+
+// RateLimitedLLM waits for its limiter before every call and reports the
+// call's actual usage back to it.
+type RateLimitedLLM struct {
+	Client  LLMClient
+	Limiter *RateLimiter
+}
+
+func (r *RateLimitedLLM) Chat(ctx context.Context, messages []Message) (Response, error) {
+	return r.ChatStream(ctx, messages, nil)
+}
+
+func (r *RateLimitedLLM) ChatStream(ctx context.Context, messages []Message, onEvent func(StreamEvent)) (Response, error) {
+	release, err := r.Limiter.Acquire(ctx, estimateTokens(messages))
+	if err != nil {
+		return Response{}, err
+	}
+	resp, err := ChatWithStream(ctx, r.Client, messages, onEvent)
+	release(resp.TokenUsage.TotalTokens)
+	return resp, err
+}
+
+// estimateTokens approximates a prompt's size at four characters per token.
+func estimateTokens(messages []Message) int {
+	chars := 0
+	for _, msg := range messages {
+		chars += len(msg.Content)
+	}
+	return chars / 4
+}
@@ -0,0 +1,253 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock advances only when the limiter sleeps.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	return nil
+}
+
+func newFakeLimiter(limit RateLimit, dir string) (*RateLimiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+	return &RateLimiter{Name: "anthropic", Limit: limit, StateDir: dir, now: clock.Now, sleep: clock.Sleep}, clock
+}
+
+func TestRateLimiter_RequestsPerMinute(t *testing.T) {
+	for _, dir := range []string{"", t.TempDir()} {
+		r, clock := newFakeLimiter(RateLimit{RequestsPerMinute: 2}, dir)
+		start := clock.Now()
+		for i := 0; i < 3; i++ {
+			release, err := r.Acquire(context.Background(), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			release(0)
+		}
+		// The third request waits for the first to leave the window.
+		if got := clock.Now().Sub(start); got != time.Minute {
+			t.Errorf("StateDir %q: waited %s, want 1m", dir, got)
+		}
+	}
+}
+
+func TestRateLimiter_TokensPerMinute(t *testing.T) {
+	r, clock := newFakeLimiter(RateLimit{TokensPerMinute: 1000}, "")
+	start := clock.Now()
+
+	release, err := r.Acquire(context.Background(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(900)
+
+	// 900 used + 50 estimated fits.
+	release, err = r.Acquire(context.Background(), 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(50)
+	if clock.Now() != start {
+		t.Fatalf("should not have waited, waited %s", clock.Now().Sub(start))
+	}
+
+	// 950 used + 200 estimated does not, until the 900 expire.
+	release, err = r.Acquire(context.Background(), 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(200)
+	if got := clock.Now().Sub(start); got != time.Minute {
+		t.Errorf("waited %s, want 1m", got)
+	}
+}
+
+func TestRateLimiter_ReservesEstimatedTokens(t *testing.T) {
+	for _, dir := range []string{"", t.TempDir()} {
+		r, clock := newFakeLimiter(RateLimit{TokensPerMinute: 1000}, dir)
+		start := clock.Now()
+
+		// Two calls in flight at once can't both spend 600 tokens.
+		releaseA, err := r.Acquire(context.Background(), 600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		releaseB, err := r.Acquire(context.Background(), 600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := clock.Now().Sub(start); got != time.Minute {
+			t.Errorf("StateDir %q: waited %s for the reservation to expire, want 1m", dir, got)
+		}
+
+		// Releasing settles the reservation at the actual usage.
+		releaseB(300)
+		releaseA(100)
+		release, err := r.Acquire(context.Background(), 600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release(0)
+		if got := clock.Now().Sub(start); got != time.Minute {
+			t.Errorf("StateDir %q: 400 used + 600 estimated should fit, waited %s", dir, got)
+		}
+	}
+}
+
+func TestRateLimiter_UnknownUsageKeepsTheEstimate(t *testing.T) {
+	r, clock := newFakeLimiter(RateLimit{TokensPerMinute: 1000}, "")
+	start := clock.Now()
+	limited := &RateLimitedLLM{Client: &mockSimpleLLM{response: "no usage reported"}, Limiter: r}
+
+	// 2400 characters is an estimated 600 tokens, and no usage is reported.
+	messages := []Message{{Role: "user", Content: strings.Repeat("x", 2400)}}
+	if _, err := limited.Chat(context.Background(), messages); err != nil {
+		t.Fatal(err)
+	}
+	release, err := r.Acquire(context.Background(), 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(600)
+	if got := clock.Now().Sub(start); got != time.Minute {
+		t.Errorf("expected the first call's estimate to count against the limit, waited %s", got)
+	}
+}
+
+func TestRateLimiter_UnlockKeepsAnotherHoldersLock(t *testing.T) {
+	r := &RateLimiter{Name: "anthropic", StateDir: t.TempDir()}
+	unlock, err := r.lockFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The lock was broken as stale and another process has taken it.
+	path := filepath.Join(r.StateDir, "anthropic.lock")
+	if err := os.WriteFile(path, []byte("other-holder"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if data, err := os.ReadFile(path); err != nil || string(data) != "other-holder" {
+		t.Errorf("unlock removed another holder's lock: %q, %v", data, err)
+	}
+
+	// A stale lock is broken.
+	old := time.Now().Add(-2 * staleLock)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err = r.lockFile()
+	if err != nil {
+		t.Fatalf("stale lock not broken: %v", err)
+	}
+	unlock()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("lock not removed on unlock: %v", err)
+	}
+}
+
+func TestRateLimiter_OversizedCallRunsInEmptyWindow(t *testing.T) {
+	r, clock := newFakeLimiter(RateLimit{TokensPerMinute: 100}, "")
+	start := clock.Now()
+	release, err := r.Acquire(context.Background(), 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(5000)
+	if clock.Now() != start {
+		t.Errorf("a call larger than the budget should still run when nothing else has")
+	}
+}
+
+func TestRateLimiter_MaxInFlightAcrossProcesses(t *testing.T) {
+	// Two limiters sharing a state directory stand in for two processes.
+	dir := t.TempDir()
+	a := &RateLimiter{Name: "anthropic", Limit: RateLimit{MaxInFlight: 1}, StateDir: dir}
+	b := &RateLimiter{Name: "anthropic", Limit: RateLimit{MaxInFlight: 1}, StateDir: dir}
+
+	release, err := a.Acquire(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var acquired atomic.Bool
+	done := make(chan error)
+	go func() {
+		releaseB, err := b.Acquire(context.Background(), 0)
+		if err == nil {
+			acquired.Store(true)
+			releaseB(0)
+		}
+		done <- err
+	}()
+
+	time.Sleep(3 * pollLimiter / 2)
+	if acquired.Load() {
+		t.Fatal("second caller acquired a slot while the first was in flight")
+	}
+	release(0)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRateLimiter_ContextCanceled(t *testing.T) {
+	r := &RateLimiter{Name: "anthropic", Limit: RateLimit{MaxInFlight: 1}}
+	if _, err := r.Acquire(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := r.Acquire(ctx, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestRateLimitedLLM_RecordsUsage(t *testing.T) {
+	r, _ := newFakeLimiter(RateLimit{TokensPerMinute: 1000}, "")
+	l := &RateLimitedLLM{Client: &countingLLM{}, Limiter: r}
+	if _, err := l.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.state.Tokens) != 1 || r.state.Tokens[0].Tokens != 110 {
+		t.Errorf("expected the call's 110 tokens to be recorded, got %+v", r.state.Tokens)
+	}
+	if len(r.state.InFlight) != 0 {
+		t.Errorf("slot not released: %+v", r.state.InFlight)
+	}
+}
+
+func TestProvider(t *testing.T) {
+	cases := map[string]string{
+		"anthropic/claude-opus-4-1":     "anthropic",
+		"openrouter/openai/gpt-4o-mini": "openrouter",
+		"gemini-2.0-flash":              "",
+	}
+	for model, want := range cases {
+		if got := Provider(model); got != want {
+			t.Errorf("Provider(%q) = %q, want %q", model, got, want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package llm
+
+import (
+	"context"
+
+	"github.com/shalomb/springfield/pkg/redact"
+)
+
+// RedactingLLM scrubs secrets from every message before it reaches the
+// wrapped client, so action output such as `env` or `cat .env` is never sent
+// to a provider.
+type RedactingLLM struct {
+	Client   LLMClient
+	Redactor *redact.Redactor
+}
+
+func (r *RedactingLLM) Chat(ctx context.Context, messages []Message) (Response, error) {
+	return r.Client.Chat(ctx, r.redactMessages(messages))
+}
+
+func (r *RedactingLLM) redactMessages(messages []Message) []Message {
+	redacted := make([]Message, len(messages))
+	for i, msg := range messages {
+		redacted[i] = Message{Role: msg.Role, Content: r.Redactor.Redact(msg.Content)}
+	}
+	return redacted
+}
@@ -0,0 +1,270 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorClass describes why an LLM call failed, which decides whether and how
+// it is retried.
+type ErrorClass string
+
+const (
+	ErrorUnknown       ErrorClass = "unknown"        // Retried, since most unexplained failures are transient
+	ErrorTransient     ErrorClass = "transient"      // Network errors, timeouts, 5xx and overload; retried
+	ErrorRateLimit     ErrorClass = "rate_limit"     // Too many requests; retried, honouring Retry-After
+	ErrorQuota         ErrorClass = "quota"          // Billing or usage quota exhausted; fails fast
+	ErrorAuth          ErrorClass = "auth"           // Bad or missing credentials; fails fast
+	ErrorContextLength ErrorClass = "context_length" // Prompt too long for the model; fails fast
+	ErrorNotFound      ErrorClass = "not_found"      // Unknown model or endpoint; fails fast
+	ErrorCanceled      ErrorClass = "canceled"       // The caller's context ended; fails fast
+)
+
+// Retriable reports whether an error of this class may succeed if retried.
+func (c ErrorClass) Retriable() bool {
+	switch c {
+	case ErrorUnknown, ErrorTransient, ErrorRateLimit:
+		return true
+	}
+	return false
+}
+
+// APIError is returned by HTTP providers so that retries can use the status
+// code and Retry-After header instead of guessing from the message.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Class      ErrorClass
+	RetryAfter time.Duration
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s API error (%d %s): %s", e.Provider, e.StatusCode, e.Class, e.Message)
+}
+
+// NewAPIError classifies a failed HTTP response.
+func NewAPIError(provider string, resp *http.Response, body string) *APIError {
+	e := &APIError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		Class:      ClassifyHTTPStatus(resp.StatusCode),
+		RetryAfter: ParseRetryAfter(resp.Header.Get("Retry-After")),
+		Message:    strings.TrimSpace(body),
+	}
+	// Providers reuse 400 and 429 for several conditions; the body is more
+	// specific than the status.
+	if class := classifyMessage(e.Message); class != ErrorUnknown && class != ErrorTransient {
+		e.Class = class
+	}
+	return e
+}
+
+// ClassifyHTTPStatus maps an HTTP status code to an error class.
+func ClassifyHTTPStatus(status int) ErrorClass {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return ErrorRateLimit
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrorAuth
+	case status == http.StatusPaymentRequired:
+		return ErrorQuota
+	case status == http.StatusRequestEntityTooLarge:
+		return ErrorContextLength
+	case status == http.StatusNotFound:
+		return ErrorNotFound
+	case status == http.StatusRequestTimeout || status >= 500:
+		return ErrorTransient
+	}
+	return ErrorUnknown
+}
+
+// ParseRetryAfter parses a Retry-After header given in seconds or as an HTTP
+// date. It returns zero if the value is missing or malformed.
+func ParseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// ClassifyError determines the class of an LLM error and any delay the
+// provider asked for before retrying.
+func ClassifyError(err error) (ErrorClass, time.Duration) {
+	if err == nil {
+		return "", 0
+	}
+	if errors.Is(err, context.Canceled) {
+		return ErrorCanceled, 0
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Class, apiErr.RetryAfter
+	}
+	var circuitErr *CircuitOpenError
+	if errors.As(err, &circuitErr) {
+		return ErrorTransient, circuitErr.RetryAfter
+	}
+
+	// The typed error is a provider's own verdict; its message may still
+	// mention the 429 the quota was reported with.
+	var quotaErr *QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		return ErrorQuota, 0
+	}
+
+	msg := err.Error()
+	retryAfter := retryAfterFromMessage(msg)
+	class := classifyMessage(msg)
+	if retryAfter > maxRetryAfter {
+		// "Try again in 6 hours" is a spent quota, not a rate limit.
+		return ErrorQuota, 0
+	}
+	if class == ErrorUnknown {
+		var netErr net.Error
+		if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+			class = ErrorTransient
+		}
+	}
+	return class, retryAfter
+}
+
+// Message patterns, checked in order. Context-length comes first so that
+// "too many tokens" isn't mistaken for a rate limit.
+var messageClasses = []struct {
+	class    ErrorClass
+	patterns []string
+}{
+	{ErrorContextLength, []string{"context length", "context_length", "context window", "maximum context", "prompt is too long", "too many tokens", "input is too long"}},
+	{ErrorAuth, []string{"401", "403", "unauthorized", "forbidden", "authentication", "invalid api key", "invalid x-api-key", "permission_denied", "not logged in"}},
+	{ErrorQuota, []string{"exhausted your capacity", "insufficient_quota", "quota", "billing", "credit balance"}},
+	{ErrorRateLimit, []string{"429", "rate limit", "rate_limit", "too many requests", "request limit exceeded"}},
+	{ErrorTransient, []string{"timeout", "timed out", "connection reset", "connection refused", "broken pipe", "eof", "500", "502", "503", "504", "529", "overloaded", "temporarily unavailable", "service unavailable", "internal server error", "bad gateway"}},
+}
+
+func classifyMessage(msg string) ErrorClass {
+	lower := strings.ToLower(msg)
+	for _, mc := range messageClasses {
+		for _, p := range mc.patterns {
+			if strings.Contains(lower, p) {
+				return mc.class
+			}
+		}
+	}
+	return ErrorUnknown
+}
+
+// retryAfterPattern finds provider hints such as "retry after 20s",
+// "Retry-After: 20", Gemini's "Please retry in 12.5s" or "try again in 6 hours".
+var retryAfterPattern = regexp.MustCompile(`(?i)(?:retry|try again)[-_ ]?(?:after|in|delay)["':\s]*([0-9]+(?:\.[0-9]+)?)\s*(ms|s|secs?|seconds?|m|mins?|minutes?|h|hrs?|hours?)?\b`)
+
+// maxRetryAfter is the longest wait a retry hint in an error message is
+// honoured for; a longer one means the quota is spent and the call fails fast.
+const maxRetryAfter = 5 * time.Minute
+
+func retryAfterFromMessage(msg string) time.Duration {
+	m := retryAfterPattern.FindStringSubmatch(msg)
+	if m == nil {
+		return 0
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0
+	}
+	unit := time.Second
+	switch u := strings.ToLower(m[2]); {
+	case u == "ms":
+		unit = time.Millisecond
+	case strings.HasPrefix(u, "m"):
+		unit = time.Minute
+	case strings.HasPrefix(u, "h"):
+		unit = time.Hour
+	}
+	return time.Duration(n * float64(unit))
+}
+
+// RetryPolicy controls how failed LLM calls are retried: exponential backoff
+// from BaseDelay, capped at MaxDelay, randomised by ±Jitter (a fraction).
+// A provider's Retry-After is always honoured even if it exceeds MaxDelay.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	Jitter     float64
+}
+
+// DefaultRetryPolicy returns the policy used when none is configured.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: 3,
+		BaseDelay:  500 * time.Millisecond,
+		MaxDelay:   30 * time.Second,
+		Jitter:     0.2,
+	}
+}
+
+// Delay returns how long to wait before retry number attempt (0-based).
+func (p RetryPolicy) Delay(attempt int, retryAfter time.Duration) time.Duration {
+	d := float64(p.BaseDelay) * math.Pow(2, float64(attempt))
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		d *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	delay := time.Duration(d)
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	return delay
+}
+
+// RetryNotify is called before each retry with the failed attempt number
+// (1-based), the error, its class and the delay about to be waited.
+type RetryNotify func(attempt int, err error, class ErrorClass, delay time.Duration)
+
+// Do calls fn until it succeeds, fails with a non-retriable error, the
+// retries are exhausted or ctx ends. It returns fn's last error.
+func (p RetryPolicy) Do(ctx context.Context, fn func() error, notify RetryNotify) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		class, retryAfter := ClassifyError(err)
+		if !class.Retriable() || attempt >= p.MaxRetries {
+			return err
+		}
+
+		delay := p.Delay(attempt, retryAfter)
+		if notify != nil {
+			notify(attempt+1, err, class, delay)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
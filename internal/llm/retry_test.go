@@ -0,0 +1,139 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	testCases := []struct {
+		name       string
+		err        error
+		class      ErrorClass
+		retryAfter time.Duration
+	}{
+		{"unknown", errors.New("something odd"), ErrorUnknown, 0},
+		{"canceled", fmt.Errorf("pi: %w", context.Canceled), ErrorCanceled, 0},
+		{"deadline", context.DeadlineExceeded, ErrorTransient, 0},
+		{"overloaded", errors.New(`Error: 529 {"type":"error","error":{"type":"overloaded_error"}}`), ErrorTransient, 0},
+		{"anthropic rate limit", errors.New(`pi error: Error: 429 {"type":"error","error":{"type":"rate_limit_error","message":"rate limit"}}`), ErrorRateLimit, 0},
+		{"gemini retry hint", errors.New("429 Too Many Requests. Please retry in 12.5s."), ErrorRateLimit, 12500 * time.Millisecond},
+		{"retry hint in minutes", errors.New("rate limit reached, try again in 2 minutes"), ErrorRateLimit, 2 * time.Minute},
+		{"retry hint beyond the cap", errors.New("429 rate limit reached, try again in 6 hours"), ErrorQuota, 0},
+		{"retry hint in seconds beyond the cap", errors.New("429 Too Many Requests. Please retry in 21600s."), ErrorQuota, 0},
+		{"gemini capacity", &QuotaExceededError{Message: "You have exhausted your capacity on this model"}, ErrorQuota, 0},
+		{"billing", &QuotaExceededError{Message: "billing_exception"}, ErrorQuota, 0},
+		{"auth", errors.New("401 Unauthorized: invalid x-api-key"), ErrorAuth, 0},
+		{"context length", errors.New("prompt is too long: 210000 tokens > 200000 maximum"), ErrorContextLength, 0},
+		{"bare quota error", &QuotaExceededError{Message: "denied"}, ErrorQuota, 0},
+		{"quota reported as 429", fmt.Errorf("chat: %w", &QuotaExceededError{Message: "429 Too Many Requests: retry in 5s"}), ErrorQuota, 0},
+		{"api error", &APIError{StatusCode: 429, Class: ErrorRateLimit, RetryAfter: 3 * time.Second}, ErrorRateLimit, 3 * time.Second},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			class, retryAfter := ClassifyError(tc.err)
+			if class != tc.class || retryAfter != tc.retryAfter {
+				t.Errorf("ClassifyError(%v) = %s, %v; want %s, %v", tc.err, class, retryAfter, tc.class, tc.retryAfter)
+			}
+		})
+	}
+}
+
+func TestNewAPIError(t *testing.T) {
+	resp := &http.Response{StatusCode: 429, Header: http.Header{"Retry-After": []string{"7"}}}
+	e := NewAPIError("ollama", resp, "slow down")
+	if e.Class != ErrorRateLimit || e.RetryAfter != 7*time.Second {
+		t.Errorf("unexpected classification: %+v", e)
+	}
+
+	resp = &http.Response{StatusCode: 400, Header: http.Header{}}
+	e = NewAPIError("ollama", resp, `{"error":"input length exceeds the context length"}`)
+	if e.Class != ErrorContextLength {
+		t.Errorf("body should refine a 400 to context_length, got %s", e.Class)
+	}
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second}
+	for attempt, w := range want {
+		if got := p.Delay(attempt, 0); got != w {
+			t.Errorf("Delay(%d) = %v, want %v", attempt, got, w)
+		}
+	}
+	if got := p.Delay(0, 5*time.Second); got != 5*time.Second {
+		t.Errorf("Retry-After should be honoured beyond MaxDelay, got %v", got)
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.Delay(1, 0); got < 100*time.Millisecond || got > 300*time.Millisecond {
+			t.Fatalf("jittered delay %v outside ±50%% of 200ms", got)
+		}
+	}
+}
+
+func TestRetryPolicy_Do(t *testing.T) {
+	p := RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond}
+
+	t.Run("retries transient errors", func(t *testing.T) {
+		calls := 0
+		var notified []ErrorClass
+		err := p.Do(context.Background(), func() error {
+			calls++
+			if calls < 3 {
+				return errors.New("503 service unavailable")
+			}
+			return nil
+		}, func(attempt int, err error, class ErrorClass, delay time.Duration) {
+			notified = append(notified, class)
+		})
+		if err != nil || calls != 3 {
+			t.Errorf("got err=%v after %d calls, want success after 3", err, calls)
+		}
+		if len(notified) != 2 || notified[0] != ErrorTransient {
+			t.Errorf("notify calls = %v", notified)
+		}
+	})
+
+	t.Run("fails fast on quota", func(t *testing.T) {
+		calls := 0
+		err := p.Do(context.Background(), func() error {
+			calls++
+			return &QuotaExceededError{Message: "insufficient_quota"}
+		}, nil)
+		if !IsQuotaExceededError(err) || calls != 1 {
+			t.Errorf("got err=%v after %d calls, want quota error after 1", err, calls)
+		}
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		calls := 0
+		err := p.Do(context.Background(), func() error {
+			calls++
+			return errors.New("boom")
+		}, nil)
+		if err == nil || calls != 4 {
+			t.Errorf("got err=%v after %d calls, want error after 4", err, calls)
+		}
+	})
+
+	t.Run("stops when context ends", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		slow := RetryPolicy{MaxRetries: 3, BaseDelay: time.Hour}
+		calls := 0
+		err := slow.Do(ctx, func() error {
+			calls++
+			cancel()
+			return errors.New("boom")
+		}, nil)
+		if err == nil || calls != 1 {
+			t.Errorf("got err=%v after %d calls, want error after 1", err, calls)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package llm
+
+import "context"
+
+// Stream event types.
+const (
+	StreamText     = "text"     // A fragment of the assistant's answer
+	StreamThinking = "thinking" // A fragment of the model's reasoning
+	StreamTool     = "tool"     // The provider started a tool call; Text is the tool name
+)
+
+// StreamEvent is an incremental update from a streaming LLM call.
+type StreamEvent struct {
+	Type string
+	Text string
+}
+
+// StreamingLLMClient is implemented by clients that can report progress while
+// a response is being generated. ChatStream calls onEvent for every delta and
+// still returns the complete Response.
+type StreamingLLMClient interface {
+	LLMClient
+	ChatStream(ctx context.Context, messages []Message, onEvent func(StreamEvent)) (Response, error)
+}
+
+// ChatWithStream streams from client when it supports streaming and
+// otherwise falls back to a plain Chat. Decorators use it to pass streaming
+// through to the clients they wrap.
+func ChatWithStream(ctx context.Context, client LLMClient, messages []Message, onEvent func(StreamEvent)) (Response, error) {
+	if s, ok := client.(StreamingLLMClient); ok && onEvent != nil {
+		return s.ChatStream(ctx, messages, onEvent)
+	}
+	return client.Chat(ctx, messages)
+}
+
+func (f *FallbackLLM) ChatStream(ctx context.Context, messages []Message, onEvent func(StreamEvent)) (Response, error) {
+	resp, err := ChatWithStream(ctx, f.Primary, messages, onEvent)
+	if err == nil {
+		return resp, nil
+	}
+	if f.Fallback == nil {
+		return resp, err
+	}
+	return ChatWithStream(ctx, f.Fallback, messages, onEvent)
+}
+
+func (r *RedactingLLM) ChatStream(ctx context.Context, messages []Message, onEvent func(StreamEvent)) (Response, error) {
+	return ChatWithStream(ctx, r.Client, r.redactMessages(messages), onEvent)
+}
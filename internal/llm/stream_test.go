@@ -0,0 +1,137 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// streamingLLM emits its response one word at a time.
+type streamingLLM struct {
+	response string
+	err      error
+}
+
+func (s *streamingLLM) Chat(ctx context.Context, messages []Message) (Response, error) {
+	return s.ChatStream(ctx, messages, func(StreamEvent) {})
+}
+
+func (s *streamingLLM) ChatStream(ctx context.Context, messages []Message, onEvent func(StreamEvent)) (Response, error) {
+	if s.err != nil {
+		return Response{}, s.err
+	}
+	for _, word := range strings.SplitAfter(s.response, " ") {
+		onEvent(StreamEvent{Type: StreamText, Text: word})
+	}
+	return Response{Content: s.response}, nil
+}
+
+func TestChatWithStream_FallsBackToChat(t *testing.T) {
+	client := &mockSimpleLLM{response: "plain"}
+	var events int
+	resp, err := ChatWithStream(context.Background(), client, nil, func(StreamEvent) { events++ })
+	if err != nil || resp.Content != "plain" {
+		t.Fatalf("ChatWithStream() = %q, %v", resp.Content, err)
+	}
+	if events != 0 || client.calls != 1 {
+		t.Errorf("expected one Chat call and no events, got %d calls and %d events", client.calls, events)
+	}
+}
+
+func TestChatWithStream_ThroughDecorators(t *testing.T) {
+	client := &RedactingLLM{
+		Client: &FallbackLLM{
+			Primary:  &streamingLLM{err: errors.New("primary down")},
+			Fallback: &streamingLLM{response: "hello streaming world"},
+		},
+	}
+
+	var got strings.Builder
+	resp, err := ChatWithStream(context.Background(), client, []Message{{Role: "user", Content: "hi"}}, func(ev StreamEvent) {
+		got.WriteString(ev.Text)
+	})
+	if err != nil {
+		t.Fatalf("ChatWithStream() error: %v", err)
+	}
+	if got.String() != "hello streaming world" || resp.Content != "hello streaming world" {
+		t.Errorf("streamed %q, response %q", got.String(), resp.Content)
+	}
+}
+
+func TestPiLLM_ChatStream(t *testing.T) {
+	stream := []string{
+		`{"type":"agent_start"}`,
+		`{"type":"message_update","assistantMessageEvent":{"type":"thinking_delta","delta":"plan"}}`,
+		`{"type":"message_update","assistantMessageEvent":{"type":"toolcall_end","toolCall":{"name":"read"}}}`,
+		`{"type":"tool_execution_start","toolName":"read"}`,
+		`{"type":"message_update","assistantMessageEvent":{"type":"text_delta","delta":"Hel"}}`,
+		`{"type":"message_update","assistantMessageEvent":{"type":"text_delta","delta":"lo"}}`,
+		`{"type":"message_end","message":{"role":"assistant","content":[{"type":"text","text":"Hello"}],"usage":{"input":10,"output":2,"totalTokens":12},"stopReason":"stop"}}`,
+	}
+	p := &PiLLM{
+		Model: "anthropic/claude-haiku-4-5",
+		Mode:  PiModeJSON,
+		streamExecutor: func(ctx context.Context, onLine func([]byte), name string, args ...string) ([]byte, error) {
+			for _, line := range stream {
+				onLine([]byte(line))
+			}
+			return []byte(strings.Join(stream, "\n")), nil
+		},
+	}
+
+	var events []StreamEvent
+	resp, err := p.ChatStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, func(ev StreamEvent) {
+		events = append(events, ev)
+	})
+	if err != nil {
+		t.Fatalf("ChatStream() error: %v", err)
+	}
+
+	want := []StreamEvent{
+		{Type: StreamThinking, Text: "plan"},
+		{Type: StreamTool, Text: "read"},
+		{Type: StreamTool, Text: "read"},
+		{Type: StreamText, Text: "Hel"},
+		{Type: StreamText, Text: "lo"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got events %+v, want %+v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, events[i], want[i])
+		}
+	}
+	if resp.Content != "Hello" || resp.TokenUsage.TotalTokens != 12 || resp.Model != "anthropic/claude-haiku-4-5" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+func TestPiLLM_ChatStreamUsesJSONInTextMode(t *testing.T) {
+	var gotArgs []string
+	p := &PiLLM{
+		Model: "anthropic/claude-haiku-4-5",
+		streamExecutor: func(ctx context.Context, onLine func([]byte), name string, args ...string) ([]byte, error) {
+			gotArgs = args
+			line := `{"type":"message_update","assistantMessageEvent":{"type":"text_delta","delta":"Hi"}}`
+			end := `{"type":"message_end","message":{"role":"assistant","content":[{"type":"text","text":"Hi"}],"usage":{"totalTokens":5},"stopReason":"stop"}}`
+			onLine([]byte(line))
+			return []byte(line + "\n" + end), nil
+		},
+	}
+
+	var events []StreamEvent
+	resp, err := p.ChatStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, func(ev StreamEvent) {
+		events = append(events, ev)
+	})
+	if err != nil {
+		t.Fatalf("ChatStream() error: %v", err)
+	}
+	if !strings.Contains(strings.Join(gotArgs, " "), "--mode json") {
+		t.Errorf("expected pi to run in JSON mode, got args %v", gotArgs)
+	}
+	if len(events) != 1 || events[0].Text != "Hi" || resp.Content != "Hi" || resp.TokenUsage.TotalTokens != 5 {
+		t.Errorf("unexpected events %+v and response %+v", events, resp)
+	}
+}
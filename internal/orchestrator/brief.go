@@ -0,0 +1,132 @@
+package orchestrator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// recentLogCount is how many of an epic's latest td logs go into a brief.
+const recentLogCount = 10
+
+// BriefData is what a task brief is rendered from.
+type BriefData struct {
+	Agent    string
+	Epic     *Issue
+	Logs     []Log    // Most recent logs, oldest first
+	Feedback []string // Bart's previous decisions and summaries
+	// FeedbackDoc and Handoff hold FEEDBACK.md and the TODO handoff when
+	// they exist.
+	FeedbackDoc string
+	Handoff     string
+	Allowed     []string
+	Worktree    string
+}
+
+var briefFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+const briefHeader = `{{define "header"}}You are working on Epic {{.Epic.ID}}: {{.Epic.Title}}
+Status: {{.Epic.Status}}{{if .Epic.Labels}} (labels: {{join .Epic.Labels ", "}}){{end}}
+{{- if .Worktree}}
+Worktree: {{.Worktree}}{{end}}
+{{- if .Epic.Description}}
+
+## Description
+{{.Epic.Description}}{{end}}
+{{- if .Logs}}
+
+## Recent activity
+{{range .Logs}}- {{if .Timestamp}}[{{.Timestamp}}] {{end}}{{if eq .Type "decision"}}decision: {{end}}{{.Message}}
+{{end}}{{end}}{{end}}`
+
+const briefFeedback = `{{define "feedback"}}{{if or .Feedback .FeedbackDoc}}
+## Previous quality feedback
+{{range .Feedback}}- {{.}}
+{{end}}{{if .FeedbackDoc}}
+FEEDBACK.md:
+{{.FeedbackDoc}}
+{{end}}{{end}}{{end}}`
+
+const briefDecision = `{{define "decision"}}{{if .Allowed}}
+Finish with a <decision> block; allowed decisions: {{join .Allowed ", "}}.
+{{end}}{{end}}`
+
+// briefTemplates are the per-agent task briefs. Agents without one get the
+// default.
+var briefTemplates = map[string]string{
+	"ralph": `{{template "header" .}}
+{{- if .Handoff}}
+## Handoff (TODO.md)
+{{.Handoff}}
+{{end}}{{template "feedback" .}}
+Implement the epic's remaining tasks in the worktree, committing as you go.
+{{template "decision" .}}`,
+
+	"bart": `{{template "header" .}}{{template "feedback" .}}
+Verify the implementation on this epic's branch and record your findings in FEEDBACK.md.
+{{template "decision" .}}`,
+
+	"lisa": `{{template "header" .}}{{template "feedback" .}}
+{{if eq .Epic.Status "blocked"}}The epic is blocked. Replan it in light of the feedback above, then mark it ready.{{else}}Break the epic down into tasks and deposit the TODO-{{.Epic.ID}}.md handoff, then mark it ready.{{end}}
+{{template "decision" .}}`,
+
+	"default": `{{template "header" .}}
+Work on this epic.
+{{template "decision" .}}`,
+}
+
+// RenderBrief renders the task brief for an agent working on an epic.
+func RenderBrief(data BriefData) (string, error) {
+	body, ok := briefTemplates[data.Agent]
+	if !ok {
+		body = briefTemplates["default"]
+	}
+	tmpl, err := template.New(data.Agent).Funcs(briefFuncs).Parse(briefHeader + briefFeedback + briefDecision + body)
+	if err != nil {
+		return "", fmt.Errorf("invalid brief template for %s: %w", data.Agent, err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render brief for %s: %w", data.Agent, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// briefData gathers what an agent needs to know about an epic: its td
+// record, Bart's earlier verdicts and the documents in its worktree.
+func (o *Orchestrator) briefData(epic *Issue, inv Invocation) BriefData {
+	data := BriefData{Agent: inv.Agent, Epic: epic, Allowed: inv.Allowed, Worktree: inv.WorktreeDir}
+
+	logs := epic.Logs
+	if len(logs) > recentLogCount {
+		logs = logs[len(logs)-recentLogCount:]
+	}
+	data.Logs = logs
+
+	for _, l := range epic.Logs {
+		if strings.HasPrefix(l.Message, "bart_") || strings.HasPrefix(l.Message, "bart: ") {
+			data.Feedback = append(data.Feedback, l.Message)
+		}
+	}
+
+	if inv.WorktreeDir != "" {
+		data.FeedbackDoc = readOptional(filepath.Join(inv.WorktreeDir, "FEEDBACK.md"))
+		data.Handoff = readOptional(filepath.Join(inv.WorktreeDir, "TODO.md"))
+	}
+	if data.Handoff == "" && o.Worktree != nil {
+		data.Handoff = readOptional(filepath.Join(o.Worktree.BaseDir, "TODO-"+epic.ID+".md"))
+	}
+	return data
+}
+
+func readOptional(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
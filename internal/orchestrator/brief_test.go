@@ -0,0 +1,99 @@
+package orchestrator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderBrief_Ralph(t *testing.T) {
+	epic := &Issue{
+		ID:          "td-a3f8",
+		Title:       "Budget enforcement",
+		Status:      "in_progress",
+		Labels:      []string{"ready"},
+		Description: "Stop sessions that exceed their token budget.",
+		Logs: []Log{
+			{Message: "bart: missing error path test", Type: "progress"},
+			{Message: "bart_fail_implementation", Type: "decision"},
+		},
+	}
+	data := BriefData{
+		Agent:    "ralph",
+		Epic:     epic,
+		Logs:     epic.Logs,
+		Feedback: []string{"bart: missing error path test", "bart_fail_implementation"},
+		Handoff:  "- [ ] Add BudgetEnforcer.Check",
+		Allowed:  ralphDecisions,
+		Worktree: "worktrees/epic-td-a3f8",
+	}
+	brief, err := RenderBrief(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Epic td-a3f8: Budget enforcement",
+		"labels: ready",
+		"Worktree: worktrees/epic-td-a3f8",
+		"Stop sessions that exceed their token budget.",
+		"decision: bart_fail_implementation",
+		"## Handoff (TODO.md)\n- [ ] Add BudgetEnforcer.Check",
+		"## Previous quality feedback",
+		"allowed decisions: ralph_done",
+	} {
+		if !strings.Contains(brief, want) {
+			t.Errorf("brief missing %q:\n%s", want, brief)
+		}
+	}
+}
+
+func TestRenderBrief_DefaultTemplate(t *testing.T) {
+	brief, err := RenderBrief(BriefData{Agent: "lovejoy", Epic: &Issue{ID: "td-1", Title: "Ship it", Status: "in_review"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(brief, "You are working on Epic td-1: Ship it") {
+		t.Errorf("unexpected brief:\n%s", brief)
+	}
+	if strings.Contains(brief, "<decision>") || strings.Contains(brief, "## ") {
+		t.Errorf("empty sections and decisions should be omitted:\n%s", brief)
+	}
+}
+
+func TestOrchestrator_BriefData(t *testing.T) {
+	base := t.TempDir()
+	worktree := filepath.Join(base, "worktrees", "epic-td-1")
+	if err := os.MkdirAll(worktree, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(worktree, "FEEDBACK.md"), []byte("Flaky test in budget_test.go\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "TODO-td-1.md"), []byte("- [ ] Fix flake\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	epic := &Issue{ID: "td-1"}
+	for i := 0; i < 15; i++ {
+		epic.Logs = append(epic.Logs, Log{Message: "step", Type: "progress"})
+	}
+	epic.Logs = append(epic.Logs, Log{Message: "bart_fail_implementation", Type: "decision"})
+
+	orch := NewOrchestrator(nil, nil, &WorktreeManager{BaseDir: base})
+	data := orch.briefData(epic, Invocation{Agent: "ralph", EpicID: "td-1", WorktreeDir: worktree})
+
+	if len(data.Logs) != recentLogCount || data.Logs[len(data.Logs)-1].Message != "bart_fail_implementation" {
+		t.Errorf("expected the %d most recent logs, got %d", recentLogCount, len(data.Logs))
+	}
+	if len(data.Feedback) != 1 || data.Feedback[0] != "bart_fail_implementation" {
+		t.Errorf("unexpected feedback: %v", data.Feedback)
+	}
+	if data.FeedbackDoc != "Flaky test in budget_test.go" {
+		t.Errorf("unexpected FEEDBACK.md: %q", data.FeedbackDoc)
+	}
+	// No TODO.md in the worktree yet, so the handoff comes from the base.
+	if data.Handoff != "- [ ] Fix flake" {
+		t.Errorf("unexpected handoff: %q", data.Handoff)
+	}
+}
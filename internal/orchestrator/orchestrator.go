@@ -1,15 +1,74 @@
 package orchestrator
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shalomb/springfield/internal/decision"
+	"github.com/shalomb/springfield/internal/spend"
 )
 
 // AgentRunner provides an interface for running agents.
 type AgentRunner interface {
-	Run(agent string, epicID string, worktreeDir string) error
+	// Run invokes an agent and returns the decision it finished with, or nil
+	// if it finished without one.
+	Run(inv Invocation) (*decision.Decision, error)
+}
+
+// Invocation describes one agent run for an epic.
+type Invocation struct {
+	Agent       string
+	EpicID      string
+	WorktreeDir string
+	Allowed     []string // Decisions the agent may return in the epic's current state
+	Task        string   // Task brief rendered from the epic
+}
+
+// Decisions each agent may signal. Lisa and Lovejoy report through td state
+// changes rather than a decision.
+var (
+	ralphDecisions = []string{"ralph_done"}
+	bartDecisions  = []string{"bart_ok", "bart_fail_implementation", "bart_fail_viability", "bart_fail_adr"}
+)
+
+// Exit statuses of springfield --agent, saying why the agent stopped.
+const (
+	ExitFailed         = 1 // Any other error
+	ExitMaxIterations  = 2 // Didn't finish within its iterations
+	ExitStalled        = 3 // Stopped making progress
+	ExitBudgetExceeded = 4 // Used up its token budget
+	ExitActionBlocked  = 5 // Its actions kept being blocked or denied
+	ExitQuotaExceeded  = 6 // The LLM provider's quota is exhausted
+	ExitGateFailed     = 7 // Its finish gates kept failing
+)
+
+// Errors an AgentRunner returns for the exit statuses above. An agent that
+// stalled, ran out of iterations or kept failing its finish gates has its
+// epic blocked and handed to Lisa to replan; the others are returned to the
+// caller.
+var (
+	ErrAgentStalled        = errors.New("agent stalled")
+	ErrAgentMaxIterations  = errors.New("agent reached max iterations")
+	ErrAgentBudgetExceeded = errors.New("agent exceeded its budget")
+	ErrAgentActionBlocked  = errors.New("agent actions blocked")
+	ErrAgentQuotaExceeded  = errors.New("agent quota exceeded")
+	ErrAgentGateFailed     = errors.New("agent finish gate failed")
+)
+
+// exitErrors maps exit statuses to the errors they stand for.
+var exitErrors = map[int]error{
+	ExitMaxIterations:  ErrAgentMaxIterations,
+	ExitStalled:        ErrAgentStalled,
+	ExitBudgetExceeded: ErrAgentBudgetExceeded,
+	ExitActionBlocked:  ErrAgentActionBlocked,
+	ExitQuotaExceeded:  ErrAgentQuotaExceeded,
+	ExitGateFailed:     ErrAgentGateFailed,
 }
 
 // Orchestrator manages the execution of Epics.
@@ -17,6 +76,10 @@ type Orchestrator struct {
 	TD       *TDClient
 	Agent    AgentRunner
 	Worktree *WorktreeManager
+	// Spend, when set, is checked against Caps before an epic is processed so
+	// no agent is invoked once a cap has been reached.
+	Spend *spend.Ledger
+	Caps  spend.Caps
 }
 
 // NewOrchestrator creates a new Orchestrator.
@@ -27,15 +90,70 @@ func NewOrchestrator(td *TDClient, agent AgentRunner, worktree *WorktreeManager)
 // CommandAgentRunner runs agents by executing the springfield binary.
 type CommandAgentRunner struct {
 	BinaryPath string
+	// ApprovalDir is the file-based approval queue handed to agents, since
+	// they have no terminal to prompt on when run by the orchestrator.
+	ApprovalDir string
+	// SpendLedger is the shared ledger agents record their usage in, so
+	// spend from every worktree lands in one place.
+	SpendLedger string
+	// RateLimitDir holds the provider rate limiter state, so agents running
+	// in parallel share one budget per provider.
+	RateLimitDir string
 }
 
-func (r *CommandAgentRunner) Run(agent string, epicID string, worktreeDir string) error {
-	log.Printf("INVOKING AGENT: %s for Epic %s (binary: %s) in worktree %s", agent, epicID, r.BinaryPath, worktreeDir)
-	cmd := exec.Command(r.BinaryPath, "--agent", agent, "--task", fmt.Sprintf("Work on epic %s", epicID))
-	cmd.Dir = worktreeDir
+func (r *CommandAgentRunner) Run(inv Invocation) (*decision.Decision, error) {
+	log.Printf("INVOKING AGENT: %s for Epic %s (binary: %s) in worktree %s", inv.Agent, inv.EpicID, r.BinaryPath, inv.WorktreeDir)
+	task := inv.Task
+	if task == "" {
+		task = fmt.Sprintf("Work on epic %s", inv.EpicID)
+	}
+	cmd := exec.Command(r.BinaryPath, "--agent", inv.Agent, "--epic", inv.EpicID, "--task", task)
+	cmd.Dir = inv.WorktreeDir
+
+	// The agent writes its validated decision here instead of running td.
+	dir, err := os.MkdirTemp("", "springfield-decision-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	decisionFile := filepath.Join(dir, "decision.json")
+
+	env := []string{
+		"SPRINGFIELD_DECISION_FILE=" + decisionFile,
+		"SPRINGFIELD_EPIC_ID=" + inv.EpicID,
+	}
+	if inv.WorktreeDir != "" {
+		worktree, err := filepath.Abs(inv.WorktreeDir)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, "SPRINGFIELD_WORKTREE="+worktree)
+	}
+	if len(inv.Allowed) > 0 {
+		env = append(env, "SPRINGFIELD_ALLOWED_DECISIONS="+strings.Join(inv.Allowed, ","))
+	}
+	if r.ApprovalDir != "" {
+		env = append(env, "SPRINGFIELD_APPROVAL_DIR="+r.ApprovalDir)
+	}
+	if r.SpendLedger != "" {
+		env = append(env, "SPRINGFIELD_SPEND_LEDGER="+r.SpendLedger)
+	}
+	if r.RateLimitDir != "" {
+		env = append(env, "SPRINGFIELD_RATELIMIT_DIR="+r.RateLimitDir)
+	}
+	cmd.Env = append(os.Environ(), env...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			if agentErr, ok := exitErrors[exitErr.ExitCode()]; ok {
+				return nil, fmt.Errorf("%w: %s on epic %s", agentErr, inv.Agent, inv.EpicID)
+			}
+		}
+		return nil, err
+	}
+	return decision.Read(decisionFile)
 }
 
 // Tick performs one iteration of the orchestration loop.
@@ -48,6 +166,15 @@ func (o *Orchestrator) Tick() error {
 
 	for _, id := range ids {
 		log.Printf("Processing Epic %s", id)
+		if err := o.checkSpend(id); err != nil {
+			var capErr *spend.CapExceededError
+			if errors.As(err, &capErr) && capErr.Cap == "epic" {
+				log.Printf("Skipping Epic %s: %v", id, err)
+				continue
+			}
+			log.Printf("Refusing to invoke agents: %v", err)
+			return err
+		}
 		if err := o.processEpic(id); err != nil {
 			log.Printf("Error processing Epic %s: %v", id, err)
 			return err // Return error to stop Tick if an epic fails
@@ -70,16 +197,10 @@ func (o *Orchestrator) processEpic(id string) error {
 	switch state {
 	case StatusPlanned:
 		log.Printf("Epic %s is planned. Invoking Lisa for breakdown.", id)
-		if o.Agent != nil {
-			return o.Agent.Run("lisa", id, "")
-		}
-		return nil
+		return o.invoke(epic, Invocation{Agent: "lisa", EpicID: id})
 	case StatusBlocked:
 		log.Printf("Epic %s is blocked. Invoking Lisa for replanning.", id)
-		if o.Agent != nil {
-			return o.Agent.Run("lisa", id, "")
-		}
-		return nil
+		return o.invoke(epic, Invocation{Agent: "lisa", EpicID: id})
 	case StatusReady:
 		log.Printf("Transitioning Epic %s to in_progress", id)
 
@@ -92,10 +213,7 @@ func (o *Orchestrator) processEpic(id string) error {
 		if err := o.TD.Update(id, "--status", "in_progress", "--labels", ""); err != nil {
 			return err
 		}
-		if o.Agent != nil {
-			return o.Agent.Run("ralph", id, worktreeDir)
-		}
-		return nil
+		return o.invoke(epic, Invocation{Agent: "ralph", EpicID: id, WorktreeDir: worktreeDir, Allowed: ralphDecisions})
 	case StatusInProgress:
 		// Check for completion signals from Ralph
 		if o.hasDecision(epic, "ralph_done") {
@@ -104,14 +222,11 @@ func (o *Orchestrator) processEpic(id string) error {
 			if err := o.TD.Update(id, "--status", "in_review", "--labels", "implemented"); err != nil {
 				return err
 			}
-			if o.Agent != nil {
-				worktreeDir := ""
-				if o.Worktree != nil {
-					worktreeDir, _ = o.Worktree.EnsureWorktree(id)
-				}
-				return o.Agent.Run("bart", id, worktreeDir)
+			worktreeDir := ""
+			if o.Worktree != nil {
+				worktreeDir, _ = o.Worktree.EnsureWorktree(id)
 			}
-			return nil
+			return o.invoke(epic, Invocation{Agent: "bart", EpicID: id, WorktreeDir: worktreeDir, Allowed: bartDecisions})
 		}
 	case StatusImplemented:
 		if o.hasDecision(epic, "bart_ok") {
@@ -119,14 +234,11 @@ func (o *Orchestrator) processEpic(id string) error {
 			if err := o.TD.Update(id, "--labels", "verified"); err != nil {
 				return err
 			}
-			if o.Agent != nil {
-				worktreeDir := ""
-				if o.Worktree != nil {
-					worktreeDir, _ = o.Worktree.EnsureWorktree(id)
-				}
-				return o.Agent.Run("lovejoy", id, worktreeDir)
+			worktreeDir := ""
+			if o.Worktree != nil {
+				worktreeDir, _ = o.Worktree.EnsureWorktree(id)
 			}
-			return nil
+			return o.invoke(epic, Invocation{Agent: "lovejoy", EpicID: id, WorktreeDir: worktreeDir})
 		}
 		if o.hasDecision(epic, "bart_fail_implementation") {
 			log.Printf("Bart rejected implementation for Epic %s. Transitioning to blocked for Lisa review.", id)
@@ -136,10 +248,7 @@ func (o *Orchestrator) processEpic(id string) error {
 			if err := o.TD.Update(id, "--status", "blocked", "--labels", ""); err != nil {
 				return err
 			}
-			if o.Agent != nil {
-				return o.Agent.Run("lisa", id, "")
-			}
-			return nil
+			return o.invoke(epic, Invocation{Agent: "lisa", EpicID: id})
 		}
 		if o.hasDecision(epic, "bart_fail_viability") || o.hasDecision(epic, "bart_fail_adr") {
 			log.Printf("Bart rejected viability/ADR for Epic %s. Transitioning to blocked.", id)
@@ -152,16 +261,93 @@ func (o *Orchestrator) processEpic(id string) error {
 			}
 			log.Printf("Successfully updated Epic %s to blocked", id)
 			// In a real implementation, we would invoke Lisa here.
-			if o.Agent != nil {
-				return o.Agent.Run("lisa", id, "")
-			}
-			return nil
+			return o.invoke(epic, Invocation{Agent: "lisa", EpicID: id})
 		}
 	}
 
 	return nil
 }
 
+// invoke runs an agent with a brief rendered from the epic and records the
+// decision it returns, so the next tick can act on it. A decision outside
+// inv.Allowed is refused.
+func (o *Orchestrator) invoke(epic *Issue, inv Invocation) error {
+	if o.Agent == nil {
+		return nil
+	}
+	if epic != nil && inv.Task == "" {
+		task, err := RenderBrief(o.briefData(epic, inv))
+		if err != nil {
+			return err
+		}
+		inv.Task = task
+	}
+	d, err := o.Agent.Run(inv)
+	if noProgress(err) && inv.Agent != "lisa" {
+		return o.replanStalled(inv, err)
+	}
+	if err != nil || d == nil {
+		return err
+	}
+	if len(inv.Allowed) == 0 {
+		log.Printf("Ignoring decision %s from %s: none expected for Epic %s in this state", d.Decision, inv.Agent, inv.EpicID)
+		return nil
+	}
+	if err := d.Validate(inv.Allowed); err != nil {
+		return fmt.Errorf("agent %s returned an invalid decision for Epic %s: %w", inv.Agent, inv.EpicID, err)
+	}
+
+	log.Printf("Agent %s decided %s for Epic %s", inv.Agent, d.Decision, inv.EpicID)
+	if d.Summary != "" || len(d.Artefacts) > 0 {
+		msg := d.Summary
+		if len(d.Artefacts) > 0 {
+			msg = strings.TrimSpace(msg + " (artefacts: " + strings.Join(d.Artefacts, ", ") + ")")
+		}
+		if err := o.TD.Log(inv.EpicID, fmt.Sprintf("%s: %s", inv.Agent, msg)); err != nil {
+			return err
+		}
+	}
+	return o.TD.LogDecision(inv.EpicID, d.Decision)
+}
+
+// noProgress reports whether an agent's error means it couldn't get the
+// work done, so the epic needs replanning.
+func noProgress(err error) bool {
+	return errors.Is(err, ErrAgentStalled) || errors.Is(err, ErrAgentMaxIterations) || errors.Is(err, ErrAgentGateFailed)
+}
+
+// replanStalled blocks an epic whose agent made no progress and invokes
+// Lisa to replan it. A stalled Lisa is left to the caller, so a replan
+// can't loop.
+func (o *Orchestrator) replanStalled(inv Invocation, stallErr error) error {
+	log.Printf("Agent %s made no progress on Epic %s (%v). Transitioning to blocked for Lisa review.", inv.Agent, inv.EpicID, stallErr)
+	if err := o.TD.Log(inv.EpicID, fmt.Sprintf("%s stopped: %v", inv.Agent, stallErr)); err != nil {
+		return err
+	}
+	if inv.Agent != "ralph" {
+		// Only Ralph's epics are already in progress, the way into blocked.
+		if err := o.TD.Update(inv.EpicID, "--status", "in_progress"); err != nil {
+			return err
+		}
+	}
+	if err := o.TD.Update(inv.EpicID, "--status", "blocked", "--labels", ""); err != nil {
+		return err
+	}
+	epic, err := o.TD.GetEpic(inv.EpicID)
+	if err != nil {
+		return err
+	}
+	return o.invoke(epic, Invocation{Agent: "lisa", EpicID: inv.EpicID})
+}
+
+// checkSpend reports whether the spend caps allow agents to run for the epic.
+func (o *Orchestrator) checkSpend(id string) error {
+	if o.Spend == nil {
+		return nil
+	}
+	return o.Spend.Check(o.Caps, id, time.Now())
+}
+
 func (o *Orchestrator) setupWorktree(id string) (string, error) {
 	if o.Worktree == nil {
 		return "", nil
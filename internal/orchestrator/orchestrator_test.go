@@ -1,17 +1,25 @@
 package orchestrator
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/shalomb/springfield/internal/decision"
+	"github.com/shalomb/springfield/internal/spend"
 )
 
 type mockAgentRunner struct {
-	runs []string
+	runs      []string
+	decisions map[string]*decision.Decision // Returned by agent name
+	errs      map[string]error
 }
 
-func (m *mockAgentRunner) Run(agent string, epicID string, worktreeDir string) error {
-	m.runs = append(m.runs, agent+":"+epicID)
-	return nil
+func (m *mockAgentRunner) Run(inv Invocation) (*decision.Decision, error) {
+	m.runs = append(m.runs, inv.Agent+":"+inv.EpicID)
+	return m.decisions[inv.Agent], m.errs[inv.Agent]
 }
 
 func TestOrchestrator_Tick(t *testing.T) {
@@ -192,3 +200,92 @@ func TestOrchestrator_StrictHandoff(t *testing.T) {
 		t.Error("expected status not to be in_progress after failed handoff deposit")
 	}
 }
+
+func TestOrchestrator_CheckSpend(t *testing.T) {
+	ledger := spend.Open(filepath.Join(t.TempDir(), "spend.jsonl"))
+	if err := ledger.Record(spend.Entry{Agent: "ralph", Epic: "td-1", Cost: 6}); err != nil {
+		t.Fatal(err)
+	}
+
+	orch := NewOrchestrator(nil, &mockAgentRunner{}, nil)
+	if err := orch.checkSpend("td-1"); err != nil {
+		t.Errorf("no ledger configured, got %v", err)
+	}
+
+	orch.Spend = ledger
+	orch.Caps = spend.Caps{PerEpic: 5}
+	var capErr *spend.CapExceededError
+	if err := orch.checkSpend("td-1"); !errors.As(err, &capErr) || capErr.Cap != "epic" {
+		t.Errorf("expected epic cap for td-1, got %v", err)
+	}
+	if err := orch.checkSpend("td-2"); err != nil {
+		t.Errorf("td-2 has no spend, got %v", err)
+	}
+
+	orch.Caps = spend.Caps{Daily: 5}
+	if err := orch.checkSpend("td-2"); !errors.As(err, &capErr) || capErr.Cap != "daily" {
+		t.Errorf("expected daily cap for every epic, got %v", err)
+	}
+}
+
+func TestOrchestrator_InvokeValidatesDecision(t *testing.T) {
+	runner := &mockAgentRunner{decisions: map[string]*decision.Decision{
+		"ralph": {Decision: "bart_ok"},
+		"lisa":  {Decision: "ralph_done"},
+	}}
+	// No td client: a decision that reached td would panic.
+	orch := NewOrchestrator(nil, runner, nil)
+
+	err := orch.invoke(nil, Invocation{Agent: "ralph", EpicID: "td-1", Allowed: ralphDecisions})
+	if err == nil {
+		t.Error("expected ralph's bart_ok to be refused")
+	}
+	if err := orch.invoke(nil, Invocation{Agent: "lisa", EpicID: "td-1"}); err != nil {
+		t.Errorf("a decision from an agent not expected to decide should be ignored, got %v", err)
+	}
+	if err := orch.invoke(nil, Invocation{Agent: "bart", EpicID: "td-1", Allowed: bartDecisions}); err != nil {
+		t.Errorf("an agent finishing without a decision is not an error, got %v", err)
+	}
+}
+
+func TestCommandAgentRunner_Stalled(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "springfield")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\nexit 3\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	runner := &CommandAgentRunner{BinaryPath: bin}
+	if _, err := runner.Run(Invocation{Agent: "ralph", EpicID: "td-1"}); !errors.Is(err, ErrAgentStalled) {
+		t.Errorf("expected exit status %d to mean a stall, got %v", ExitStalled, err)
+	}
+}
+
+func TestOrchestrator_StalledLisaIsNotReplanned(t *testing.T) {
+	runner := &mockAgentRunner{errs: map[string]error{"lisa": ErrAgentStalled}}
+	// No td client: routing the stall back to Lisa would panic.
+	orch := NewOrchestrator(nil, runner, nil)
+	if err := orch.invoke(nil, Invocation{Agent: "lisa", EpicID: "td-1"}); !errors.Is(err, ErrAgentStalled) {
+		t.Errorf("expected Lisa's stall to be returned, got %v", err)
+	}
+	if len(runner.runs) != 1 {
+		t.Errorf("expected a single run, got %v", runner.runs)
+	}
+}
+
+func TestCommandAgentRunner_ExitStatuses(t *testing.T) {
+	for code, want := range map[int]error{
+		ExitMaxIterations:  ErrAgentMaxIterations,
+		ExitBudgetExceeded: ErrAgentBudgetExceeded,
+		ExitActionBlocked:  ErrAgentActionBlocked,
+		ExitQuotaExceeded:  ErrAgentQuotaExceeded,
+		ExitGateFailed:     ErrAgentGateFailed,
+	} {
+		bin := filepath.Join(t.TempDir(), "springfield")
+		if err := os.WriteFile(bin, []byte(fmt.Sprintf("#!/bin/sh\nexit %d\n", code)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		runner := &CommandAgentRunner{BinaryPath: bin}
+		if _, err := runner.Run(Invocation{Agent: "ralph", EpicID: "td-1"}); !errors.Is(err, want) {
+			t.Errorf("exit status %d: expected %v, got %v", code, want, err)
+		}
+	}
+}
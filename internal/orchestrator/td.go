@@ -95,6 +95,12 @@ func (c *TDClient) LogDecision(id string, decision string) error {
 	return err
 }
 
+// Log adds a progress log entry to an issue.
+func (c *TDClient) Log(id string, message string) error {
+	_, err := c.runTD("log", id, message)
+	return err
+}
+
 // QueryIDs executes a td query and returns matching issue IDs.
 func (c *TDClient) QueryIDs(expression string) ([]string, error) {
 	output, err := c.runTD("query", expression, "--output", "ids")
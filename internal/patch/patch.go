@@ -0,0 +1,477 @@
+// Package patch applies edits to files under a root directory: unified
+// diffs, with strict context matching, and search/replace blocks. Edits
+// either apply cleanly or fail with a message saying exactly where and why,
+// and nothing is written unless every edit applies.
+package patch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// contextLines is how much unchanged text surrounds a change in the diffs
+// this package renders.
+const contextLines = 3
+
+// FilePatch is the part of a unified diff that changes one file.
+type FilePatch struct {
+	OldPath string // "" when the file is created
+	NewPath string // "" when the file is deleted
+	Hunks   []Hunk
+}
+
+// Path is the file the patch changes.
+func (p FilePatch) Path() string {
+	if p.NewPath != "" {
+		return p.NewPath
+	}
+	return p.OldPath
+}
+
+// Hunk is one @@ section of a unified diff.
+type Hunk struct {
+	Header   string   // The @@ line as written
+	OldStart int      // 1-based line the hunk claims to start at; a hint only
+	Lines    []string // Each prefixed with ' ', '-' or '+'
+}
+
+func (h Hunk) side(keep byte) []string {
+	var out []string
+	for _, l := range h.Lines {
+		if l[0] == ' ' || l[0] == keep {
+			out = append(out, l[1:])
+		}
+	}
+	return out
+}
+
+// Change describes an edit that was applied to a file.
+type Change struct {
+	Path    string
+	Op      string // create, modify or delete
+	Added   int
+	Removed int
+	Diff    string // Unified diff of the change, with the line numbers it applied at
+}
+
+var hunkHeaderRegex = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+
+// Parse reads a unified diff. Hunk line counts aren't trusted, since models
+// often get them wrong: a hunk runs until the next hunk or file header.
+func Parse(diff string) ([]FilePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(diff, "\r\n", "\n"), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var patches []FilePatch
+	var cur *FilePatch
+	var hunk *Hunk
+	flush := func() {
+		if hunk != nil {
+			cur.Hunks = append(cur.Hunks, *hunk)
+			hunk = nil
+		}
+	}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			flush()
+			patches = append(patches, FilePatch{OldPath: diffPath(line[4:]), NewPath: diffPath(lines[i+1][4:])})
+			cur = &patches[len(patches)-1]
+			i++
+		case strings.HasPrefix(line, "@@"):
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: hunk before any ---/+++ file header", i+1)
+			}
+			flush()
+			m := hunkHeaderRegex.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("line %d: malformed hunk header %q", i+1, line)
+			}
+			start, _ := strconv.Atoi(m[1])
+			hunk = &Hunk{Header: line, OldStart: start}
+		case hunk != nil && line == "":
+			hunk.Lines = append(hunk.Lines, " ") // An editor ate the blank context line's space
+		case hunk != nil && (line[0] == ' ' || line[0] == '-' || line[0] == '+'):
+			hunk.Lines = append(hunk.Lines, line)
+		case hunk != nil && line[0] == '\\':
+			// "\ No newline at end of file"
+		default:
+			// Preamble such as "diff --git" or "index" lines.
+			flush()
+		}
+	}
+	flush()
+
+	if len(patches) == 0 {
+		return nil, errors.New("no file headers (--- a/path, +++ b/path) found in diff")
+	}
+	for _, p := range patches {
+		if p.OldPath == "" && p.NewPath == "" {
+			return nil, errors.New("file header with /dev/null on both sides")
+		}
+		if len(p.Hunks) == 0 {
+			return nil, fmt.Errorf("%s: no hunks", p.Path())
+		}
+	}
+	return patches, nil
+}
+
+// diffPath strips the a/ or b/ prefix and any timestamp from a file header
+// path. /dev/null becomes "".
+func diffPath(s string) string {
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	if s == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		s = s[2:]
+	}
+	return s
+}
+
+// ApplyDiff applies a unified diff under root. Either every hunk of every
+// file applies and all files are written, or nothing is.
+func ApplyDiff(root, diff string) ([]Change, error) {
+	patches, err := Parse(diff)
+	if err != nil {
+		return nil, err
+	}
+	var edits []edit
+	seen := make(map[string]bool)
+	for _, p := range patches {
+		if seen[p.Path()] {
+			return nil, fmt.Errorf("%s appears more than once in the diff; combine its hunks under one header", p.Path())
+		}
+		seen[p.Path()] = true
+		e, err := applyFilePatch(root, p)
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, e)
+	}
+	return commit(root, edits)
+}
+
+// edit is a file's new content, computed but not yet written.
+type edit struct {
+	change  Change
+	content string
+}
+
+func applyFilePatch(root string, p FilePatch) (edit, error) {
+	path := p.Path()
+	if _, err := resolve(root, path); err != nil {
+		return edit{}, err
+	}
+	if p.OldPath != "" && p.NewPath != "" && p.OldPath != p.NewPath {
+		return edit{}, fmt.Errorf("%s: renames aren't supported; delete %s and create %s", path, p.OldPath, p.NewPath)
+	}
+
+	f, err := readFile(root, path, p.OldPath == "")
+	if err != nil {
+		return edit{}, err
+	}
+	op := "modify"
+	switch {
+	case p.OldPath == "":
+		op = "create"
+	case p.NewPath == "":
+		op = "delete"
+	}
+
+	lines := f.lines
+	var rendered []string
+	offset := 0 // How far earlier hunks moved later lines
+	from := 0   // Hunks apply in order and can't overlap
+	for i, h := range p.Hunks {
+		old, repl := h.side('-'), h.side('+')
+		hint := h.OldStart - 1 + offset
+		if len(old) == 0 && h.OldStart == 0 {
+			hint = 0 // "@@ -0,0 +1,n @@" adds to an empty file
+		}
+		at, err := locate(lines, old, from, hint)
+		if err != nil {
+			return edit{}, fmt.Errorf("hunk %d of %d for %s (%s) does not apply: %w", i+1, len(p.Hunks), path, h.Header, err)
+		}
+		rendered = append(rendered, renderHunk(h.Lines, at-offset+1, at+1))
+		lines = splice(lines, at, len(old), repl)
+		offset += len(repl) - len(old)
+		from = at + len(repl)
+	}
+
+	if op == "delete" && len(lines) > 0 {
+		return edit{}, fmt.Errorf("%s: the diff deletes the file but leaves %d lines in it", path, len(lines))
+	}
+	change := Change{Path: path, Op: op, Diff: fileHeader(p) + strings.Join(rendered, "")}
+	for _, h := range p.Hunks {
+		for _, l := range h.Lines {
+			switch l[0] {
+			case '+':
+				change.Added++
+			case '-':
+				change.Removed++
+			}
+		}
+	}
+	return edit{change: change, content: f.encode(f.join(lines))}, nil
+}
+
+// locate finds where old appears in lines at or after from, preferring the
+// match nearest hint. Matching is exact; on failure the error describes the
+// nearest near-miss.
+func locate(lines, old []string, from, hint int) (int, error) {
+	if len(old) == 0 {
+		if hint < from {
+			hint = from
+		}
+		if hint > len(lines) {
+			hint = len(lines)
+		}
+		return hint, nil
+	}
+	best := -1
+	for at := from; at+len(old) <= len(lines); at++ {
+		if equalAt(lines, old, at) && (best < 0 || abs(at-hint) < abs(best-hint)) {
+			best = at
+		}
+	}
+	if best >= 0 {
+		return best, nil
+	}
+	return 0, nearestMiss(lines, old, from, hint)
+}
+
+func equalAt(lines, old []string, at int) bool {
+	for i, l := range old {
+		if lines[at+i] != l {
+			return false
+		}
+	}
+	return true
+}
+
+// nearestMiss explains why old doesn't match: the position where most of
+// its lines do, and the first line that differs there. When no line matches
+// anywhere, it compares against the line the hunk header pointed at.
+func nearestMiss(lines, old []string, from, hint int) error {
+	if len(lines) == 0 {
+		return errors.New("the file is empty")
+	}
+	bestAt, bestScore := -1, 0
+	for at := from; at < len(lines); at++ {
+		score := 0
+		for i := 0; i < len(old) && at+i < len(lines); i++ {
+			if lines[at+i] == old[i] {
+				score++
+			}
+		}
+		if score > bestScore {
+			bestAt, bestScore = at, score
+		}
+	}
+	if bestAt < 0 {
+		if hint < 0 || hint >= len(lines) {
+			hint = len(lines) - 1
+		}
+		return fmt.Errorf("none of its %d context/removed lines were found; line %d expected %q, found %q",
+			len(old), hint+1, old[0], lines[hint])
+	}
+	for i := range old {
+		n := bestAt + i
+		if n >= len(lines) {
+			return fmt.Errorf("nearest match at line %d (%d of %d lines match) runs past the end of the file", bestAt+1, bestScore, len(old))
+		}
+		if lines[n] != old[i] {
+			hint := ""
+			if strings.TrimSpace(lines[n]) == strings.TrimSpace(old[i]) {
+				hint = " (only whitespace differs)"
+			}
+			return fmt.Errorf("nearest match at line %d (%d of %d lines match); line %d expected %q, found %q%s",
+				bestAt+1, bestScore, len(old), n+1, old[i], lines[n], hint)
+		}
+	}
+	return fmt.Errorf("nearest match at line %d", bestAt+1) // Unreachable: a full match would have been found
+}
+
+func splice(lines []string, at, n int, repl []string) []string {
+	out := make([]string, 0, len(lines)-n+len(repl))
+	out = append(out, lines[:at]...)
+	out = append(out, repl...)
+	return append(out, lines[at+n:]...)
+}
+
+func renderHunk(lines []string, oldStart, newStart int) string {
+	var oldN, newN int
+	for _, l := range lines {
+		if l[0] != '+' {
+			oldN++
+		}
+		if l[0] != '-' {
+			newN++
+		}
+	}
+	if oldN == 0 {
+		oldStart--
+	}
+	if newN == 0 {
+		newStart--
+	}
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@\n%s\n", oldStart, oldN, newStart, newN, strings.Join(lines, "\n"))
+}
+
+func fileHeader(p FilePatch) string {
+	oldPath, newPath := "/dev/null", "/dev/null"
+	if p.OldPath != "" {
+		oldPath = "a/" + p.OldPath
+	}
+	if p.NewPath != "" {
+		newPath = "b/" + p.NewPath
+	}
+	return fmt.Sprintf("--- %s\n+++ %s\n", oldPath, newPath)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// file is a text file split into lines.
+type file struct {
+	lines        []string
+	finalNewline bool
+	crlf         bool // Lines end in \r\n on disk
+}
+
+func (f file) join(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	s := strings.Join(lines, "\n")
+	if f.finalNewline {
+		s += "\n"
+	}
+	return s
+}
+
+// encode gives content joined with \n the file's own line endings.
+func (f file) encode(content string) string {
+	if !f.crlf {
+		return content
+	}
+	return strings.ReplaceAll(content, "\n", "\r\n")
+}
+
+// readFile reads a file to edit. create means it mustn't exist yet.
+func readFile(root, path string, create bool) (file, error) {
+	full, err := resolve(root, path)
+	if err != nil {
+		return file{}, err
+	}
+	data, err := os.ReadFile(full)
+	if create {
+		if err == nil {
+			return file{}, fmt.Errorf("%s: the diff creates the file but it already exists", path)
+		}
+		return file{finalNewline: true}, nil
+	}
+	if os.IsNotExist(err) {
+		return file{}, fmt.Errorf("%s: no such file", path)
+	}
+	if err != nil {
+		return file{}, err
+	}
+	// Most lines ending in \r\n makes it the file's line ending.
+	crlfs := strings.Count(string(data), "\r\n")
+	content := strings.ReplaceAll(string(data), "\r\n", "\n")
+	f := file{
+		finalNewline: strings.HasSuffix(content, "\n"),
+		crlf:         crlfs > 0 && 2*crlfs >= strings.Count(content, "\n"),
+	}
+	content = strings.TrimSuffix(content, "\n")
+	if content != "" {
+		f.lines = strings.Split(content, "\n")
+	}
+	return f, nil
+}
+
+// resolve returns path's location under root, refusing paths that leave it,
+// lexically or through a symlinked directory, and symlinks themselves.
+func resolve(root, path string) (string, error) {
+	if path == "" || filepath.IsAbs(path) {
+		return "", fmt.Errorf("%q: paths must be relative to the worktree", path)
+	}
+	clean := filepath.Clean(filepath.FromSlash(path))
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%q: paths must stay inside the worktree", path)
+	}
+	full := filepath.Join(root, clean)
+	if info, err := os.Lstat(full); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return "", fmt.Errorf("%q: refusing to write through a symlink", path)
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	// The file may not exist yet, so check where its deepest existing parent
+	// really is.
+	parent := filepath.Dir(full)
+	for {
+		if _, err := os.Lstat(parent); err == nil {
+			break
+		}
+		parent = filepath.Dir(parent)
+	}
+	realParent, err := filepath.EvalSymlinks(parent)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(realRoot, realParent)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%q: paths must stay inside the worktree", path)
+	}
+	return full, nil
+}
+
+// commit writes computed edits to disk.
+func commit(root string, edits []edit) ([]Change, error) {
+	var changes []Change
+	for _, e := range edits {
+		full, err := resolve(root, e.change.Path)
+		if err != nil {
+			return changes, err
+		}
+		switch e.change.Op {
+		case "delete":
+			if err := os.Remove(full); err != nil {
+				return changes, err
+			}
+		default:
+			if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+				return changes, err
+			}
+			mode := os.FileMode(0644)
+			if info, err := os.Stat(full); err == nil {
+				mode = info.Mode().Perm()
+			}
+			if err := os.WriteFile(full, []byte(e.content), mode); err != nil {
+				return changes, err
+			}
+		}
+		changes = append(changes, e.change)
+	}
+	return changes, nil
+}
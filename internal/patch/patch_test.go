@@ -0,0 +1,254 @@
+package patch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const original = `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("hello")
+}
+
+func helper() int {
+	return 1
+}
+`
+
+func setup(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func read(t *testing.T, root, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(root, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestApplyDiff(t *testing.T) {
+	root := setup(t, map[string]string{"main.go": original})
+	// The first hunk's line numbers are off by two, as a model's often are.
+	diff := `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -7,3 +7,3 @@ func main() {
+ func main() {
+-	fmt.Println("hello")
++	fmt.Println("hello, world")
+ }
+@@ -10,2 +10,3 @@
+ func helper() int {
+-	return 1
++	// Always two.
++	return 2
+ }
+--- /dev/null
++++ b/README.md
+@@ -0,0 +1,2 @@
++# Demo
++Says hello.
+`
+	changes, err := ApplyDiff(root, diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Op != "modify" || changes[0].Added != 3 || changes[0].Removed != 2 || changes[1].Op != "create" {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+	want := strings.Replace(strings.Replace(original, `"hello"`, `"hello, world"`, 1), "\treturn 1", "\t// Always two.\n\treturn 2", 1)
+	if got := read(t, root, "main.go"); got != want {
+		t.Errorf("main.go:\n%s", got)
+	}
+	if got := read(t, root, "README.md"); got != "# Demo\nSays hello.\n" {
+		t.Errorf("README.md: %q", got)
+	}
+	// The logged diff carries the line numbers the hunks applied at.
+	if !strings.Contains(changes[0].Diff, "@@ -5,3 +5,3 @@\n func main() {") || !strings.Contains(changes[0].Diff, "@@ -9,3 +9,4 @@") {
+		t.Errorf("unexpected applied diff:\n%s", changes[0].Diff)
+	}
+}
+
+func TestApplyDiff_ContextMismatchWritesNothing(t *testing.T) {
+	root := setup(t, map[string]string{"main.go": original, "other.go": "package main\n"})
+	diff := `--- a/other.go
++++ b/other.go
+@@ -1 +1 @@
+-package main
++package other
+--- a/main.go
++++ b/main.go
+@@ -5,3 +5,3 @@
+ func main() {
+-    fmt.Println("hello")
++    fmt.Println("bye")
+ }
+`
+	_, err := ApplyDiff(root, diff)
+	if err == nil {
+		t.Fatal("expected the second file's hunk to fail")
+	}
+	for _, want := range []string{
+		"hunk 1 of 1 for main.go (@@ -5,3 +5,3 @@) does not apply",
+		"nearest match at line 5 (2 of 3 lines match)",
+		`line 6 expected "    fmt.Println(\"hello\")", found "\tfmt.Println(\"hello\")" (only whitespace differs)`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q missing %q", err, want)
+		}
+	}
+	if got := read(t, root, "other.go"); got != "package main\n" {
+		t.Errorf("other.go was changed even though the patch failed: %q", got)
+	}
+}
+
+func TestApplyDiff_Errors(t *testing.T) {
+	root := setup(t, map[string]string{"main.go": original})
+	cases := map[string]string{
+		"no headers":   "@@ -1 +1 @@\n-a\n+b\n",
+		"missing file": "--- a/nope.go\n+++ b/nope.go\n@@ -1 +1 @@\n-a\n+b\n",
+		"escapes root": "--- a/../x\n+++ b/../x\n@@ -1 +1 @@\n-a\n+b\n",
+		"exists":       "--- /dev/null\n+++ b/main.go\n@@ -0,0 +1 @@\n+x\n",
+		"not a diff":   "just some text",
+	}
+	for name, diff := range cases {
+		if _, err := ApplyDiff(root, diff); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSymlinksStayInsideRoot(t *testing.T) {
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	root := setup(t, map[string]string{"main.go": original})
+	for name, target := range map[string]string{
+		"escape":  outside,
+		"link.go": filepath.Join(root, "main.go"),
+	} {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("symlinks unsupported: %v", err)
+		}
+	}
+
+	cases := map[string]func() error{
+		"edit through a linked dir": func() error {
+			_, err := Replace(root, "escape/secret.txt", "secret", "leaked")
+			return err
+		},
+		"create through a linked dir": func() error {
+			_, err := Replace(root, "escape/new/file.txt", "", "x")
+			return err
+		},
+		"diff through a linked dir": func() error {
+			_, err := ApplyDiff(root, "--- /dev/null\n+++ b/escape/new.txt\n@@ -0,0 +1 @@\n+x\n")
+			return err
+		},
+		"edit a symlink": func() error {
+			_, err := Replace(root, "link.go", "return 1", "return 2")
+			return err
+		},
+	}
+	for name, run := range cases {
+		if err := run(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if got := read(t, outside, "secret.txt"); got != "secret\n" {
+		t.Errorf("a file outside the root was changed: %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new.txt")); !os.IsNotExist(err) {
+		t.Error("a file was created outside the root")
+	}
+	if got := read(t, root, "main.go"); got != original {
+		t.Error("main.go was changed through a symlink")
+	}
+}
+
+func TestReplace(t *testing.T) {
+	root := setup(t, map[string]string{"main.go": original})
+	change, err := Replace(root, "main.go", "func helper() int {\n\treturn 1\n}", "func helper() int {\n\treturn 2\n}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, root, "main.go"); got != strings.Replace(original, "return 1", "return 2", 1) {
+		t.Errorf("main.go:\n%s", got)
+	}
+	wantDiff := "--- a/main.go\n+++ b/main.go\n@@ -6,6 +6,6 @@\n \tfmt.Println(\"hello\")\n }\n \n-func helper() int {\n-\treturn 1\n-}\n+func helper() int {\n+\treturn 2\n+}\n"
+	if change.Diff != wantDiff {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", change.Diff, wantDiff)
+	}
+
+	if _, err := Replace(root, "notes.md", "", "# Notes\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, root, "notes.md"); got != "# Notes\n" {
+		t.Errorf("notes.md: %q", got)
+	}
+}
+
+func TestLineEndingsKept(t *testing.T) {
+	crlf := strings.ReplaceAll(original, "\n", "\r\n")
+	root := setup(t, map[string]string{"a.go": crlf, "b.go": crlf})
+
+	diff := "--- a/a.go\n+++ b/a.go\n@@ -5,3 +5,3 @@\n func main() {\n-\tfmt.Println(\"hello\")\n+\tfmt.Println(\"bye\")\n }\n"
+	if _, err := ApplyDiff(root, diff); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := read(t, root, "a.go"), strings.Replace(crlf, "hello", "bye", 1); got != want {
+		t.Errorf("a.go = %q, want %q", got, want)
+	}
+
+	if _, err := Replace(root, "b.go", "\treturn 1\n", "\treturn 2\n\t// done\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := read(t, root, "b.go"), strings.Replace(crlf, "\treturn 1\r\n", "\treturn 2\r\n\t// done\r\n", 1); got != want {
+		t.Errorf("b.go = %q, want %q", got, want)
+	}
+
+	// A stray \r\n doesn't turn a file with \n line endings into one with \r\n.
+	root = setup(t, map[string]string{"c.go": strings.Replace(original, "}\n", "}\r\n", 1)})
+	if _, err := Replace(root, "c.go", "return 1", "return 2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, root, "c.go"); got != strings.Replace(original, "return 1", "return 2", 1) {
+		t.Errorf("c.go = %q", got)
+	}
+}
+
+func TestReplace_Errors(t *testing.T) {
+	root := setup(t, map[string]string{"main.go": original})
+	cases := []struct{ search, want string }{
+		{"}\n", "matches 2 times in main.go (lines 7, 11)"},
+		{"func main() {\n    fmt.Println(\"hello\")", `its first 1 lines match from line 5, then line 6 expected "    fmt.Println(\"hello\")", found "\tfmt.Println(\"hello\")" (only whitespace differs)`},
+		{"func nothing() {}", `no line of the file matches its first line "func nothing() {}"`},
+	}
+	for _, c := range cases {
+		_, err := Replace(root, "main.go", c.search, "x")
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("Replace(%q): got %v, want error containing %q", c.search, err, c.want)
+		}
+	}
+	if _, err := Replace(root, "main.go", "", "x"); err == nil {
+		t.Error("expected creating an existing file to fail")
+	}
+	if got := read(t, root, "main.go"); got != original {
+		t.Error("a failed replace changed the file")
+	}
+}
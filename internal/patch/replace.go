@@ -0,0 +1,153 @@
+package patch
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Replace replaces the one occurrence of search in the file at path with
+// replace. The search text must match exactly, including whitespace, and
+// exactly once. An empty search creates a file that doesn't exist yet.
+func Replace(root, path, search, replace string) (Change, error) {
+	if _, err := resolve(root, path); err != nil {
+		return Change{}, err
+	}
+	search = strings.ReplaceAll(search, "\r\n", "\n")
+	replace = strings.ReplaceAll(replace, "\r\n", "\n")
+
+	if search == "" {
+		if _, err := readFile(root, path, true); err != nil {
+			return Change{}, fmt.Errorf("%w; give the text to replace as search", err)
+		}
+		f := file{finalNewline: true}
+		lines := splitLines(replace)
+		hunk := make([]string, len(lines))
+		for i, l := range lines {
+			hunk[i] = "+" + l
+		}
+		change := Change{Path: path, Op: "create", Added: len(lines),
+			Diff: fileHeader(FilePatch{NewPath: path}) + renderHunk(hunk, 1, 1)}
+		return commitOne(root, change, f.join(lines))
+	}
+
+	f, err := readFile(root, path, false)
+	if err != nil {
+		return Change{}, err
+	}
+	content := f.join(f.lines)
+	switch n := strings.Count(content, search); n {
+	case 0:
+		return Change{}, fmt.Errorf("search text not found in %s: %s", path, missHint(f.lines, search))
+	case 1:
+	default:
+		return Change{}, fmt.Errorf("search text matches %d times in %s (lines %s); include more surrounding lines to make it unique",
+			n, path, matchLines(content, search))
+	}
+
+	i := strings.Index(content, search)
+	updated := content[:i] + replace + content[i+len(search):]
+
+	// Render the change as a hunk over the whole lines it touched.
+	startLine := strings.Count(content[:i], "\n")
+	oldEnd := strings.Count(content[:i+len(search)], "\n")
+	if strings.HasSuffix(search, "\n") {
+		oldEnd--
+	}
+	newLines := splitLines(strings.TrimSuffix(updated, "\n"))
+	newEnd := oldEnd + (len(newLines) - len(f.lines))
+	change := Change{Path: path, Op: "modify",
+		Removed: oldEnd - startLine + 1, Added: newEnd - startLine + 1,
+		Diff: fileHeader(FilePatch{OldPath: path, NewPath: path}) + contextHunk(f.lines, newLines, startLine, oldEnd, newEnd)}
+	return commitOne(root, change, f.encode(updated))
+}
+
+func commitOne(root string, change Change, content string) (Change, error) {
+	changes, err := commit(root, []edit{{change: change, content: content}})
+	if err != nil {
+		return Change{}, err
+	}
+	return changes[0], nil
+}
+
+// contextHunk renders old lines [start, oldEnd] becoming new lines
+// [start, newEnd], with surrounding context.
+func contextHunk(oldLines, newLines []string, start, oldEnd, newEnd int) string {
+	from := start - contextLines
+	if from < 0 {
+		from = 0
+	}
+	var lines []string
+	for _, l := range oldLines[from:start] {
+		lines = append(lines, " "+l)
+	}
+	for _, l := range oldLines[start : oldEnd+1] {
+		lines = append(lines, "-"+l)
+	}
+	for _, l := range newLines[start : newEnd+1] {
+		lines = append(lines, "+"+l)
+	}
+	to := oldEnd + 1 + contextLines
+	if to > len(oldLines) {
+		to = len(oldLines)
+	}
+	for _, l := range oldLines[oldEnd+1 : to] {
+		lines = append(lines, " "+l)
+	}
+	return renderHunk(lines, from+1, from+1)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// matchLines lists the lines on which search starts, for an ambiguity error.
+func matchLines(content, search string) string {
+	var lines []string
+	for offset := 0; ; {
+		i := strings.Index(content[offset:], search)
+		if i < 0 {
+			break
+		}
+		lines = append(lines, fmt.Sprint(strings.Count(content[:offset+i], "\n")+1))
+		offset += i + 1
+	}
+	return strings.Join(lines, ", ")
+}
+
+// missHint points at where the search text nearly matches: the longest run
+// of its lines found in the file, and the first line that differs after it.
+func missHint(lines []string, search string) string {
+	want := splitLines(search)
+	bestAt, bestRun := -1, 0
+	for at := range lines {
+		run := 0
+		for run < len(want) && at+run < len(lines) && lines[at+run] == want[run] {
+			run++
+		}
+		if run > bestRun {
+			bestAt, bestRun = at, run
+		}
+	}
+	if bestAt < 0 {
+		first := strings.TrimSpace(want[0])
+		for n, l := range lines {
+			if first != "" && strings.TrimSpace(l) == first {
+				return fmt.Sprintf("its first line matches line %d only if whitespace is ignored (%q)", n+1, l)
+			}
+		}
+		return fmt.Sprintf("no line of the file matches its first line %q", want[0])
+	}
+	n := bestAt + bestRun
+	if n >= len(lines) {
+		return fmt.Sprintf("its first %d lines match from line %d, but the file ends before the rest", bestRun, bestAt+1)
+	}
+	hint := ""
+	if strings.TrimSpace(lines[n]) == strings.TrimSpace(want[bestRun]) {
+		hint = " (only whitespace differs)"
+	}
+	return fmt.Sprintf("its first %d lines match from line %d, then line %d expected %q, found %q%s",
+		bestRun, bestAt+1, n+1, want[bestRun], lines[n], hint)
+}
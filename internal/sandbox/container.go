@@ -0,0 +1,80 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/shalomb/axon/pkg/types"
+)
+
+// ContainerSandbox runs each action in a fresh container started directly
+// with the container runtime, so that its network is fixed when the
+// container starts rather than left to the action.
+type ContainerSandbox struct {
+	Runtime string // podman or docker
+	Image   string
+	Workdir string // Host directory mounted at the same path and used as the working directory
+	Network string // Value for --network, e.g. none or an internal network's name
+	CPUs    string
+	Memory  string
+}
+
+// Execute runs command with bash in a new container.
+func (s *ContainerSandbox) Execute(ctx context.Context, command string) (*types.Result, error) {
+	args := []string{"run", "--rm", "--network=" + s.Network}
+	if s.CPUs != "" {
+		args = append(args, "--cpus", s.CPUs)
+	}
+	if s.Memory != "" {
+		args = append(args, "--memory", s.Memory)
+	}
+	if s.Workdir != "" {
+		args = append(args, "-v", s.Workdir+":"+s.Workdir+":Z", "-w", s.Workdir)
+	}
+	args = append(args, s.Image, "bash", "-c", command)
+
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, s.Runtime, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	result := &types.Result{
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Execution: types.ExecutionMetadata{DurationMs: time.Since(start).Milliseconds()},
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+		return result, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s container: %w", s.Runtime, err)
+	}
+	return result, nil
+}
+
+// createInternalNetwork creates a network with no route out of the host, on
+// the given subnet and gateway.
+func createInternalNetwork(ctx context.Context, runtime, name, subnet, gateway string) error {
+	out, err := exec.CommandContext(ctx, runtime, "network", "create", "--internal",
+		"--subnet", subnet, "--gateway", gateway, name).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s network create %s: %w: %s", runtime, name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// removeNetwork removes a network created by createInternalNetwork.
+func removeNetwork(runtime, name string) error {
+	out, err := exec.Command(runtime, "network", "rm", name).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s network rm %s: %w: %s", runtime, name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
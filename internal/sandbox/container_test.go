@@ -0,0 +1,86 @@
+package sandbox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeRuntime writes a container runtime that logs its arguments, one call
+// per line, and fails "run" with exit code 3.
+func fakeRuntime(t *testing.T) (runtime, log string) {
+	dir := t.TempDir()
+	runtime, log = filepath.Join(dir, "podman"), filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"$*\" | tr '\\n' ' ' >> " + log + "\necho >> " + log + "\n[ \"$1\" = run ] && { echo failed >&2; exit 3; }\nexit 0\n"
+	if err := os.WriteFile(runtime, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return runtime, log
+}
+
+func calls(t *testing.T, log string) []string {
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return lines
+}
+
+func TestNetworkSandbox_NoneStartsContainersWithoutANetwork(t *testing.T) {
+	runtime, log := fakeRuntime(t)
+	container := &ContainerSandbox{Runtime: runtime, Image: "debian", Workdir: "/work"}
+	sb, err := NewNetworkSandbox(context.Background(), &recordingSandbox{}, container, NetworkPolicy{Mode: NetworkNone})
+	if err != nil {
+		t.Fatalf("NewNetworkSandbox() error: %v", err)
+	}
+	defer sb.Close()
+
+	result, err := sb.Execute(context.Background(), "go mod download")
+	if err != nil {
+		t.Fatalf("Execute() error: %v", err)
+	}
+	if got := calls(t, log)[0]; got != "run --rm --network=none -v /work:/work:Z -w /work debian bash -c go mod download" {
+		t.Errorf("unexpected run: %q", got)
+	}
+	if result.ExitCode != 3 || !strings.HasPrefix(result.Stderr, "failed\n") ||
+		!strings.Contains(result.Stderr, "ran without network access") {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestNetworkSandbox_AllowlistUsesAnInternalNetwork(t *testing.T) {
+	runtime, log := fakeRuntime(t)
+	container := &ContainerSandbox{Runtime: runtime, Image: "debian"}
+	sb, err := NewNetworkSandbox(context.Background(), &recordingSandbox{}, container,
+		NetworkPolicy{Mode: NetworkAllowlist, Allow: []string{"proxy.golang.org:443"}})
+	if err != nil {
+		t.Fatalf("NewNetworkSandbox() error: %v", err)
+	}
+	if _, err := sb.Execute(context.Background(), "true"); err != nil {
+		t.Fatalf("Execute() error: %v", err)
+	}
+	if err := sb.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := calls(t, log)
+	if len(got) != 3 {
+		t.Fatalf("expected create, run and rm, got %q", got)
+	}
+	create := "network create --internal --subnet " + sb.clients.String() + " --gateway " + sb.gateway.String() + " " + container.Network
+	if got[0] != create {
+		t.Errorf("create = %q, want %q", got[0], create)
+	}
+	if !strings.HasPrefix(got[1], "run --rm --network="+container.Network+" debian bash -c export HTTP_PROXY=http://"+sb.gateway.String()+":") {
+		t.Errorf("unexpected run: %q", got[1])
+	}
+	if got[2] != "network rm "+container.Network {
+		t.Errorf("unexpected cleanup: %q", got[2])
+	}
+}
@@ -0,0 +1,203 @@
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/shalomb/axon/pkg/types"
+)
+
+// NetworkMode controls what sandboxed actions may reach. See NetworkSandbox
+// for how each mode is enforced.
+type NetworkMode string
+
+const (
+	// NetworkNone gives actions no network at all.
+	NetworkNone NetworkMode = "none"
+	// NetworkAllowlist lets actions reach only the hosts/ports in
+	// NetworkPolicy.Allow, through a filtering proxy.
+	NetworkAllowlist NetworkMode = "allowlist"
+	// NetworkOpen applies no filtering.
+	NetworkOpen NetworkMode = "open"
+)
+
+// ParseNetworkMode converts a configuration value into a NetworkMode.
+// An empty string maps to NetworkOpen.
+func ParseNetworkMode(s string) (NetworkMode, error) {
+	switch mode := NetworkMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case "":
+		return NetworkOpen, nil
+	case NetworkNone, NetworkAllowlist, NetworkOpen:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown network mode %q (want none, allowlist or open)", s)
+}
+
+// NetworkPolicy describes which destinations sandboxed actions may reach.
+//
+// Allow entries take the form "host", "host:port" or "*.domain[:port]". A
+// wildcard matches subdomains only, and an entry without a port matches any
+// port.
+type NetworkPolicy struct {
+	Mode  NetworkMode
+	Allow []string
+}
+
+// Allows reports whether a connection to host:port is permitted.
+func (p NetworkPolicy) Allows(host, port string) bool {
+	switch p.Mode {
+	case NetworkOpen, "":
+		return true
+	case NetworkNone:
+		return false
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, entry := range p.Allow {
+		entryHost, entryPort := entry, ""
+		if h, pt, err := net.SplitHostPort(entry); err == nil {
+			entryHost, entryPort = h, pt
+		}
+		if entryPort != "" && entryPort != "*" && entryPort != port {
+			continue
+		}
+		entryHost = strings.ToLower(entryHost)
+		if suffix, ok := strings.CutPrefix(entryHost, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == entryHost {
+			return true
+		}
+	}
+	return false
+}
+
+// NetworkSandbox enforces a NetworkPolicy on sandboxed actions. In the open
+// mode actions run in Inner unchanged. In the none and allowlist modes Inner
+// is a ContainerSandbox whose network is fixed when each container starts:
+// none has no network at all, and allowlist is an internal network whose only
+// reachable address is the host's, where a filtering proxy listens and the
+// standard proxy environment variables point. Each action gets its own
+// proxy, so the connections it was refused, appended to its stderr so the
+// agent can see why a command failed, are its own even when actions run
+// concurrently.
+type NetworkSandbox struct {
+	Inner  Sandbox
+	Policy NetworkPolicy
+
+	runtime string     // Runtime that created network
+	network string     // Internal network, removed on Close
+	gateway net.IP     // The host's address on network
+	clients *net.IPNet // network's subnet, the only addresses the proxy serves
+}
+
+// NewNetworkSandbox returns a sandbox enforcing policy. open runs actions in
+// the open mode; the other modes run them in container, with its Network set
+// here.
+func NewNetworkSandbox(ctx context.Context, open Sandbox, container *ContainerSandbox, policy NetworkPolicy) (*NetworkSandbox, error) {
+	switch policy.Mode {
+	case NetworkOpen, "":
+		return &NetworkSandbox{Inner: open, Policy: policy}, nil
+	case NetworkNone:
+		container.Network = "none"
+		return &NetworkSandbox{Inner: container, Policy: policy}, nil
+	}
+
+	// Pick a subnet unlikely to be in use, trying again if another agent's
+	// network already has it.
+	var err error
+	for attempt := 0; attempt < 5; attempt++ {
+		subnet := &net.IPNet{IP: net.IPv4(10, byte(200+rand.IntN(50)), byte(rand.IntN(256)), 0).To4(), Mask: net.CIDRMask(24, 32)}
+		gateway := net.IPv4(subnet.IP[0], subnet.IP[1], subnet.IP[2], 1).To4()
+		name := fmt.Sprintf("springfield-egress-%d-%d", os.Getpid(), attempt)
+		if err = createInternalNetwork(ctx, container.Runtime, name, subnet.String(), gateway.String()); err != nil {
+			continue
+		}
+		container.Network = name
+		return &NetworkSandbox{Inner: container, Policy: policy,
+			runtime: container.Runtime, network: name, gateway: gateway, clients: subnet}, nil
+	}
+	return nil, fmt.Errorf("failed to create the sandbox network: %w", err)
+}
+
+// Execute runs the command under the policy.
+func (s *NetworkSandbox) Execute(ctx context.Context, command string) (*types.Result, error) {
+	switch s.Policy.Mode {
+	case NetworkAllowlist:
+		return s.executeProxied(ctx, command)
+	case NetworkNone:
+		result, err := s.Inner.Execute(ctx, command)
+		if result != nil && result.ExitCode != 0 {
+			result.Stderr = appendNote(result.Stderr, "SPRINGFIELD NETWORK POLICY (none): this action ran without network access.")
+		}
+		return result, err
+	}
+	return s.Inner.Execute(ctx, command)
+}
+
+// executeProxied runs the command with its proxy variables pointing at a
+// proxy of its own.
+func (s *NetworkSandbox) executeProxied(ctx context.Context, command string) (*types.Result, error) {
+	proxy, err := s.startProxy()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = proxy.Close()
+	}()
+	_, port, err := net.SplitHostPort(proxy.Addr())
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.Inner.Execute(ctx, proxyEnv("http://"+net.JoinHostPort(s.gateway.String(), port))+"\n"+command)
+	if result != nil {
+		if blocked := proxy.Blocked(); len(blocked) > 0 {
+			result.Stderr = appendNote(result.Stderr, s.describeBlocked(blocked))
+		}
+	}
+	return result, err
+}
+
+// startProxy listens on the gateway. Some runtimes only bring a network's
+// bridge up with its first container; until then the proxy listens on every
+// interface, still refusing anything outside the network.
+func (s *NetworkSandbox) startProxy() (*EgressProxy, error) {
+	proxy, err := StartEgressProxy(net.JoinHostPort(s.gateway.String(), "0"), s.Policy, s.clients)
+	if err != nil {
+		proxy, err = StartEgressProxy(":0", s.Policy, s.clients)
+	}
+	return proxy, err
+}
+
+// Close removes the sandbox network, if one was created.
+func (s *NetworkSandbox) Close() error {
+	if s.network == "" {
+		return nil
+	}
+	return removeNetwork(s.runtime, s.network)
+}
+
+func proxyEnv(proxyURL string) string {
+	var vars []string
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY", "http_proxy", "https_proxy", "all_proxy"} {
+		vars = append(vars, name+"="+proxyURL)
+	}
+	return "export " + strings.Join(vars, " ") + " NO_PROXY= no_proxy="
+}
+
+func appendNote(stderr, note string) string {
+	return strings.TrimRight(stderr, "\n") + "\n" + note
+}
+
+func (s *NetworkSandbox) describeBlocked(blocked []string) string {
+	return fmt.Sprintf("SPRINGFIELD NETWORK POLICY (%s): blocked connection to %s. Allowed destinations: %s.",
+		s.Policy.Mode, strings.Join(blocked, ", "), strings.Join(s.Policy.Allow, ", "))
+}
@@ -0,0 +1,233 @@
+package sandbox
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shalomb/axon/pkg/types"
+)
+
+type recordingSandbox struct {
+	mu       sync.Mutex
+	commands []string
+	onExec   func(command string)
+}
+
+func (r *recordingSandbox) Execute(ctx context.Context, command string) (*types.Result, error) {
+	r.mu.Lock()
+	r.commands = append(r.commands, command)
+	r.mu.Unlock()
+	if r.onExec != nil {
+		r.onExec(command)
+	}
+	return &types.Result{Stderr: "curl: (56) CONNECT tunnel failed, response 403", ExitCode: 56}, nil
+}
+
+func TestNetworkPolicy_Allows(t *testing.T) {
+	policy := NetworkPolicy{
+		Mode:  NetworkAllowlist,
+		Allow: []string{"proxy.golang.org:443", "github.com", "*.githubusercontent.com:443"},
+	}
+
+	tests := []struct {
+		host, port string
+		want       bool
+	}{
+		{"proxy.golang.org", "443", true},
+		{"proxy.golang.org", "80", false},
+		{"github.com", "22", true},
+		{"GitHub.com", "443", true},
+		{"raw.githubusercontent.com", "443", true},
+		{"githubusercontent.com", "443", false},
+		{"evil.example.com", "443", false},
+	}
+	for _, tt := range tests {
+		if got := policy.Allows(tt.host, tt.port); got != tt.want {
+			t.Errorf("Allows(%s, %s) = %v, want %v", tt.host, tt.port, got, tt.want)
+		}
+	}
+
+	if (NetworkPolicy{Mode: NetworkNone, Allow: []string{"github.com"}}).Allows("github.com", "443") {
+		t.Error("mode none must block allowlisted hosts")
+	}
+	if !(NetworkPolicy{Mode: NetworkOpen}).Allows("evil.example.com", "443") {
+		t.Error("mode open must allow everything")
+	}
+}
+
+func TestParseNetworkMode(t *testing.T) {
+	if mode, err := ParseNetworkMode(""); err != nil || mode != NetworkOpen {
+		t.Errorf("ParseNetworkMode(\"\") = %q, %v; want open", mode, err)
+	}
+	if _, err := ParseNetworkMode("firewalled"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func proxiedClient(t *testing.T, proxyAddr string) *http.Client {
+	proxyURL, err := url.Parse("http://" + proxyAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+}
+
+func TestEgressProxy_FiltersRequests(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello from upstream")
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	proxy, err := StartEgressProxy("127.0.0.1:0", NetworkPolicy{Mode: NetworkAllowlist, Allow: []string{upstreamURL.Host}}, nil)
+	if err != nil {
+		t.Fatalf("StartEgressProxy() error: %v", err)
+	}
+	defer proxy.Close()
+	client := proxiedClient(t, proxy.Addr())
+
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatalf("allowed request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "hello from upstream" {
+		t.Errorf("allowed request: status %d body %q", resp.StatusCode, body)
+	}
+
+	resp, err = client.Get("http://blocked.invalid/")
+	if err != nil {
+		t.Fatalf("blocked request errored instead of returning 403: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("blocked request status = %d, want 403", resp.StatusCode)
+	}
+
+	if _, err := client.Get("https://blocked.invalid/"); err == nil {
+		t.Error("expected CONNECT to a blocked host to fail")
+	}
+
+	blocked := proxy.Blocked()
+	if len(blocked) != 2 || blocked[0] != "blocked.invalid:80" || blocked[1] != "blocked.invalid:443" {
+		t.Errorf("Blocked() = %v", blocked)
+	}
+}
+
+func TestEgressProxy_RefusesClientsOutsideTheNetwork(t *testing.T) {
+	_, sandboxNet, _ := net.ParseCIDR("10.200.0.0/24")
+	proxy, err := StartEgressProxy("127.0.0.1:0", NetworkPolicy{Mode: NetworkOpen}, sandboxNet)
+	if err != nil {
+		t.Fatalf("StartEgressProxy() error: %v", err)
+	}
+	defer proxy.Close()
+
+	resp, err := proxiedClient(t, proxy.Addr()).Get("http://example.invalid/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("status = %d, want 403 for a client outside the sandbox network", resp.StatusCode)
+	}
+}
+
+// proxyAddr returns the proxy address a proxied command was given.
+func proxyAddr(t *testing.T, command string) string {
+	_, rest, ok := strings.Cut(command, "HTTP_PROXY=http://")
+	if !ok {
+		t.Fatalf("proxy env not injected: %q", command)
+	}
+	return strings.Fields(rest)[0]
+}
+
+// loopbackSandbox is an allowlist NetworkSandbox whose "network" is the
+// loopback interface, so tests can play the part of the container.
+func loopbackSandbox(inner Sandbox, allow ...string) *NetworkSandbox {
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	return &NetworkSandbox{Inner: inner, Policy: NetworkPolicy{Mode: NetworkAllowlist, Allow: allow},
+		gateway: net.ParseIP("127.0.0.1"), clients: loopback}
+}
+
+func TestNetworkSandbox_OpenPassesThrough(t *testing.T) {
+	inner := &recordingSandbox{}
+	sb, err := NewNetworkSandbox(context.Background(), inner, &ContainerSandbox{}, NetworkPolicy{Mode: NetworkOpen})
+	if err != nil {
+		t.Fatalf("NewNetworkSandbox() error: %v", err)
+	}
+	defer sb.Close()
+
+	if _, err := sb.Execute(context.Background(), "go mod download"); err != nil {
+		t.Fatal(err)
+	}
+	if inner.commands[0] != "go mod download" {
+		t.Errorf("command was modified in open mode: %q", inner.commands[0])
+	}
+}
+
+func TestNetworkSandbox_SurfacesBlockedConnections(t *testing.T) {
+	inner := &recordingSandbox{}
+	sb := loopbackSandbox(inner, "proxy.golang.org:443")
+
+	// Simulate the sandboxed command trying to reach a host outside the allowlist.
+	inner.onExec = func(command string) {
+		_, _ = proxiedClient(t, proxyAddr(t, command)).Get("http://evil.invalid/")
+	}
+
+	result, err := sb.Execute(context.Background(), "curl http://evil.invalid/")
+	if err != nil {
+		t.Fatalf("Execute() error: %v", err)
+	}
+
+	if !strings.Contains(inner.commands[0], "HTTPS_PROXY=http://127.0.0.1:") {
+		t.Errorf("proxy env not injected: %q", inner.commands[0])
+	}
+	if !strings.HasSuffix(inner.commands[0], "\ncurl http://evil.invalid/") {
+		t.Errorf("original command not preserved: %q", inner.commands[0])
+	}
+	if !strings.Contains(result.Stderr, "blocked connection to evil.invalid:80") {
+		t.Errorf("blocked connection not surfaced in stderr: %q", result.Stderr)
+	}
+	if !strings.Contains(result.Stderr, "proxy.golang.org:443") {
+		t.Errorf("allowlist not shown to the agent: %q", result.Stderr)
+	}
+}
+
+func TestNetworkSandbox_BlockedConnectionsArePerAction(t *testing.T) {
+	inner := &recordingSandbox{}
+	sb := loopbackSandbox(inner, "proxy.golang.org:443")
+	var wg sync.WaitGroup
+	wg.Add(2)
+	inner.onExec = func(command string) {
+		// Both actions are running before either tries to connect.
+		wg.Done()
+		wg.Wait()
+		host := strings.Fields(command[strings.LastIndex(command, "\n")+1:])[1]
+		_, _ = proxiedClient(t, proxyAddr(t, command)).Get("http://" + host + "/")
+	}
+
+	results := make(chan *types.Result, 2)
+	for _, host := range []string{"one.invalid", "two.invalid"} {
+		go func() {
+			result, err := sb.Execute(context.Background(), "curl "+host)
+			if err != nil {
+				t.Error(err)
+			}
+			results <- result
+		}()
+	}
+	for range 2 {
+		result := <-results
+		if strings.Contains(result.Stderr, "one.invalid") == strings.Contains(result.Stderr, "two.invalid") {
+			t.Errorf("expected each action to see only its own blocked host: %q", result.Stderr)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package sandbox
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// EgressProxy is a minimal HTTP/HTTPS forward proxy that only lets through
+// connections permitted by a NetworkPolicy. HTTPS is handled with CONNECT
+// tunnels, so TLS is never terminated and no certificates are involved.
+type EgressProxy struct {
+	policy   NetworkPolicy
+	clients  *net.IPNet // Only these addresses may use the proxy; nil allows any
+	listener net.Listener
+	server   *http.Server
+
+	mu      sync.Mutex
+	blocked []string
+}
+
+// StartEgressProxy listens on addr and serves until Close is called. When
+// clients is set, connections from outside it are refused.
+func StartEgressProxy(addr string, policy NetworkPolicy, clients *net.IPNet) (*EgressProxy, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start egress proxy on %s: %w", addr, err)
+	}
+
+	p := &EgressProxy{policy: policy, clients: clients, listener: ln}
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: 30 * time.Second}
+	go func() {
+		_ = p.server.Serve(ln) // returns http.ErrServerClosed after Close
+	}()
+	return p, nil
+}
+
+// Addr returns the address the proxy is listening on.
+func (p *EgressProxy) Addr() string {
+	return p.listener.Addr().String()
+}
+
+// Close shuts the proxy down.
+func (p *EgressProxy) Close() error {
+	return p.server.Close()
+}
+
+// Blocked returns the destinations the proxy has refused.
+func (p *EgressProxy) Blocked() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.blocked...)
+}
+
+func (p *EgressProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.clients != nil {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !p.clients.Contains(ip) {
+			http.Error(w, "not a sandbox address", http.StatusForbidden)
+			return
+		}
+	}
+
+	defaultPort := "80"
+	if r.Method == http.MethodConnect {
+		defaultPort = "443"
+	}
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host, port = r.Host, defaultPort
+	}
+
+	if !p.policy.Allows(host, port) {
+		p.recordBlocked(net.JoinHostPort(host, port))
+		http.Error(w, "blocked by springfield network policy", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, net.JoinHostPort(host, port))
+		return
+	}
+	p.forward(w, r)
+}
+
+func (p *EgressProxy) recordBlocked(dest string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, b := range p.blocked {
+		if b == dest {
+			return
+		}
+	}
+	p.blocked = append(p.blocked, dest)
+}
+
+func (p *EgressProxy) tunnel(w http.ResponseWriter, dest string) {
+	upstream, err := net.DialTimeout("tcp", dest, 30*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		_ = upstream.Close()
+		http.Error(w, "tunnelling not supported", http.StatusInternalServerError)
+		return
+	}
+	client, _, err := hijacker.Hijack()
+	if err != nil {
+		_ = upstream.Close()
+		return
+	}
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		_ = client.Close()
+		_ = upstream.Close()
+		return
+	}
+
+	go pipe(upstream, client)
+	go pipe(client, upstream)
+}
+
+func pipe(dst, src net.Conn) {
+	defer func() {
+		_ = dst.Close()
+		_ = src.Close()
+	}()
+	_, _ = io.Copy(dst, src)
+}
+
+// hopHeaders are meaningful only for a single connection and must not be
+// forwarded (RFC 7230, section 6.1).
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+func (p *EgressProxy) forward(w http.ResponseWriter, r *http.Request) {
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+
+	resp, err := http.DefaultTransport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	for _, h := range hopHeaders {
+		resp.Header.Del(h)
+	}
+	for k, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
@@ -0,0 +1,250 @@
+// Package spend keeps a persistent, cross-run ledger of LLM token usage and
+// cost, and enforces daily, weekly and per-epic spending caps.
+package spend
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultPath is where the ledger lives relative to the project root.
+var DefaultPath = filepath.Join(".springfield", "spend.jsonl")
+
+// Entry records the usage of one LLM call.
+type Entry struct {
+	Timestamp        time.Time `json:"timestamp"`
+	RunID            string    `json:"run_id"`
+	Agent            string    `json:"agent"`
+	Epic             string    `json:"epic,omitempty"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	CacheReadTokens  int       `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int       `json:"cache_write_tokens,omitempty"`
+	Cost             float64   `json:"cost"`
+}
+
+// Ledger is an append-only JSONL file of spend entries. Each entry is written
+// with a single append so concurrent springfield processes can share it.
+type Ledger struct {
+	Path string
+}
+
+// Open returns a ledger stored at path, or DefaultPath when path is empty.
+func Open(path string) *Ledger {
+	if path == "" {
+		path = DefaultPath
+	}
+	return &Ledger{Path: path}
+}
+
+// Record appends an entry to the ledger.
+func (l *Ledger) Record(e Entry) error {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal spend entry: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create ledger directory: %w", err)
+	}
+	f, err := os.OpenFile(l.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open spend ledger %s: %w", l.Path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write spend ledger %s: %w", l.Path, err)
+	}
+	return nil
+}
+
+// Entries reads every entry in the ledger. A missing ledger is empty.
+func (l *Ledger) Entries() ([]Entry, error) {
+	f, err := os.Open(l.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spend ledger %s: %w", l.Path, err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("malformed spend ledger %s line %d: %w", l.Path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Caps are spending limits in USD. Zero disables a cap.
+type Caps struct {
+	Daily   float64
+	Weekly  float64
+	PerEpic float64
+}
+
+// ErrCapExceeded is wrapped by every CapExceededError.
+var ErrCapExceeded = errors.New("spend cap exceeded")
+
+// CapExceededError reports which cap has been reached.
+type CapExceededError struct {
+	Cap   string // "daily", "weekly" or "epic"
+	Limit float64
+	Spent float64
+	Epic  string
+}
+
+func (e *CapExceededError) Error() string {
+	if e.Cap == "epic" {
+		return fmt.Sprintf("%s: epic %s has spent $%.2f of its $%.2f cap", ErrCapExceeded, e.Epic, e.Spent, e.Limit)
+	}
+	return fmt.Sprintf("%s: $%.2f spent against the %s cap of $%.2f", ErrCapExceeded, e.Spent, e.Cap, e.Limit)
+}
+
+func (e *CapExceededError) Unwrap() error {
+	return ErrCapExceeded
+}
+
+// Check returns a *CapExceededError if starting a run now for the given epic
+// would break a cap. The daily window starts at local midnight and the weekly
+// window on Monday.
+func (l *Ledger) Check(caps Caps, epic string, now time.Time) error {
+	if caps.Daily == 0 && caps.Weekly == 0 && (caps.PerEpic == 0 || epic == "") {
+		return nil
+	}
+	entries, err := l.Entries()
+	if err != nil {
+		return err
+	}
+
+	day := startOfDay(now)
+	week := startOfWeek(now)
+	var daily, weekly, epicTotal float64
+	for _, e := range entries {
+		if !e.Timestamp.Before(day) {
+			daily += e.Cost
+		}
+		if !e.Timestamp.Before(week) {
+			weekly += e.Cost
+		}
+		if epic != "" && e.Epic == epic {
+			epicTotal += e.Cost
+		}
+	}
+
+	switch {
+	case caps.Daily > 0 && daily >= caps.Daily:
+		return &CapExceededError{Cap: "daily", Limit: caps.Daily, Spent: daily}
+	case caps.Weekly > 0 && weekly >= caps.Weekly:
+		return &CapExceededError{Cap: "weekly", Limit: caps.Weekly, Spent: weekly}
+	case caps.PerEpic > 0 && epic != "" && epicTotal >= caps.PerEpic:
+		return &CapExceededError{Cap: "epic", Limit: caps.PerEpic, Spent: epicTotal, Epic: epic}
+	}
+	return nil
+}
+
+// ReportRow aggregates entries sharing a group key.
+type ReportRow struct {
+	Key         string
+	Runs        int
+	Calls       int
+	TotalTokens int
+	Cost        float64
+}
+
+// GroupByKeys lists the supported report groupings.
+var GroupByKeys = []string{"agent", "epic", "model", "day", "run"}
+
+// Report aggregates entries at or after since by the given key, most
+// expensive first.
+func Report(entries []Entry, groupBy string, since time.Time) ([]ReportRow, error) {
+	keyOf, err := groupKeyFunc(groupBy)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make(map[string]*ReportRow)
+	runs := make(map[string]map[string]bool)
+	for _, e := range entries {
+		if e.Timestamp.Before(since) {
+			continue
+		}
+		key := keyOf(e)
+		row, ok := rows[key]
+		if !ok {
+			row = &ReportRow{Key: key}
+			rows[key] = row
+			runs[key] = make(map[string]bool)
+		}
+		row.Calls++
+		row.TotalTokens += e.TotalTokens
+		row.Cost += e.Cost
+		runs[key][e.RunID] = true
+	}
+
+	report := make([]ReportRow, 0, len(rows))
+	for key, row := range rows {
+		row.Runs = len(runs[key])
+		report = append(report, *row)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Cost != report[j].Cost {
+			return report[i].Cost > report[j].Cost
+		}
+		return report[i].Key < report[j].Key
+	})
+	return report, nil
+}
+
+func groupKeyFunc(groupBy string) (func(Entry) string, error) {
+	orNone := func(s string) string {
+		if s == "" {
+			return "(none)"
+		}
+		return s
+	}
+	switch groupBy {
+	case "agent":
+		return func(e Entry) string { return orNone(e.Agent) }, nil
+	case "epic":
+		return func(e Entry) string { return orNone(e.Epic) }, nil
+	case "model":
+		return func(e Entry) string { return orNone(e.Model) }, nil
+	case "day":
+		return func(e Entry) string { return e.Timestamp.Local().Format("2006-01-02") }, nil
+	case "run":
+		return func(e Entry) string { return orNone(e.RunID) }, nil
+	}
+	return nil, fmt.Errorf("unknown group-by %q (want one of %s)", groupBy, strings.Join(GroupByKeys, ", "))
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+func startOfWeek(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7 // days since Monday
+	return startOfDay(t).AddDate(0, 0, -offset)
+}
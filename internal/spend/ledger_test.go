@@ -0,0 +1,126 @@
+package spend
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLedger_RecordAndEntries(t *testing.T) {
+	l := Open(filepath.Join(t.TempDir(), "nested", "spend.jsonl"))
+
+	entries, err := l.Entries()
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("missing ledger should be empty, got %v, %v", entries, err)
+	}
+
+	want := []Entry{
+		{RunID: "r1", Agent: "ralph", Epic: "td-1", Model: "anthropic/claude-sonnet-4-5", TotalTokens: 1000, Cost: 0.5},
+		{RunID: "r1", Agent: "ralph", Epic: "td-1", Model: "anthropic/claude-haiku-4-5", TotalTokens: 200, Cost: 0.01},
+	}
+	for _, e := range want {
+		if err := l.Record(e); err != nil {
+			t.Fatalf("Record() error: %v", err)
+		}
+	}
+
+	got, err := l.Entries()
+	if err != nil {
+		t.Fatalf("Entries() error: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d entries, want 2", len(got))
+	}
+	if got[1].Model != want[1].Model || got[1].Cost != want[1].Cost {
+		t.Errorf("entry mismatch: %+v", got[1])
+	}
+	if got[0].Timestamp.IsZero() {
+		t.Error("Record should stamp entries without a timestamp")
+	}
+}
+
+func TestLedger_Check(t *testing.T) {
+	// Wednesday afternoon; the week started on Monday the 12th.
+	now := time.Date(2026, 10, 14, 15, 0, 0, 0, time.Local)
+	l := Open(filepath.Join(t.TempDir(), "spend.jsonl"))
+	for _, e := range []Entry{
+		{Timestamp: now.Add(-1 * time.Hour), Epic: "td-1", Cost: 3},
+		{Timestamp: now.AddDate(0, 0, -2), Epic: "td-1", Cost: 4},  // Monday
+		{Timestamp: now.AddDate(0, 0, -4), Epic: "td-2", Cost: 10}, // last week
+	} {
+		if err := l.Record(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		caps    Caps
+		epic    string
+		wantCap string
+	}{
+		{"no caps", Caps{}, "td-1", ""},
+		{"under daily", Caps{Daily: 5}, "", ""},
+		{"daily reached", Caps{Daily: 3}, "", "daily"},
+		{"under weekly", Caps{Weekly: 8}, "", ""},
+		{"weekly reached", Caps{Weekly: 7}, "", "weekly"},
+		{"epic reached", Caps{PerEpic: 7}, "td-1", "epic"},
+		{"other epic", Caps{PerEpic: 11}, "td-2", ""},
+		{"epic cap without epic", Caps{PerEpic: 1}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := l.Check(tt.caps, tt.epic, now)
+			if tt.wantCap == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			var capErr *CapExceededError
+			if !errors.As(err, &capErr) || capErr.Cap != tt.wantCap {
+				t.Fatalf("expected %s cap error, got %v", tt.wantCap, err)
+			}
+			if !errors.Is(err, ErrCapExceeded) {
+				t.Error("cap errors should wrap ErrCapExceeded")
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	day := time.Date(2026, 10, 14, 12, 0, 0, 0, time.Local)
+	entries := []Entry{
+		{Timestamp: day, RunID: "r1", Agent: "ralph", Epic: "td-1", Model: "m1", TotalTokens: 100, Cost: 1},
+		{Timestamp: day, RunID: "r1", Agent: "ralph", Epic: "td-1", Model: "m2", TotalTokens: 50, Cost: 0.5},
+		{Timestamp: day, RunID: "r2", Agent: "bart", Epic: "td-1", Model: "m1", TotalTokens: 300, Cost: 3},
+		{Timestamp: day.AddDate(0, 0, -10), RunID: "r0", Agent: "lisa", Model: "m1", TotalTokens: 10, Cost: 9},
+	}
+
+	rows, err := Report(entries, "agent", day.AddDate(0, 0, -1))
+	if err != nil {
+		t.Fatalf("Report() error: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2 (lisa is outside the window): %+v", len(rows), rows)
+	}
+	if rows[0].Key != "bart" || rows[1].Key != "ralph" {
+		t.Errorf("rows should be ordered by cost: %+v", rows)
+	}
+	if rows[1].Runs != 1 || rows[1].Calls != 2 || rows[1].TotalTokens != 150 || rows[1].Cost != 1.5 {
+		t.Errorf("ralph row = %+v", rows[1])
+	}
+
+	rows, err = Report(entries, "epic", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Key != "(none)" || rows[1].Key != "td-1" || rows[1].Runs != 2 {
+		t.Errorf("epic rows = %+v", rows)
+	}
+
+	if _, err := Report(entries, "colour", time.Time{}); err == nil {
+		t.Error("expected error for unknown group-by")
+	}
+}
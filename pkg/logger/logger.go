@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/shalomb/springfield/pkg/redact"
 )
 
 // Entry represents a single log entry in JSON format.
@@ -23,6 +25,10 @@ type Entry struct {
 
 var LogDir = "logs"
 
+// Redactor scrubs secrets from messages and data before they are written.
+// Set it to nil to disable redaction.
+var Redactor = redact.Default()
+
 func init() {
 	if dir := os.Getenv("SPRINGFIELD_LOG_DIR"); dir != "" {
 		LogDir = dir
@@ -33,15 +39,18 @@ func init() {
 func Log(message string, level string, agent string, epic string, task string, tokenUsage interface{}, cost float64, data map[string]interface{}) error {
 	entry := Entry{
 		Timestamp:  time.Now().Format(time.RFC3339),
-		Message:    message,
+		Message:    Redactor.Redact(message),
 		Level:      level,
 		Agent:      agent,
 		Epic:       epic,
-		Task:       task,
+		Task:       Redactor.Redact(task),
 		TokenUsage: tokenUsage,
 		Cost:       cost,
 		Data:       data,
 	}
+	if data != nil && Redactor != nil {
+		entry.Data = Redactor.RedactValue(data).(map[string]interface{})
+	}
 
 	if entry.Level == "" {
 		entry.Level = "INFO"
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -178,3 +179,27 @@ func TestAppendToFile_WriteError(t *testing.T) {
 		t.Error("expected error writing to /dev/full, got nil")
 	}
 }
+
+func TestLog_RedactsSecrets(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalLogDir := LogDir
+	LogDir = tmpDir
+	defer func() { LogDir = originalLogDir }()
+
+	secret := "sk-ant-REDACTED"
+	data := map[string]interface{}{"stdout": "ANTHROPIC_API_KEY=" + secret}
+	if err := Log("Action result: STDOUT: "+secret, "DEBUG", "ralph", "", "", nil, 0, data); err != nil {
+		t.Fatalf("Log failed: %v", err)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(tmpDir, "ralph.log"))
+	if err != nil {
+		t.Fatalf("failed to read agent log: %v", err)
+	}
+	if strings.Contains(string(raw), secret) {
+		t.Errorf("secret written to log: %s", raw)
+	}
+	if !strings.Contains(string(raw), "REDACTED") {
+		t.Errorf("expected redaction placeholder in log: %s", raw)
+	}
+}
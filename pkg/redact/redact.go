@@ -0,0 +1,206 @@
+// Package redact removes credentials and other secrets from text before it
+// leaves the process: messages sent to LLM providers, log entries and files
+// written on behalf of agents.
+package redact
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Placeholder formats the replacement text for a secret found by detector name.
+func Placeholder(name string) string {
+	return "[REDACTED:" + name + "]"
+}
+
+// detector finds one kind of secret. When group is non-zero only that
+// submatch is replaced, which keeps the surrounding key name readable
+// (e.g. "GITHUB_TOKEN=[REDACTED:assignment]").
+type detector struct {
+	name    string
+	pattern *regexp.Regexp
+	group   int
+}
+
+var builtinDetectors = []detector{
+	{"private_key", regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY-----`), 0},
+	{"anthropic_key", regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_\-]{20,}`), 0},
+	{"openai_key", regexp.MustCompile(`\bsk-(?:proj-)?[A-Za-z0-9_\-]{20,}`), 0},
+	{"aws_access_key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), 0},
+	{"github_token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`), 0},
+	{"google_api_key", regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}`), 0},
+	{"slack_token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9\-]{10,}`), 0},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,}`), 0},
+	{"bearer_token", regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/\-]{16,}=*)`), 1},
+	{"url_credentials", regexp.MustCompile(`\b[a-z][a-z0-9+.\-]*://[^\s:/@]+:([^\s@/]+)@`), 1},
+	// KEY=value and key: value pairs whose name says they hold a secret, as
+	// printed by `env` or found in .env files and YAML.
+	{"assignment", regexp.MustCompile(`\b[A-Za-z0-9_.\-]*(?i:secret|token|password|passwd|api_?key|access_?key|private_?key|credentials?)(?:_[A-Za-z0-9]+)*["']?\s*[=:]\s*["']?([^\s"']{4,})`), 1},
+}
+
+// highEntropyCandidate matches long runs of token-like characters that are
+// then tested for randomness.
+var highEntropyCandidate = regexp.MustCompile(`[A-Za-z0-9+/_\-]{32,}={0,2}`)
+
+// Redactor replaces secrets in text with placeholders.
+type Redactor struct {
+	detectors []detector
+	// MinEntropy is the Shannon entropy (bits per character) above which a
+	// long mixed-case alphanumeric token is treated as a secret. Zero
+	// disables the entropy detector.
+	MinEntropy float64
+}
+
+// Default returns a Redactor with the built-in detectors only.
+func Default() *Redactor {
+	r, _ := New(nil)
+	return r
+}
+
+// New returns a Redactor with the built-in detectors plus the given regular
+// expressions. If a pattern has a capture group only the first group is
+// replaced; otherwise the whole match is.
+func New(patterns []string) (*Redactor, error) {
+	r := &Redactor{
+		detectors:  append([]detector(nil), builtinDetectors...),
+		MinEntropy: 4.3,
+	}
+	for i, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+		}
+		group := 0
+		if re.NumSubexp() > 0 {
+			group = 1
+		}
+		r.detectors = append(r.detectors, detector{name: fmt.Sprintf("custom_%d", i+1), pattern: re, group: group})
+	}
+	return r, nil
+}
+
+// Redact returns s with every detected secret replaced. A nil Redactor
+// returns s unchanged.
+func (r *Redactor) Redact(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, d := range r.detectors {
+		s = d.apply(s)
+	}
+	if r.MinEntropy > 0 {
+		s = r.redactHighEntropy(s)
+	}
+	return s
+}
+
+func (r *Redactor) redactHighEntropy(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range highEntropyCandidate.FindAllStringIndex(s, -1) {
+		// Module checksums in go.sum ("h1:<base64>") are public by design.
+		if strings.HasSuffix(s[:m[0]], "h1:") || !looksRandom(s[m[0]:m[1]], r.MinEntropy) {
+			continue
+		}
+		b.WriteString(s[last:m[0]])
+		b.WriteString(Placeholder("high_entropy"))
+		last = m[1]
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// RedactValue redacts strings nested anywhere inside v, as found in the Data
+// field of log entries. Other values are returned unchanged.
+func (r *Redactor) RedactValue(v interface{}) interface{} {
+	if r == nil {
+		return v
+	}
+	switch val := v.(type) {
+	case string:
+		return r.Redact(val)
+	case []string:
+		out := make([]string, len(val))
+		for i, s := range val {
+			out[i] = r.Redact(s)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = r.RedactValue(item)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[k] = r.RedactValue(item)
+		}
+		return out
+	}
+	return v
+}
+
+func (d detector) apply(s string) string {
+	if d.group == 0 {
+		return d.pattern.ReplaceAllString(s, Placeholder(d.name))
+	}
+
+	matches := d.pattern.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[2*d.group], m[2*d.group+1]
+		if start < 0 || strings.HasPrefix(s[start:end], "[REDACTED:") {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(Placeholder(d.name))
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// looksRandom reports whether tok is likely a generated secret rather than an
+// identifier, path or hash. Hex digests (git SHAs, checksums) stay below the
+// threshold because they use only 16 symbols.
+func looksRandom(tok string, minEntropy float64) bool {
+	var hasDigit, hasUpper, hasLower bool
+	for _, c := range tok {
+		switch {
+		case c >= '0' && c <= '9':
+			hasDigit = true
+		case c >= 'A' && c <= 'Z':
+			hasUpper = true
+		case c >= 'a' && c <= 'z':
+			hasLower = true
+		}
+	}
+	if !hasDigit || !hasUpper || !hasLower {
+		return false
+	}
+	return entropy(tok) >= minEntropy
+}
+
+func entropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, c := range s {
+		counts[c]++
+	}
+	n := float64(len(s))
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
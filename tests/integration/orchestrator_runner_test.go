@@ -13,7 +13,7 @@ func TestCommandAgentRunner_ActuallyRunsBinary(t *testing.T) {
 	}
 
 	// This should fail if it tries to execute the binary
-	err := runner.Run("ralph", "td-123", "")
+	_, err := runner.Run(orchestrator.Invocation{Agent: "ralph", EpicID: "td-123"})
 
 	// Since the current implementation is a stub that just logs, it will return nil (success).
 	// This test asserts that it SHOULD fail, thus proving the implementation is incomplete.